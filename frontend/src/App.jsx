@@ -81,7 +81,7 @@ function App() {
     try {
       setIsLoading(true);
       const sessionName = `Cuộc trò chuyện ${new Date().toLocaleString('vi-VN')}`;
-      const response = await chatAPI.createSession(sessionName, null, categoryId);
+      const response = await chatAPI.createSession(sessionName, categoryId);
       
       if (response.session) {
         const newSession = response.session;
@@ -91,6 +91,10 @@ const AdminDashboard = () => {
       fetchDocuments();
     } catch (error) {
       console.error('Create error:', error);
+      if (error.response?.status === 409) {
+        alert(`Nội dung này đã tồn tại trong document "${error.response.data.document?.name}"`);
+        return;
+      }
       alert('Có lỗi xảy ra khi tạo document');
     }
   };
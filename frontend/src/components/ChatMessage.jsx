@@ -2,6 +2,7 @@ import React from 'react';
 import { format } from 'date-fns';
 import { Bot, User, HelpCircle, Send } from 'lucide-react';
 import MarkdownRenderer from './MarkdownRenderer';
+import { getAuthHeaders } from '../services/api';
 import './ChatMessage.css';
 
 const ChatMessage = ({ message, isLoading = false, onActionClick }) => {
@@ -25,6 +26,7 @@ const ChatMessage = ({ message, isLoading = false, onActionClick }) => {
           method: action.method,
           headers: {
             'Content-Type': 'application/json',
+            ...getAuthHeaders(),
           },
           body: JSON.stringify(action.payload)
         });
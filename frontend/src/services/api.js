@@ -28,13 +28,25 @@ const api = axios.create({
   },
 });
 
+// Credential sent with every request: a JWT or API key saved by the login flow,
+// falling back to VITE_API_KEY for local setups
+export const getAuthHeaders = () => {
+  const token = localStorage.getItem('authToken') || import.meta.env.VITE_API_KEY;
+  return token ? { Authorization: `Bearer ${token}` } : {};
+};
+
+api.interceptors.request.use((config) => {
+  config.headers = { ...config.headers, ...getAuthHeaders() };
+  return config;
+});
+
 // Chat API functions
 export const chatAPI = {
   // Create a new chat session
-  createSession: async (name, userID = null, categoryID = null) => {
+  // The session is owned by the authenticated user
+  createSession: async (name, categoryID = null) => {
     const response = await api.post('/chat/sessions', {
       name,
-      user_id: userID,
       category_id: categoryID,
     });
     return response.data;
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"company-ai-training/internal/models"
+	"company-ai-training/internal/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Permission is an action a role may perform
+type Permission string
+
+const (
+	PermissionManageDocuments  Permission = "documents:manage"  // Upload, edit, delete and re-embed documents, manage ingestion jobs
+	PermissionManageCategories Permission = "categories:manage" // Create, edit and delete categories
+	PermissionManageUsers      Permission = "users:manage"      // Create users, list users and assign roles
+	PermissionManageTickets    Permission = "tickets:manage"    // See every ticket and change ticket status
+	PermissionViewAllSessions  Permission = "sessions:view_all" // Read other users' chat sessions
+	PermissionViewTicketed     Permission = "sessions:ticketed" // Read the chat sessions HR tickets were raised from
+	PermissionManageSessions   Permission = "sessions:manage"   // Delete other users' chat sessions
+)
+
+// rolePermissions lists what each role may do beyond chatting in its own sessions
+var rolePermissions = map[string][]Permission{
+	models.RoleAdmin: {
+		PermissionManageDocuments,
+		PermissionManageCategories,
+		PermissionManageUsers,
+		PermissionManageTickets,
+		PermissionViewAllSessions,
+		PermissionManageSessions,
+	},
+	models.RoleHRAgent: {
+		PermissionManageTickets,
+		PermissionViewTicketed,
+	},
+	models.RoleEmployee: {},
+}
+
+// hasPermission reports whether the caller's role grants the permission
+func hasPermission(principal *services.Principal, permission Permission) bool {
+	for _, granted := range rolePermissions[principal.Role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission rejects callers whose role does not grant the permission
+func RequirePermission(permission Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !hasPermission(currentPrincipal(c), permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You do not have permission to perform this action"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// canAccessOwned reports whether the caller owns a resource or may act on everyone's
+func canAccessOwned(c *gin.Context, ownerID *uuid.UUID, permission Permission) bool {
+	principal := currentPrincipal(c)
+	return principal.IsUser(ownerID) || hasPermission(principal, permission)
+}
+
+// authorizedSession loads a chat session the caller owns or may act on with the
+// permission. Sessions the caller cannot access are reported as not found.
+func (h *Handlers) authorizedSession(c *gin.Context, sessionID uuid.UUID, permission Permission) (*models.ChatSession, bool) {
+	session, err := h.chat(c).GetSession(sessionID)
+	if err != nil || !canAccessOwned(c, session.UserID, permission) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return nil, false
+	}
+	return session, true
+}
+
+// readableSession loads a chat session the caller may read: their own, any session with
+// PermissionViewAllSessions, or one an HR ticket was raised from with PermissionViewTicketed.
+// Sessions the caller cannot read are reported as not found.
+func (h *Handlers) readableSession(c *gin.Context, sessionID uuid.UUID) (*models.ChatSession, bool) {
+	session, err := h.chat(c).GetSession(sessionID)
+	if err == nil && canAccessOwned(c, session.UserID, PermissionViewAllSessions) {
+		return session, true
+	}
+	if err == nil && hasPermission(currentPrincipal(c), PermissionViewTicketed) {
+		tickets, err := h.tickets(c).GetSessionTickets(sessionID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		if len(tickets) > 0 {
+			return session, true
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+	return nil, false
+}
+
+// canReadDocument checks the document's access rules for the caller. Documents the
+// caller cannot read are reported as not found.
+func (h *Handlers) canReadDocument(c *gin.Context, documentID uuid.UUID) bool {
+	allowed, err := h.access(c).CanAccessDocument(documentID, currentPrincipal(c).AccessSubject())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,247 @@
+package api
+
+import (
+	"company-ai-training/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newStatusContext returns a test context for a GET of target and its recorder
+func newStatusContext(target string) (*gin.Context, *httptest.ResponseRecorder) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, target, nil)
+	return c, recorder
+}
+
+// statusLoader returns the given snapshots one per call, repeating the last one
+func statusLoader(snapshots ...[]models.DocumentIngestionStatus) (func() ([]models.DocumentIngestionStatus, error), *int) {
+	calls := 0
+	return func() ([]models.DocumentIngestionStatus, error) {
+		snapshot := snapshots[min(calls, len(snapshots)-1)]
+		calls++
+		return snapshot, nil
+	}, &calls
+}
+
+// sseEvent is one Server-Sent Event of a response body
+type sseEvent struct {
+	name string
+	data string
+}
+
+func parseEvents(body string) []sseEvent {
+	var events []sseEvent
+	for _, block := range strings.Split(body, "\n\n") {
+		var event sseEvent
+		for _, line := range strings.Split(block, "\n") {
+			if name, ok := strings.CutPrefix(line, "event:"); ok {
+				event.name = name
+			} else if data, ok := strings.CutPrefix(line, "data:"); ok {
+				event.data = data
+			}
+		}
+		if event.name != "" {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func TestGetDocumentStatusesRejectsInvalidIDs(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		want   string
+	}{
+		{"missing ids", "/documents/status", "Query parameter 'ids' is required"},
+		{"only separators", "/documents/status?ids=,,", "Query parameter 'ids' is required"},
+		{"invalid id", "/documents/status?ids=" + uuid.NewString() + ",abc", "Invalid document ID: abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, recorder := newStatusContext(tt.target)
+			(&Handlers{}).GetDocumentStatuses(c)
+
+			if recorder.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d", recorder.Code, http.StatusBadRequest)
+			}
+			if !strings.Contains(recorder.Body.String(), tt.want) {
+				t.Errorf("body = %s, want error %q", recorder.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestGetDocumentStatusRejectsInvalidID(t *testing.T) {
+	c, recorder := newStatusContext("/documents/abc/status")
+	c.Params = gin.Params{{Key: "id", Value: "abc"}}
+	(&Handlers{}).GetDocumentStatus(c)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+}
+
+func TestWriteDocumentStatusesJSON(t *testing.T) {
+	pending := models.DocumentIngestionStatus{DocumentID: uuid.New(), Name: "a.pdf", Status: models.DocumentStatusExtracting}
+	failed := models.DocumentIngestionStatus{DocumentID: uuid.New(), Name: "b.pdf", Status: models.DocumentStatusFailed, Error: "no page could be extracted"}
+
+	tests := []struct {
+		name       string
+		statuses   []models.DocumentIngestionStatus
+		single     bool
+		wantStatus int
+		wantBody   interface{}
+	}{
+		{"single", []models.DocumentIngestionStatus{pending}, true, http.StatusOK, map[string]interface{}{"status": pending}},
+		{"single not found", nil, true, http.StatusNotFound, map[string]interface{}{"error": "Document not found"}},
+		{"batch", []models.DocumentIngestionStatus{pending, failed}, false, http.StatusOK, map[string]interface{}{"statuses": []models.DocumentIngestionStatus{pending, failed}}},
+		{"empty batch", nil, false, http.StatusOK, map[string]interface{}{"statuses": nil}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, recorder := newStatusContext("/documents/status")
+			load, _ := statusLoader(tt.statuses)
+			writeDocumentStatuses(c, load, tt.single)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			want, _ := json.Marshal(tt.wantBody)
+			if got := recorder.Body.String(); got != string(want) {
+				t.Errorf("body = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestWriteDocumentStatusesLoadError(t *testing.T) {
+	c, recorder := newStatusContext("/documents/status?stream=true")
+	writeDocumentStatuses(c, func() ([]models.DocumentIngestionStatus, error) {
+		return nil, errors.New("database is down")
+	}, false)
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", recorder.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestWriteDocumentStatusesStream(t *testing.T) {
+	defer func(interval time.Duration) { documentStatusPollInterval = interval }(documentStatusPollInterval)
+	documentStatusPollInterval = time.Millisecond
+
+	a, b := uuid.New(), uuid.New()
+	status := func(id uuid.UUID, state string, processed int) models.DocumentIngestionStatus {
+		return models.DocumentIngestionStatus{DocumentID: id, Status: state, ChunksProcessed: processed, ChunksTotal: 4}
+	}
+	load, calls := statusLoader(
+		[]models.DocumentIngestionStatus{status(a, models.DocumentStatusExtracting, 0), status(b, models.DocumentStatusPending, 0)},
+		[]models.DocumentIngestionStatus{status(a, models.DocumentStatusPending, 0), status(b, models.DocumentStatusPending, 0)},
+		[]models.DocumentIngestionStatus{status(a, models.DocumentStatusEmbedding, 2), status(b, models.DocumentStatusFailed, 0)},
+		[]models.DocumentIngestionStatus{status(a, models.DocumentStatusEmbedding, 2), status(b, models.DocumentStatusFailed, 0)},
+		[]models.DocumentIngestionStatus{status(a, models.DocumentStatusReady, 4), status(b, models.DocumentStatusFailed, 0)},
+	)
+
+	c, recorder := newStatusContext("/documents/status?stream=true")
+	writeDocumentStatuses(c, load, false)
+
+	if got := recorder.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/event-stream") {
+		t.Errorf("Content-Type = %q, want text/event-stream", got)
+	}
+	if *calls != 5 {
+		t.Errorf("statuses loaded %d times, want 5", *calls)
+	}
+
+	// Only changes are sent, unchanged documents and snapshots are skipped
+	var got []string
+	for _, event := range parseEvents(recorder.Body.String()) {
+		if event.name != "status" {
+			got = append(got, event.name+" "+event.data)
+			continue
+		}
+		var s models.DocumentIngestionStatus
+		if err := json.Unmarshal([]byte(event.data), &s); err != nil {
+			t.Fatalf("invalid status event %q: %v", event.data, err)
+		}
+		name := "a"
+		if s.DocumentID == b {
+			name = "b"
+		}
+		got = append(got, name+" "+s.Status)
+	}
+	want := []string{
+		"a extracting", "b pending",
+		"a pending",
+		"a embedding", "b failed",
+		"a ready",
+		`done {"documents":2}`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+}
+
+func TestWriteDocumentStatusesStreamReportsLoadErrors(t *testing.T) {
+	defer func(interval time.Duration) { documentStatusPollInterval = interval }(documentStatusPollInterval)
+	documentStatusPollInterval = time.Millisecond
+
+	calls := 0
+	c, recorder := newStatusContext("/documents/status?stream=true")
+	writeDocumentStatuses(c, func() ([]models.DocumentIngestionStatus, error) {
+		calls++
+		if calls > 1 {
+			return nil, errors.New("database is down")
+		}
+		return []models.DocumentIngestionStatus{{DocumentID: uuid.New(), Status: models.DocumentStatusEmbedding}}, nil
+	}, true)
+
+	events := parseEvents(recorder.Body.String())
+	if len(events) != 2 || events[0].name != "status" || events[1].name != "error" {
+		t.Errorf("events = %v, want a status and an error", events)
+	}
+}
+
+func TestWriteDocumentStatusesStreamStopsWhenClientLeaves(t *testing.T) {
+	load, calls := statusLoader([]models.DocumentIngestionStatus{{DocumentID: uuid.New(), Status: models.DocumentStatusEmbedding}})
+
+	c, recorder := newStatusContext("/documents/status?stream=true")
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	cancel()
+	c.Request = c.Request.WithContext(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		writeDocumentStatuses(c, load, true)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream did not end after the client left")
+	}
+
+	if *calls != 1 {
+		t.Errorf("statuses loaded %d times, want 1", *calls)
+	}
+	if events := parseEvents(recorder.Body.String()); len(events) != 1 || events[0].name != "status" {
+		t.Errorf("events = %v, want only the initial status", events)
+	}
+}
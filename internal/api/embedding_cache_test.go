@@ -0,0 +1,76 @@
+package api
+
+import (
+	"company-ai-training/internal/services"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestPurgeEmbeddingCache(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantBody   string
+		wantSQL    string
+	}{
+		{"invalid dimension", "/embedding-cache?dimension=abc", http.StatusBadRequest, "Invalid dimension", ""},
+		{"zero dimension", "/embedding-cache?dimension=0", http.StatusBadRequest, "Invalid dimension", ""},
+		{"invalid unused_for", "/embedding-cache?unused_for=30d", http.StatusBadRequest, "Invalid unused_for", ""},
+		{"negative unused_for", "/embedding-cache?unused_for=-1h", http.StatusBadRequest, "Invalid unused_for", ""},
+		{
+			name:       "model and dimension",
+			target:     "/embedding-cache?model=text-embedding-004&dimension=768",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"deleted":0}`,
+			wantSQL:    `DELETE FROM "embedding_cache" WHERE model = 'text-embedding-004' AND dimension = 768`,
+		},
+		{
+			name:       "unused entries",
+			target:     "/embedding-cache?unused_for=720h",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"deleted":0}`,
+			wantSQL:    `DELETE FROM "embedding_cache" WHERE last_used_at < `,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The cache builds its statements without a database, invalid requests must not reach it
+			db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 sslmode=disable"}),
+				&gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var statements []string
+			db.Callback().Delete().After("gorm:delete").Register("test:capture", func(tx *gorm.DB) {
+				statements = append(statements, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+			})
+
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodDelete, tt.target, nil)
+			(&Handlers{embeddingCache: services.NewEmbeddingCache(db)}).PurgeEmbeddingCache(c)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if !strings.Contains(recorder.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want %s", recorder.Body.String(), tt.wantBody)
+			}
+			if tt.wantSQL == "" {
+				if len(statements) != 0 {
+					t.Errorf("statements = %q, want none", statements)
+				}
+			} else if len(statements) != 1 || !strings.HasPrefix(statements[0], tt.wantSQL) {
+				t.Errorf("statements = %q, want %q", statements, tt.wantSQL)
+			}
+		})
+	}
+}
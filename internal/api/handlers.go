@@ -1,39 +1,62 @@
 package api
 
 import (
+	"company-ai-training/internal/models"
 	"company-ai-training/internal/services"
+	"errors"
 	"fmt"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type Handlers struct {
-	documentService *services.DocumentService
-	vectorService   *services.VectorService
-	chatService     *services.ChatService
-	userService     *services.UserService
-	ticketService   *services.TicketService
-	categoryService *services.CategoryService
+	documentService  *services.DocumentService
+	vectorService    *services.VectorService
+	chatService      *services.ChatService
+	userService      *services.UserService
+	ticketService    *services.TicketService
+	categoryService  *services.CategoryService
+	ingestionService *services.IngestionService
+	accessService    *services.AccessControlService
+	authService      *services.AuthService
+	tenantService    *services.TenantService
+	embeddingCache   *services.EmbeddingCache
+	vectorIndex      *services.VectorIndexService
 }
 
-func NewHandlers(docService *services.DocumentService, vecService *services.VectorService, chatService *services.ChatService, userService *services.UserService, ticketService *services.TicketService, categoryService *services.CategoryService) *Handlers {
+func NewHandlers(docService *services.DocumentService, vecService *services.VectorService, chatService *services.ChatService, userService *services.UserService, ticketService *services.TicketService, categoryService *services.CategoryService, ingestionService *services.IngestionService, accessService *services.AccessControlService, authService *services.AuthService, tenantService *services.TenantService, embeddingCache *services.EmbeddingCache, vectorIndexService *services.VectorIndexService) *Handlers {
 	return &Handlers{
-		documentService: docService,
-		vectorService:   vecService,
-		chatService:     chatService,
-		userService:     userService,
-		ticketService:   ticketService,
-		categoryService: categoryService,
+		documentService:  docService,
+		vectorService:    vecService,
+		chatService:      chatService,
+		userService:      userService,
+		ticketService:    ticketService,
+		categoryService:  categoryService,
+		ingestionService: ingestionService,
+		accessService:    accessService,
+		authService:      authService,
+		tenantService:    tenantService,
+		embeddingCache:   embeddingCache,
+		vectorIndex:      vectorIndexService,
 	}
 }
 
 // Document handlers
 
 func (h *Handlers) UploadDocument(c *gin.Context) {
+	// Duplicate policy from the form, the query string or, below, the JSON body
+	duplicatePolicy := c.PostForm("duplicate_policy")
+	if duplicatePolicy == "" {
+		duplicatePolicy = c.Query("duplicate_policy")
+	}
+
 	// Check if it's a file upload or text content
 	file, err := c.FormFile("file")
 	if err != nil {
@@ -47,14 +70,18 @@ func (h *Handlers) UploadDocument(c *gin.Context) {
 		// If not found, try JSON body
 		if content == "" || name == "" {
 			var jsonData struct {
-				Name        string   `json:"name"`
-				Content     string   `json:"content"`
-				CategoryIDs []string `json:"category_ids"`
+				Name            string   `json:"name"`
+				Content         string   `json:"content"`
+				CategoryIDs     []string `json:"category_ids"`
+				DuplicatePolicy string   `json:"duplicate_policy"`
 			}
 
 			if err := c.ShouldBindJSON(&jsonData); err == nil {
 				content = jsonData.Content
 				name = jsonData.Name
+				if jsonData.DuplicatePolicy != "" {
+					duplicatePolicy = jsonData.DuplicatePolicy
+				}
 
 				// Parse category IDs
 				var categoryIDs []uuid.UUID
@@ -65,39 +92,8 @@ func (h *Handlers) UploadDocument(c *gin.Context) {
 				}
 
 				// Create document from text content with categories
-				doc, err := h.documentService.CreateDocumentFromTextWithCategories(name, content, categoryIDs)
-				if err != nil {
-					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-					return
-				}
-
-				// Process document for vector search using semantic chunking
-				go func() {
-					defer func() {
-						if r := recover(); r != nil {
-							fmt.Printf("Panic in embedding process for document %s: %v\n", doc.Name, r)
-						}
-					}()
-
-					// Use semantic chunking by default
-					config := services.DefaultChunkConfig()
-					if err := h.vectorService.ChunkAndEmbedDocumentWithSemantics(doc, config); err != nil {
-						// Fallback to legacy chunking if semantic fails
-						fmt.Printf("Semantic chunking failed for document %s, falling back to legacy: %v\n", doc.Name, err)
-						if err := h.vectorService.ChunkAndEmbedDocument(doc); err != nil {
-							fmt.Printf("Error embedding document %s: %v\n", doc.Name, err)
-						} else {
-							fmt.Printf("Successfully embedded document %s with legacy chunking\n", doc.Name)
-						}
-					} else {
-						fmt.Printf("Successfully embedded document %s with semantic chunking\n", doc.Name)
-					}
-				}()
-
-				c.JSON(http.StatusCreated, gin.H{
-					"message":  "Document created successfully",
-					"document": doc,
-				})
+				result, err := h.documents(c).CreateDocumentFromTextWithCategories(name, content, categoryIDs, currentPrincipal(c).UserID, duplicatePolicy)
+				h.respondToUpload(c, result, err, "Document created successfully")
 				return
 			}
 		}
@@ -108,39 +104,8 @@ func (h *Handlers) UploadDocument(c *gin.Context) {
 		}
 
 		// Create document from text content
-		doc, err := h.documentService.CreateDocumentFromText(name, content)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-
-		// Process document for vector search using semantic chunking
-		go func() {
-			defer func() {
-				if r := recover(); r != nil {
-					fmt.Printf("Panic in embedding process for document %s: %v\n", doc.Name, r)
-				}
-			}()
-
-			// Use semantic chunking by default
-			config := services.DefaultChunkConfig()
-			if err := h.vectorService.ChunkAndEmbedDocumentWithSemantics(doc, config); err != nil {
-				// Fallback to legacy chunking if semantic fails
-				fmt.Printf("Semantic chunking failed for document %s, falling back to legacy: %v\n", doc.Name, err)
-				if err := h.vectorService.ChunkAndEmbedDocument(doc); err != nil {
-					fmt.Printf("Error embedding document %s: %v\n", doc.Name, err)
-				} else {
-					fmt.Printf("Successfully embedded document %s with legacy chunking\n", doc.Name)
-				}
-			} else {
-				fmt.Printf("Successfully embedded document %s with semantic chunking\n", doc.Name)
-			}
-		}()
-
-		c.JSON(http.StatusCreated, gin.H{
-			"message":  "Document created successfully",
-			"document": doc,
-		})
+		result, err := h.documents(c).CreateDocumentFromText(name, content, currentPrincipal(c).UserID, duplicatePolicy)
+		h.respondToUpload(c, result, err, "Document created successfully")
 		return
 	}
 
@@ -154,43 +119,72 @@ func (h *Handlers) UploadDocument(c *gin.Context) {
 	}
 
 	// Upload document from file with categories
-	doc, err := h.documentService.UploadDocumentWithCategories(file, categoryIDs)
+	result, err := h.documents(c).UploadDocumentWithCategories(file, categoryIDs, currentPrincipal(c).UserID, duplicatePolicy)
+	h.respondToUpload(c, result, err, "Document uploaded successfully")
+}
+
+// respondToUpload queues ingestion of a new or replaced document and reports the upload.
+// Rejected duplicates get 409 Conflict with the existing document, and files whose text
+// could not be extracted 422 Unprocessable Entity with the failed document.
+func (h *Handlers) respondToUpload(c *gin.Context, result *services.UploadResult, err error, createdMessage string) {
+	var duplicate *services.DuplicateDocumentError
+	if errors.As(err, &duplicate) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":    err.Error(),
+			"document": duplicate.Existing,
+		})
+		return
+	}
+	var extraction *services.ExtractionError
+	if errors.As(err, &extraction) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":    err.Error(),
+			"document": extraction.Document,
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Process document for vector search using semantic chunking
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				fmt.Printf("Panic in embedding process for document %s: %v\n", doc.Name, r)
-			}
-		}()
-
-		// Use semantic chunking by default
-		config := services.DefaultChunkConfig()
-		if err := h.vectorService.ChunkAndEmbedDocumentWithSemantics(doc, config); err != nil {
-			// Fallback to legacy chunking if semantic fails
-			fmt.Printf("Semantic chunking failed for document %s, falling back to legacy: %v\n", doc.Name, err)
-			if err := h.vectorService.ChunkAndEmbedDocument(doc); err != nil {
-				fmt.Printf("Error embedding document %s: %v\n", doc.Name, err)
-			} else {
-				fmt.Printf("Successfully embedded document %s with legacy chunking\n", doc.Name)
-			}
-		} else {
-			fmt.Printf("Successfully embedded document %s with semantic chunking\n", doc.Name)
-		}
-	}()
+	if result.Outcome == services.UploadOutcomeExisting {
+		c.JSON(http.StatusOK, gin.H{
+			"message":  "Identical document already exists",
+			"outcome":  result.Outcome,
+			"document": result.Document,
+		})
+		return
+	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message":  "Document uploaded successfully",
-		"document": doc,
+	// Queue document for vector search using semantic chunking
+	job, err := h.ingestion(c).Enqueue(result.Document.ID, models.IngestionStrategyAuto, services.DefaultChunkConfig())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	status, message := http.StatusCreated, createdMessage
+	if result.Outcome == services.UploadOutcomeNewVersion {
+		status, message = http.StatusOK, "Identical document replaced as a new version"
+	}
+
+	c.JSON(status, gin.H{
+		"message":  message,
+		"outcome":  result.Outcome,
+		"document": result.Document,
+		"job":      job,
 	})
 }
 
 func (h *Handlers) GetDocuments(c *gin.Context) {
-	docs, err := h.documentService.GetAllDocuments()
+	docs, err := h.documents(c).GetAllDocuments()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	docs, err = h.access(c).FilterAccessibleDocuments(docs, currentPrincipal(c).AccessSubject())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -207,7 +201,11 @@ func (h *Handlers) GetDocument(c *gin.Context) {
 		return
 	}
 
-	doc, err := h.documentService.GetDocument(id)
+	if !h.canReadDocument(c, id) {
+		return
+	}
+
+	doc, err := h.documents(c).GetDocument(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
 		return
@@ -216,6 +214,139 @@ func (h *Handlers) GetDocument(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"document": doc})
 }
 
+// GetDocumentStatus returns the ingestion status of one document
+func (h *Handlers) GetDocumentStatus(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		return
+	}
+
+	if !h.canReadDocument(c, id) {
+		return
+	}
+
+	h.respondDocumentStatuses(c, []uuid.UUID{id}, true)
+}
+
+// GetDocumentStatuses returns the ingestion status of a batch of documents given as ?ids=a,b,c,
+// leaving out the documents the caller cannot read
+func (h *Handlers) GetDocumentStatuses(c *gin.Context) {
+	var ids []uuid.UUID
+	for _, idStr := range strings.Split(c.Query("ids"), ",") {
+		idStr = strings.TrimSpace(idStr)
+		if idStr == "" {
+			continue
+		}
+		id, err := uuid.Parse(idStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID: " + idStr})
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	if len(ids) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'ids' is required"})
+		return
+	}
+
+	// Documents the caller may not read are left out as if they did not exist
+	docs := make([]models.Document, len(ids))
+	for i, id := range ids {
+		docs[i] = models.Document{ID: id}
+	}
+	docs, err := h.access(c).FilterAccessibleDocuments(docs, currentPrincipal(c).AccessSubject())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ids = ids[:0]
+	for _, doc := range docs {
+		ids = append(ids, doc.ID)
+	}
+
+	h.respondDocumentStatuses(c, ids, false)
+}
+
+// respondDocumentStatuses writes the statuses of the documents, see writeDocumentStatuses
+func (h *Handlers) respondDocumentStatuses(c *gin.Context, ids []uuid.UUID, single bool) {
+	documents := h.documents(c)
+	writeDocumentStatuses(c, func() ([]models.DocumentIngestionStatus, error) {
+		return documents.GetIngestionStatuses(ids)
+	}, single)
+}
+
+// documentStatusPollInterval is how often a status stream reloads the statuses
+var documentStatusPollInterval = time.Second
+
+// writeDocumentStatuses writes the statuses returned by load as JSON, or as Server-Sent Events
+// when ?stream=true. A stream emits a "status" event whenever a document changes and ends once
+// every document is ready or failed.
+func writeDocumentStatuses(c *gin.Context, load func() ([]models.DocumentIngestionStatus, error), single bool) {
+	statuses, err := load()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("stream") != "true" {
+		if single {
+			if len(statuses) == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"status": statuses[0]})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"statuses": statuses})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	ticker := time.NewTicker(documentStatusPollInterval)
+	defer ticker.Stop()
+
+	last := make(map[uuid.UUID]models.DocumentIngestionStatus)
+	for {
+		allFinal := true
+		for _, status := range statuses {
+			if previous, ok := last[status.DocumentID]; !ok || previous != status {
+				c.SSEvent("status", status)
+				last[status.DocumentID] = status
+			}
+			if !status.IsFinal() {
+				allFinal = false
+			}
+		}
+		c.Writer.Flush()
+
+		if allFinal {
+			c.SSEvent("done", gin.H{"documents": len(statuses)})
+			c.Writer.Flush()
+			return
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		if statuses, err = load(); err != nil {
+			c.SSEvent("error", gin.H{"error": err.Error()})
+			c.Writer.Flush()
+			return
+		}
+	}
+}
+
 func (h *Handlers) DeleteDocument(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := uuid.Parse(idStr)
@@ -224,7 +355,7 @@ func (h *Handlers) DeleteDocument(c *gin.Context) {
 		return
 	}
 
-	if err := h.documentService.DeleteDocument(id); err != nil {
+	if err := h.documents(c).DeleteDocument(id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -247,15 +378,59 @@ func (h *Handlers) SearchDocuments(c *gin.Context) {
 		limit = 10
 	}
 
-	chunks, err := h.vectorService.SearchSimilarChunks(query, limit)
+	mode := c.Query("mode")
+	if !services.IsValidSearchMode(mode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mode. Use vector, lexical or hybrid"})
+		return
+	}
+
+	var categoryID *uuid.UUID
+	if idStr := c.Query("category_id"); idStr != "" {
+		id, err := uuid.Parse(idStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+			return
+		}
+		categoryID = &id
+	}
+
+	var minScore *float64
+	if scoreStr := c.Query("min_score"); scoreStr != "" {
+		score, err := strconv.ParseFloat(scoreStr, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid min_score"})
+			return
+		}
+		minScore = &score
+	}
+
+	chunks, err := h.vectors(c).Search(services.SearchOptions{
+		Query:      query,
+		Limit:      limit,
+		CategoryID: categoryID,
+		Mode:       mode,
+		MinScore:   minScore,
+		Highlight:  c.DefaultQuery("highlight", "true") == "true",
+		Subject:    currentPrincipal(c).AccessSubject(),
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	if mode == "" {
+		mode = h.vectors(c).DefaultSearchMode()
+	}
+	if minScore == nil {
+		defaultScore := h.vectors(c).DefaultMinScore()
+		minScore = &defaultScore
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"query":   query,
-		"results": chunks,
+		"query":     query,
+		"mode":      mode,
+		"min_score": *minScore,
+		"results":   chunks,
 	})
 }
 
@@ -270,6 +445,7 @@ type CreateUserRequest struct {
 	Position   string `json:"position"`
 	EmployeeID string `json:"employee_id"`
 	StartDate  string `json:"start_date" binding:"required"` // Format: "2006-01-02"
+	Role       string `json:"role"`                          // admin, hr_agent or employee (default)
 }
 
 func (h *Handlers) CreateUser(c *gin.Context) {
@@ -286,7 +462,12 @@ func (h *Handlers) CreateUser(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userService.CreateUser(req.Email, req.Name, req.Department, req.Position, req.EmployeeID, startDate)
+	if req.Role != "" && !models.IsValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role. Use admin, hr_agent or employee"})
+		return
+	}
+
+	user, err := h.users(c).CreateUser(req.Email, req.Name, req.Role, req.Department, req.Position, req.EmployeeID, startDate)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -296,7 +477,7 @@ func (h *Handlers) CreateUser(c *gin.Context) {
 }
 
 func (h *Handlers) GetUsers(c *gin.Context) {
-	users, err := h.userService.GetAllUsers()
+	users, err := h.users(c).GetAllUsers()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -313,7 +494,12 @@ func (h *Handlers) GetUser(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userService.GetUser(id)
+	if !canAccessOwned(c, &id, PermissionManageUsers) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	user, err := h.users(c).GetUser(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
@@ -333,7 +519,7 @@ func (h *Handlers) GetUserByEmail(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userService.GetUserByEmail(email)
+	user, err := h.users(c).GetUserByEmail(email)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
@@ -346,10 +532,41 @@ func (h *Handlers) GetUserByEmail(c *gin.Context) {
 	})
 }
 
+type UpdateUserRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+func (h *Handlers) UpdateUserRole(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req UpdateUserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !models.IsValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role. Use admin, hr_agent or employee"})
+		return
+	}
+
+	user, err := h.users(c).UpdateUser(id, map[string]interface{}{"role": req.Role})
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
 type CreateSessionRequest struct {
 	Name       string     `json:"name" binding:"required"`
-	UserID     *uuid.UUID `json:"user_id,omitempty"`     // Optional user association
 	CategoryID *uuid.UUID `json:"category_id,omitempty"` // Optional category filter
+	SearchMode string     `json:"search_mode,omitempty"` // Optional retrieval mode: vector, lexical, hybrid
 }
 
 func (h *Handlers) CreateChatSession(c *gin.Context) {
@@ -359,7 +576,20 @@ func (h *Handlers) CreateChatSession(c *gin.Context) {
 		return
 	}
 
-	session, err := h.chatService.CreateSessionWithCategory(req.Name, req.UserID, req.CategoryID)
+	if !services.IsValidSearchMode(req.SearchMode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid search_mode. Use vector, lexical or hybrid"})
+		return
+	}
+
+	// The session belongs to the authenticated caller, never to a user named in the body.
+	// Callers without a user record could not reach an unowned session again.
+	principal := currentPrincipal(c)
+	if principal.UserID == nil && !hasPermission(principal, PermissionViewAllSessions) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your credentials are not linked to a user"})
+		return
+	}
+
+	session, err := h.chat(c).CreateSessionWithSettings(req.Name, currentPrincipal(c).UserID, req.CategoryID, req.SearchMode)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -369,7 +599,18 @@ func (h *Handlers) CreateChatSession(c *gin.Context) {
 }
 
 func (h *Handlers) GetChatSessions(c *gin.Context) {
-	sessions, err := h.chatService.GetAllSessions()
+	principal := currentPrincipal(c)
+
+	var sessions []models.ChatSession
+	var err error
+	switch {
+	case hasPermission(principal, PermissionViewAllSessions):
+		sessions, err = h.chat(c).GetAllSessions()
+	case principal.UserID != nil:
+		sessions, err = h.chat(c).GetUserSessions(*principal.UserID)
+	default:
+		sessions = []models.ChatSession{}
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -386,13 +627,12 @@ func (h *Handlers) GetChatSession(c *gin.Context) {
 		return
 	}
 
-	session, err := h.chatService.GetSession(id)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+	session, ok := h.readableSession(c, id)
+	if !ok {
 		return
 	}
 
-	messages, err := h.chatService.GetSessionMessages(id)
+	messages, err := h.chat(c).GetSessionMessages(id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -412,7 +652,11 @@ func (h *Handlers) DeleteChatSession(c *gin.Context) {
 		return
 	}
 
-	if err := h.chatService.DeleteSession(id); err != nil {
+	if _, ok := h.authorizedSession(c, id, PermissionManageSessions); !ok {
+		return
+	}
+
+	if err := h.chat(c).DeleteSession(id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -438,7 +682,15 @@ func (h *Handlers) SendMessage(c *gin.Context) {
 		return
 	}
 
-	response, err := h.chatService.SendMessageWithResponse(sessionID, req.Message)
+	if _, ok := h.authorizedSession(c, sessionID, PermissionManageSessions); !ok {
+		return
+	}
+
+	response, err := h.chat(c).SendMessageWithResponse(sessionID, req.Message)
+	if errors.Is(err, services.ErrCircuitOpen) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -447,6 +699,46 @@ func (h *Handlers) SendMessage(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"response": response})
 }
 
+// SendMessageStream answers like SendMessage but streams the reply as Server-Sent Events
+func (h *Handlers) SendMessageStream(c *gin.Context) {
+	idStr := c.Param("id")
+	sessionID, err := uuid.Parse(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	var req SendMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, ok := h.authorizedSession(c, sessionID, PermissionManageSessions); !ok {
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	// Keep generating after a client disconnect so the assistant message is still saved
+	emit := func(event string, data interface{}) error {
+		if c.Request.Context().Err() != nil {
+			return nil
+		}
+		c.SSEvent(event, data)
+		c.Writer.Flush()
+		return nil
+	}
+
+	if _, err := h.chat(c).SendMessageStream(sessionID, req.Message, emit); err != nil {
+		emit("error", gin.H{"error": err.Error()})
+	}
+}
+
 // Ticket handlers
 
 type CreateTicketRequest struct {
@@ -469,12 +761,17 @@ func (h *Handlers) CreateTicket(c *gin.Context) {
 		return
 	}
 
+	// Tickets can only be raised from the caller's own sessions
+	if _, ok := h.authorizedSession(c, sessionID, PermissionManageSessions); !ok {
+		return
+	}
+
 	// Default category if not provided
 	if req.Category == "" {
 		req.Category = "general"
 	}
 
-	ticket, err := h.ticketService.CreateTicket(sessionID, nil, req.Question, req.Category, req.Description)
+	ticket, err := h.tickets(c).CreateTicket(sessionID, currentPrincipal(c).UserID, req.Question, req.Category, req.Description)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -494,7 +791,18 @@ func (h *Handlers) GetTickets(c *gin.Context) {
 	limit, _ := strconv.Atoi(limitStr)
 	offset, _ := strconv.Atoi(offsetStr)
 
-	tickets, err := h.ticketService.GetAllTickets(limit, offset, status)
+	principal := currentPrincipal(c)
+
+	var tickets []models.HRTicket
+	var err error
+	switch {
+	case hasPermission(principal, PermissionManageTickets):
+		tickets, err = h.tickets(c).GetAllTickets(limit, offset, status)
+	case principal.UserID != nil:
+		tickets, err = h.tickets(c).GetUserTicketsPage(*principal.UserID, limit, offset, status)
+	default:
+		tickets = []models.HRTicket{}
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -511,8 +819,8 @@ func (h *Handlers) GetTicket(c *gin.Context) {
 		return
 	}
 
-	ticket, err := h.ticketService.GetTicket(id)
-	if err != nil {
+	ticket, err := h.tickets(c).GetTicket(id)
+	if err != nil || !canAccessOwned(c, ticket.UserID, PermissionManageTickets) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
 		return
 	}
@@ -538,7 +846,7 @@ func (h *Handlers) UpdateTicketStatus(c *gin.Context) {
 		return
 	}
 
-	if err := h.ticketService.UpdateTicketStatus(id, req.Status); err != nil {
+	if err := h.tickets(c).UpdateTicketStatus(id, req.Status); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -566,166 +874,297 @@ func (h *Handlers) UpdateDocument(c *gin.Context) {
 		return
 	}
 
-	// Update document content
-	if err := h.documentService.UpdateDocument(id, req.Content); err != nil {
+	// Update document content, keeping the previous version
+	version, err := h.documents(c).UpdateDocument(id, req.Content, currentPrincipal(c).UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Get updated document
-	doc, err := h.documentService.GetDocument(id)
+	doc, err := h.documents(c).GetDocument(id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get updated document"})
 		return
 	}
 
-	// Re-embed the updated document
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				fmt.Printf("Panic in re-embedding process for document %s: %v\n", doc.Name, r)
-			}
-		}()
-
-		// Delete old chunks first
-		if err := h.vectorService.DeleteDocumentChunks(doc.ID); err != nil {
-			fmt.Printf("Error deleting old chunks for document %s: %v\n", doc.Name, err)
-		} else {
-			fmt.Printf("Deleted old chunks for document %s\n", doc.Name)
-		}
-
-		// Create new chunks and embeddings using semantic chunking
-		config := services.DefaultChunkConfig()
-		if err := h.vectorService.ChunkAndEmbedDocumentWithSemantics(doc, config); err != nil {
-			// Fallback to legacy chunking if semantic fails
-			fmt.Printf("Semantic chunking failed for document %s, falling back to legacy: %v\n", doc.Name, err)
-			if err := h.vectorService.ChunkAndEmbedDocument(doc); err != nil {
-				fmt.Printf("Error re-embedding document %s: %v\n", doc.Name, err)
-			} else {
-				fmt.Printf("Successfully re-embedded document %s with legacy chunking\n", doc.Name)
-			}
-		} else {
-			fmt.Printf("Successfully re-embedded document %s with semantic chunking\n", doc.Name)
-		}
-	}()
+	// Queue re-embedding of the updated document
+	job, err := h.ingestion(c).Enqueue(doc.ID, models.IngestionStrategyAuto, services.DefaultChunkConfig())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":  "Document updated and re-embedding started",
+		"message":  "Document updated and re-embedding queued",
 		"document": doc,
+		"version":  version.Version,
+		"job":      job,
 	})
 }
 
-func (h *Handlers) ReembedDocument(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := uuid.Parse(idStr)
+// DownloadDocumentFile streams the original uploaded file. PDFs and images are shown inline
+// unless ?download=true is passed, everything else is always downloaded so uploaded HTML
+// cannot run scripts on the API's origin.
+func (h *Handlers) DownloadDocumentFile(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
 		return
 	}
 
-	// Get document
-	doc, err := h.documentService.GetDocument(id)
+	if !h.canReadDocument(c, id) {
+		return
+	}
+
+	doc, err := h.documents(c).GetDocument(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
 		return
 	}
 
-	// Re-embed the document
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				fmt.Printf("Panic in re-embedding process for document %s: %v\n", doc.Name, r)
-			}
-		}()
-
-		// Delete old chunks first
-		if err := h.vectorService.DeleteDocumentChunks(doc.ID); err != nil {
-			fmt.Printf("Error deleting old chunks for document %s: %v\n", doc.Name, err)
-		} else {
-			fmt.Printf("Deleted old chunks for document %s\n", doc.Name)
-		}
+	file, size, err := h.documents(c).OpenDocumentFile(doc)
+	if errors.Is(err, services.ErrBlobNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "The original file of this document is not available"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
 
-		// Create new chunks and embeddings using semantic chunking
-		config := services.DefaultChunkConfig()
-		if err := h.vectorService.ChunkAndEmbedDocumentWithSemantics(doc, config); err != nil {
-			// Fallback to legacy chunking if semantic fails
-			fmt.Printf("Semantic chunking failed for document %s, falling back to legacy: %v\n", doc.Name, err)
-			if err := h.vectorService.ChunkAndEmbedDocument(doc); err != nil {
-				fmt.Printf("Error re-embedding document %s: %v\n", doc.Name, err)
-			} else {
-				fmt.Printf("Successfully re-embedded document %s with legacy chunking\n", doc.Name)
-			}
-		} else {
-			fmt.Printf("Successfully re-embedded document %s with semantic chunking\n", doc.Name)
-		}
-	}()
+	disposition := "attachment"
+	if c.Query("download") != "true" && isInlineContentType(doc.ContentType) {
+		disposition = "inline"
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":  "Document re-embedding started",
-		"document": doc,
+	c.DataFromReader(http.StatusOK, size, doc.ContentType, file, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType(disposition, map[string]string{"filename": doc.Name}),
+		"X-Content-Type-Options": "nosniff",
 	})
 }
 
-// Semantic chunking endpoint
-type SemanticChunkingRequest struct {
-	DocumentID string                `json:"document_id" binding:"required"`
-	Config     *services.ChunkConfig `json:"config,omitempty"`
+// isInlineContentType reports whether a browser can display the content type without running
+// scripts. SVG images can embed scripts and are downloaded like HTML.
+func isInlineContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/pdf" || (strings.HasPrefix(mediaType, "image/") && mediaType != "image/svg+xml")
 }
 
-func (h *Handlers) ReembedWithSemanticChunking(c *gin.Context) {
-	var req SemanticChunkingRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
+// Document version handlers
 
-	// Parse document ID
-	docID, err := uuid.Parse(req.DocumentID)
+func (h *Handlers) GetDocumentVersions(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
 		return
 	}
 
-	// Get document
-	doc, err := h.documentService.GetDocument(docID)
+	if !h.canReadDocument(c, id) {
+		return
+	}
+
+	versions, err := h.documents(c).GetDocumentVersions(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Use provided config or default
-	config := req.Config
-	if config == nil {
-		config = services.DefaultChunkConfig()
+	c.JSON(http.StatusOK, gin.H{"versions": versions})
+}
+
+func (h *Handlers) GetDocumentVersion(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		return
 	}
 
-	// Re-embed with semantic chunking
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				fmt.Printf("Panic in semantic re-embedding process for document %s: %v\n", doc.Name, r)
-			}
-		}()
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return
+	}
+
+	if !h.canReadDocument(c, id) {
+		return
+	}
+
+	documentVersion, err := h.documents(c).GetDocumentVersion(id, version)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, documentVersion)
+}
 
-		// Delete old chunks first
-		if err := h.vectorService.DeleteDocumentChunks(doc.ID); err != nil {
-			fmt.Printf("Error deleting old chunks for document %s: %v\n", doc.Name, err)
-		} else {
-			fmt.Printf("Deleted old chunks for document %s\n", doc.Name)
+func (h *Handlers) DiffDocumentVersions(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		return
+	}
+
+	from, err := strconv.Atoi(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a version number"})
+		return
+	}
+	to, err := strconv.Atoi(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a version number"})
+		return
+	}
+
+	if !h.canReadDocument(c, id) {
+		return
+	}
+
+	diff, err := h.documents(c).DiffDocumentVersions(id, from, to)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+			return
 		}
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
 
-		// Create new chunks and embeddings using semantic chunking
-		if err := h.vectorService.ChunkAndEmbedDocumentWithSemantics(doc, config); err != nil {
-			fmt.Printf("Error semantic re-embedding document %s: %v\n", doc.Name, err)
-		} else {
-			fmt.Printf("Successfully semantic re-embedded document %s\n", doc.Name)
+	c.JSON(http.StatusOK, diff)
+}
+
+func (h *Handlers) RollbackDocument(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		return
+	}
+
+	targetVersion, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return
+	}
+
+	// Rolling back appends the old content as a new version, so history is never lost
+	version, err := h.documents(c).RollbackDocument(id, targetVersion, currentPrincipal(c).UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+			return
 		}
-	}()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	doc, err := h.documents(c).GetDocument(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get restored document"})
+		return
+	}
+
+	// Queue re-embedding of the restored content
+	job, err := h.ingestion(c).Enqueue(doc.ID, models.IngestionStrategyAuto, services.DefaultChunkConfig())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  fmt.Sprintf("Document rolled back to version %d and re-embedding queued", targetVersion),
+		"document": doc,
+		"version":  version.Version,
+		"job":      job,
+	})
+}
+
+func (h *Handlers) ReembedDocument(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		return
+	}
+
+	// Get document
+	doc, err := h.documents(c).GetDocument(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return
+	}
+
+	// Queue re-embedding of the document
+	job, err := h.ingestion(c).Enqueue(doc.ID, models.IngestionStrategyAuto, services.DefaultChunkConfig())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":  "Document semantic re-embedding started",
+		"message":  "Document re-embedding queued",
+		"document": doc,
+		"job":      job,
+	})
+}
+
+// Semantic chunking endpoint
+type SemanticChunkingRequest struct {
+	DocumentID string                `json:"document_id" binding:"required"`
+	Config     *services.ChunkConfig `json:"config,omitempty"`
+}
+
+func (h *Handlers) ReembedWithSemanticChunking(c *gin.Context) {
+	var req SemanticChunkingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Parse document ID
+	docID, err := uuid.Parse(req.DocumentID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		return
+	}
+
+	// Get document
+	doc, err := h.documents(c).GetDocument(docID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return
+	}
+
+	// Use provided config or default
+	config := req.Config
+	if config == nil {
+		config = services.DefaultChunkConfig()
+	}
+	if err := config.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Queue re-embedding with semantic chunking
+	job, err := h.ingestion(c).Enqueue(doc.ID, models.IngestionStrategySemantic, config)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Document semantic re-embedding queued",
 		"document": doc,
 		"config":   config,
+		"job":      job,
 	})
 }
 
@@ -742,7 +1181,7 @@ func (h *Handlers) CreateCategory(c *gin.Context) {
 		return
 	}
 
-	category, err := h.categoryService.CreateCategory(req.Name, req.Description)
+	category, err := h.categories(c).CreateCategory(req.Name, req.Description)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -753,7 +1192,7 @@ func (h *Handlers) CreateCategory(c *gin.Context) {
 
 func (h *Handlers) GetCategories(c *gin.Context) {
 
-	categories, err := h.categoryService.GetAllCategories()
+	categories, err := h.categories(c).GetAllCategories()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -770,7 +1209,7 @@ func (h *Handlers) GetCategory(c *gin.Context) {
 		return
 	}
 
-	category, err := h.categoryService.GetCategory(id)
+	category, err := h.categories(c).GetCategory(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
 		return
@@ -797,7 +1236,7 @@ func (h *Handlers) UpdateCategory(c *gin.Context) {
 		return
 	}
 
-	category, err := h.categoryService.UpdateCategory(id, req.Name, req.Description)
+	category, err := h.categories(c).UpdateCategory(id, req.Name, req.Description)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -814,7 +1253,7 @@ func (h *Handlers) DeleteCategory(c *gin.Context) {
 		return
 	}
 
-	if err := h.categoryService.DeleteCategory(id); err != nil {
+	if err := h.categories(c).DeleteCategory(id); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -830,7 +1269,13 @@ func (h *Handlers) GetDocumentsByCategory(c *gin.Context) {
 		return
 	}
 
-	documents, err := h.documentService.GetDocumentsByCategory(id)
+	documents, err := h.documents(c).GetDocumentsByCategory(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	documents, err = h.access(c).FilterAccessibleDocuments(documents, currentPrincipal(c).AccessSubject())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -864,7 +1309,7 @@ func (h *Handlers) UpdateDocumentCategories(c *gin.Context) {
 		}
 	}
 
-	if err := h.documentService.AssignCategoriesToDocument(documentID, categoryIDs); err != nil {
+	if err := h.documents(c).AssignCategoriesToDocument(documentID, categoryIDs); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -880,7 +1325,11 @@ func (h *Handlers) GetDocumentCategories(c *gin.Context) {
 		return
 	}
 
-	categories, err := h.documentService.GetDocumentCategories(documentID)
+	if !h.canReadDocument(c, documentID) {
+		return
+	}
+
+	categories, err := h.documents(c).GetDocumentCategories(documentID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -889,6 +1338,148 @@ func (h *Handlers) GetDocumentCategories(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"categories": categories})
 }
 
+// Access rule handlers
+
+type SetAccessRulesRequest struct {
+	Rules []struct {
+		Role       string     `json:"role,omitempty"`
+		Department string     `json:"department,omitempty"`
+		UserID     *uuid.UUID `json:"user_id,omitempty"`
+	} `json:"rules"` // Empty list removes every restriction
+}
+
+func (h *Handlers) GetCategoryAccessRules(c *gin.Context) {
+	h.getAccessRules(c, models.AccessResourceCategory)
+}
+
+func (h *Handlers) SetCategoryAccessRules(c *gin.Context) {
+	h.setAccessRules(c, models.AccessResourceCategory)
+}
+
+func (h *Handlers) GetDocumentAccessRules(c *gin.Context) {
+	h.getAccessRules(c, models.AccessResourceDocument)
+}
+
+func (h *Handlers) SetDocumentAccessRules(c *gin.Context) {
+	h.setAccessRules(c, models.AccessResourceDocument)
+}
+
+func (h *Handlers) getAccessRules(c *gin.Context, resourceType string) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	rules, err := h.access(c).GetAccessRules(resourceType, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+func (h *Handlers) setAccessRules(c *gin.Context, resourceType string) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var req SetAccessRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Make sure the resource exists before attaching rules to it
+	if resourceType == models.AccessResourceCategory {
+		_, err = h.categories(c).GetCategory(id)
+	} else {
+		_, err = h.documents(c).GetDocument(id)
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Resource not found"})
+		return
+	}
+
+	rules := make([]models.AccessRule, len(req.Rules))
+	for i, rule := range req.Rules {
+		rules[i] = models.AccessRule{Role: rule.Role, Department: rule.Department, UserID: rule.UserID}
+	}
+
+	rules, err = h.access(c).SetAccessRules(resourceType, id, rules)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+// Ingestion job handlers
+
+func (h *Handlers) GetIngestionJobs(c *gin.Context) {
+	limitStr := c.DefaultQuery("limit", "50")
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+
+	var documentID *uuid.UUID
+	if idStr := c.Query("document_id"); idStr != "" {
+		id, err := uuid.Parse(idStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+			return
+		}
+		documentID = &id
+	}
+
+	jobs, err := h.ingestion(c).GetJobs(c.Query("status"), documentID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs})
+}
+
+func (h *Handlers) GetIngestionJob(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	job, err := h.ingestion(c).GetJob(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": job})
+}
+
+func (h *Handlers) RetryIngestionJob(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	job, err := h.ingestion(c).RetryJob(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": job})
+}
+
 // Health check
 
 func (h *Handlers) HealthCheck(c *gin.Context) {
@@ -897,3 +1488,317 @@ func (h *Handlers) HealthCheck(c *gin.Context) {
 		"service": "company-ai-training",
 	})
 }
+
+// Auth handlers
+
+func (h *Handlers) GetCurrentPrincipal(c *gin.Context) {
+	principal := currentPrincipal(c)
+
+	response := gin.H{"principal": principal}
+	if principal.UserID != nil {
+		if user, err := h.users(c).GetUser(*principal.UserID); err == nil {
+			response["user"] = user
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	UserID    *uuid.UUID `json:"user_id,omitempty"`    // Issue the key for another user, requires users:manage
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // Optional expiry
+}
+
+func (h *Handlers) CreateAPIKey(c *gin.Context) {
+	if h.authService == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Authentication is disabled"})
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Keys act as the caller unless a user manager issues one for somebody else
+	principal := currentPrincipal(c)
+	userID := principal.UserID
+	if req.UserID != nil && !principal.IsUser(req.UserID) {
+		if !hasPermission(principal, PermissionManageUsers) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to perform this action"})
+			return
+		}
+		if _, err := h.users(c).GetUser(*req.UserID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "User not found"})
+			return
+		}
+		userID = req.UserID
+	}
+	if userID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+
+	rawKey, key, err := h.authService.CreateAPIKey(req.Name, currentTenant(c).Tenant.ID, userID, req.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"api_key": key,
+		"key":     rawKey,
+		"message": "Store this key now, it cannot be retrieved again",
+	})
+}
+
+func (h *Handlers) GetAPIKeys(c *gin.Context) {
+	if h.authService == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Authentication is disabled"})
+		return
+	}
+
+	principal := currentPrincipal(c)
+	if principal.UserID == nil {
+		c.JSON(http.StatusOK, gin.H{"api_keys": []models.APIKey{}})
+		return
+	}
+
+	keys, err := h.authService.GetAPIKeys(*principal.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+func (h *Handlers) RevokeAPIKey(c *gin.Context) {
+	if h.authService == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Authentication is disabled"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	principal := currentPrincipal(c)
+	if principal.UserID == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	if err := h.authService.RevokeAPIKey(id, *principal.UserID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
+
+// Tenant handlers
+
+type CreateTenantRequest struct {
+	Slug         string `json:"slug" binding:"required"`
+	Name         string `json:"name" binding:"required"`
+	GeminiAPIKey string `json:"gemini_api_key"` // Optional, the server's key is used when empty
+	SystemPrompt string `json:"system_prompt"`  // Optional, replaces the default assistant instructions
+}
+
+type UpdateTenantRequest struct {
+	Name         *string `json:"name"`
+	GeminiAPIKey *string `json:"gemini_api_key"` // Empty string falls back to the server's key
+	SystemPrompt *string `json:"system_prompt"`  // Empty string restores the default instructions
+}
+
+func (h *Handlers) CreateTenant(c *gin.Context) {
+	var req CreateTenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenant, err := h.tenantService.CreateTenant(req.Slug, req.Name, req.GeminiAPIKey, req.SystemPrompt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, tenant)
+}
+
+func (h *Handlers) GetTenants(c *gin.Context) {
+	tenants, err := h.tenantService.GetAllTenants()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tenants": tenants})
+}
+
+func (h *Handlers) GetTenant(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tenant ID"})
+		return
+	}
+
+	tenant, err := h.tenantService.GetTenant(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tenant)
+}
+
+func (h *Handlers) UpdateTenant(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tenant ID"})
+		return
+	}
+
+	var req UpdateTenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.GeminiAPIKey != nil {
+		updates["gemini_api_key"] = *req.GeminiAPIKey
+	}
+	if req.SystemPrompt != nil {
+		updates["system_prompt"] = *req.SystemPrompt
+	}
+
+	tenant, err := h.tenantService.UpdateTenant(id, updates)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tenant)
+}
+
+// Embedding cache handlers
+
+func (h *Handlers) GetEmbeddingCacheStats(c *gin.Context) {
+	stats, err := h.embeddingCache.Stats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var entries, hits int64
+	for _, model := range stats {
+		entries += model.Entries
+		hits += model.Hits
+	}
+
+	c.JSON(http.StatusOK, gin.H{"models": stats, "entries": entries, "hits": hits})
+}
+
+// PurgeEmbeddingCache deletes cached vectors, optionally only those of one model or
+// not used for the given duration
+func (h *Handlers) PurgeEmbeddingCache(c *gin.Context) {
+	filter := services.EmbeddingCachePurge{Model: c.Query("model")}
+
+	if dimensionStr := c.Query("dimension"); dimensionStr != "" {
+		dimension, err := strconv.Atoi(dimensionStr)
+		if err != nil || dimension <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dimension"})
+			return
+		}
+		filter.Dimension = dimension
+	}
+	if unusedFor := c.Query("unused_for"); unusedFor != "" {
+		duration, err := time.ParseDuration(unusedFor)
+		if err != nil || duration <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid unused_for, expected a duration such as 720h"})
+			return
+		}
+		unusedBefore := time.Now().Add(-duration)
+		filter.UnusedBefore = &unusedBefore
+	}
+
+	deleted, err := h.embeddingCache.Purge(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deleted": deleted})
+}
+
+// Vector index handlers
+
+// GetVectorIndexStatus reports the vector index size and its recall against exact scans
+// over randomly sampled chunks, optionally of a single ?tenant_id=
+func (h *Handlers) GetVectorIndexStatus(c *gin.Context) {
+	queries, err := strconv.Atoi(c.DefaultQuery("recall_queries", "20"))
+	if err != nil || queries < 0 || queries > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "recall_queries must be between 0 and 200"})
+		return
+	}
+	k, err := strconv.Atoi(c.DefaultQuery("k", "10"))
+	if err != nil || k <= 0 || k > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "k must be between 1 and 100"})
+		return
+	}
+
+	var tenantID *uuid.UUID
+	if idStr := c.Query("tenant_id"); idStr != "" {
+		id, err := uuid.Parse(idStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tenant ID"})
+			return
+		}
+		tenantID = &id
+	}
+
+	status, err := h.vectorIndex.Status()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{"index": status}
+	if queries > 0 {
+		recall, err := h.vectorIndex.MeasureRecall(queries, k, tenantID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		response["recall"] = recall
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// RebuildVectorIndex recreates the vector index from the current chunks. Writes to
+// document_chunks wait until it is built.
+func (h *Handlers) RebuildVectorIndex(c *gin.Context) {
+	if err := h.vectorIndex.Rebuild(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	status, err := h.vectorIndex.Status()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"index": status})
+}
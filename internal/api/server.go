@@ -8,11 +8,13 @@ import (
 )
 
 type Server struct {
-	router   *gin.Engine
-	handlers *Handlers
+	router        *gin.Engine
+	handlers      *Handlers
+	authService   *services.AuthService
+	tenantService *services.TenantService
 }
 
-func NewServer(docService *services.DocumentService, vecService *services.VectorService, chatService *services.ChatService, userService *services.UserService, ticketService *services.TicketService, categoryService *services.CategoryService) *Server {
+func NewServer(docService *services.DocumentService, vecService *services.VectorService, chatService *services.ChatService, userService *services.UserService, ticketService *services.TicketService, categoryService *services.CategoryService, ingestionService *services.IngestionService, accessService *services.AccessControlService, authService *services.AuthService, tenantService *services.TenantService, embeddingCache *services.EmbeddingCache, vectorIndexService *services.VectorIndexService, allowedOrigins []string) *Server {
 	// Set Gin mode
 	gin.SetMode(gin.ReleaseMode)
 
@@ -20,9 +22,9 @@ func NewServer(docService *services.DocumentService, vecService *services.Vector
 
 	// CORS middleware - must be first, before any other middleware
 	config := cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000", "http://127.0.0.1:3000", "http://0.0.0.0:3000", "http://10.67.21.180:3000", "http://192.168.1.100:3000", "*"},
+		AllowOrigins:     allowedOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "HEAD", "PATCH"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With", "Access-Control-Request-Method", "Access-Control-Request-Headers", "X-API-Key", "X-Tenant"},
 		AllowCredentials: false,
 		ExposeHeaders:    []string{"Content-Length", "Access-Control-Allow-Origin", "Access-Control-Allow-Methods", "Access-Control-Allow-Headers"},
 		MaxAge:           86400,
@@ -34,11 +36,13 @@ func NewServer(docService *services.DocumentService, vecService *services.Vector
 	router.Use(gin.Recovery())
 
 	// Initialize handlers
-	handlers := NewHandlers(docService, vecService, chatService, userService, ticketService, categoryService)
+	handlers := NewHandlers(docService, vecService, chatService, userService, ticketService, categoryService, ingestionService, accessService, authService, tenantService, embeddingCache, vectorIndexService)
 
 	server := &Server{
-		router:   router,
-		handlers: handlers,
+		router:        router,
+		handlers:      handlers,
+		authService:   authService,
+		tenantService: tenantService,
 	}
 
 	server.setupRoutes()
@@ -46,24 +50,66 @@ func NewServer(docService *services.DocumentService, vecService *services.Vector
 }
 
 func (s *Server) setupRoutes() {
-	api := s.router.Group("/api/v1")
+	public := s.router.Group("/api/v1")
 
 	// Health check
-	api.GET("/health", s.handlers.HealthCheck)
+	public.GET("/health", s.handlers.HealthCheck)
+
+	// Everything else requires an authenticated caller and is scoped to their tenant
+	api := public.Group("")
+	api.Use(AuthMiddleware(s.authService, s.tenantService), TenantMiddleware(s.tenantService))
+
+	// Auth routes
+	auth := api.Group("/auth")
+	{
+		auth.GET("/me", s.handlers.GetCurrentPrincipal)
+		auth.POST("/api-keys", s.handlers.CreateAPIKey)
+		auth.GET("/api-keys", s.handlers.GetAPIKeys)
+		auth.DELETE("/api-keys/:id", s.handlers.RevokeAPIKey)
+	}
+
+	// Tenant routes, for admins of the default tenant only
+	tenants := api.Group("/tenants", RequirePlatformAdmin())
+	{
+		tenants.POST("", s.handlers.CreateTenant)
+		tenants.GET("", s.handlers.GetTenants)
+		tenants.GET("/:id", s.handlers.GetTenant)
+		tenants.PUT("/:id", s.handlers.UpdateTenant)
+	}
+
+	// Platform maintenance routes, for admins of the default tenant only
+	admin := api.Group("/admin", RequirePlatformAdmin())
+	{
+		admin.GET("/embedding-cache", s.handlers.GetEmbeddingCacheStats)
+		admin.DELETE("/embedding-cache", s.handlers.PurgeEmbeddingCache) // ?model=&dimension=&unused_for=720h
+		admin.GET("/vector-index", s.handlers.GetVectorIndexStatus)      // ?recall_queries=20&k=10
+		admin.POST("/vector-index/rebuild", s.handlers.RebuildVectorIndex)
+	}
+
+	manageDocuments := RequirePermission(PermissionManageDocuments)
 
 	// Document routes
 	documents := api.Group("/documents")
 	{
-		documents.POST("/upload", s.handlers.UploadDocument)
+		documents.POST("/upload", manageDocuments, s.handlers.UploadDocument)
 		documents.GET("/", s.handlers.GetDocuments)
 		documents.GET("", s.handlers.GetDocuments) // Add route without trailing slash
+		documents.GET("/status", s.handlers.GetDocumentStatuses)
 		documents.GET("/:id", s.handlers.GetDocument)
-		documents.PUT("/:id", s.handlers.UpdateDocument)
-		documents.DELETE("/:id", s.handlers.DeleteDocument)
-		documents.POST("/:id/reembed", s.handlers.ReembedDocument)
-		documents.POST("/semantic-reembed", s.handlers.ReembedWithSemanticChunking)
-		documents.PUT("/:id/categories", s.handlers.UpdateDocumentCategories)
+		documents.GET("/:id/status", s.handlers.GetDocumentStatus)
+		documents.GET("/:id/file", s.handlers.DownloadDocumentFile)
+		documents.PUT("/:id", manageDocuments, s.handlers.UpdateDocument)
+		documents.DELETE("/:id", manageDocuments, s.handlers.DeleteDocument)
+		documents.GET("/:id/versions", s.handlers.GetDocumentVersions)
+		documents.GET("/:id/versions/:version", s.handlers.GetDocumentVersion)
+		documents.POST("/:id/versions/:version/rollback", manageDocuments, s.handlers.RollbackDocument)
+		documents.GET("/:id/diff", s.handlers.DiffDocumentVersions) // ?from=1&to=2
+		documents.POST("/:id/reembed", manageDocuments, s.handlers.ReembedDocument)
+		documents.POST("/semantic-reembed", manageDocuments, s.handlers.ReembedWithSemanticChunking)
+		documents.PUT("/:id/categories", manageDocuments, s.handlers.UpdateDocumentCategories)
 		documents.GET("/:id/categories", s.handlers.GetDocumentCategories)
+		documents.GET("/:id/access", manageDocuments, s.handlers.GetDocumentAccessRules)
+		documents.PUT("/:id/access", manageDocuments, s.handlers.SetDocumentAccessRules)
 	}
 
 	// Search routes
@@ -75,13 +121,14 @@ func (s *Server) setupRoutes() {
 	// User routes
 	users := api.Group("/users")
 	{
-		users.POST("/", s.handlers.CreateUser)
-		users.GET("/", s.handlers.GetUsers)
-		users.GET("/:id", s.handlers.GetUser)
-		users.GET("/by-email", s.handlers.GetUserByEmail)
+		users.POST("/", RequirePermission(PermissionManageUsers), s.handlers.CreateUser)
+		users.GET("/", RequirePermission(PermissionManageUsers), s.handlers.GetUsers)
+		users.GET("/:id", s.handlers.GetUser) // Own profile, or any with users:manage
+		users.PUT("/:id/role", RequirePermission(PermissionManageUsers), s.handlers.UpdateUserRole)
+		users.GET("/by-email", RequirePermission(PermissionManageUsers), s.handlers.GetUserByEmail)
 	}
 
-	// Chat routes
+	// Chat routes, scoped to the caller's own sessions in the handlers
 	chat := api.Group("/chat")
 	{
 		chat.POST("/sessions", s.handlers.CreateChatSession)
@@ -89,26 +136,37 @@ func (s *Server) setupRoutes() {
 		chat.GET("/sessions/:id", s.handlers.GetChatSession)
 		chat.DELETE("/sessions/:id", s.handlers.DeleteChatSession)
 		chat.POST("/sessions/:id/messages", s.handlers.SendMessage)
+		chat.POST("/sessions/:id/messages/stream", s.handlers.SendMessageStream)
 	}
 
 	// Category routes
 	categories := api.Group("/categories")
 	{
-		categories.POST("", s.handlers.CreateCategory)
+		categories.POST("", RequirePermission(PermissionManageCategories), s.handlers.CreateCategory)
 		categories.GET("", s.handlers.GetCategories)
 		categories.GET("/:id", s.handlers.GetCategory)
-		categories.PUT("/:id", s.handlers.UpdateCategory)
-		categories.DELETE("/:id", s.handlers.DeleteCategory)
+		categories.PUT("/:id", RequirePermission(PermissionManageCategories), s.handlers.UpdateCategory)
+		categories.DELETE("/:id", RequirePermission(PermissionManageCategories), s.handlers.DeleteCategory)
 		categories.GET("/:id/documents", s.handlers.GetDocumentsByCategory)
+		categories.GET("/:id/access", RequirePermission(PermissionManageCategories), s.handlers.GetCategoryAccessRules)
+		categories.PUT("/:id/access", RequirePermission(PermissionManageCategories), s.handlers.SetCategoryAccessRules)
+	}
+
+	// Ingestion job routes
+	ingestion := api.Group("/ingestion", manageDocuments)
+	{
+		ingestion.GET("/jobs", s.handlers.GetIngestionJobs)
+		ingestion.GET("/jobs/:id", s.handlers.GetIngestionJob)
+		ingestion.POST("/jobs/:id/retry", s.handlers.RetryIngestionJob)
 	}
 
-	// Ticket routes
+	// Ticket routes, scoped to the caller's own tickets unless they may manage tickets
 	tickets := api.Group("/tickets")
 	{
 		tickets.POST("/", s.handlers.CreateTicket)
 		tickets.GET("/", s.handlers.GetTickets)
 		tickets.GET("/:id", s.handlers.GetTicket)
-		tickets.PUT("/:id/status", s.handlers.UpdateTicketStatus)
+		tickets.PUT("/:id/status", RequirePermission(PermissionManageTickets), s.handlers.UpdateTicketStatus)
 	}
 }
 
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"company-ai-training/internal/models"
+	"company-ai-training/internal/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const tenantContextKey = "tenant"
+
+// TenantMiddleware resolves the caller's tenant, with its chat model and embedder, and
+// stores it in the gin context. It must run after AuthMiddleware.
+func TenantMiddleware(tenantService *services.TenantService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenantContext, err := tenantService.Resolve(currentPrincipal(c).TenantID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Unknown tenant"})
+			return
+		}
+
+		c.Set(tenantContextKey, tenantContext)
+		c.Next()
+	}
+}
+
+// RequirePlatformAdmin rejects callers who are not admins of the default tenant,
+// the only ones allowed to manage tenants
+func RequirePlatformAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := currentPrincipal(c)
+		if principal.Role != models.RoleAdmin || currentTenant(c).Tenant.Slug != models.DefaultTenantSlug {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You do not have permission to perform this action"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// currentTenant returns the tenant of the request
+func currentTenant(c *gin.Context) *services.TenantContext {
+	return c.MustGet(tenantContextKey).(*services.TenantContext)
+}
+
+// The helpers below return the services scoped to the request's tenant. Handlers must
+// use them rather than the unscoped services held by Handlers.
+
+func (h *Handlers) documents(c *gin.Context) *services.DocumentService {
+	return h.documentService.ForTenant(currentTenant(c).Tenant.ID)
+}
+
+func (h *Handlers) vectors(c *gin.Context) *services.VectorService {
+	tenant := currentTenant(c)
+	return h.vectorService.ForTenant(tenant.Tenant.ID, tenant.Embedder)
+}
+
+func (h *Handlers) chat(c *gin.Context) *services.ChatService {
+	return h.chatService.ForTenant(currentTenant(c), h.vectors(c), h.users(c))
+}
+
+func (h *Handlers) users(c *gin.Context) *services.UserService {
+	return h.userService.ForTenant(currentTenant(c).Tenant.ID)
+}
+
+func (h *Handlers) tickets(c *gin.Context) *services.TicketService {
+	return h.ticketService.ForTenant(currentTenant(c).Tenant.ID)
+}
+
+func (h *Handlers) categories(c *gin.Context) *services.CategoryService {
+	return h.categoryService.ForTenant(currentTenant(c).Tenant.ID)
+}
+
+func (h *Handlers) ingestion(c *gin.Context) *services.IngestionService {
+	return h.ingestionService.ForTenant(currentTenant(c).Tenant.ID)
+}
+
+func (h *Handlers) access(c *gin.Context) *services.AccessControlService {
+	return h.accessService.ForTenant(currentTenant(c).Tenant.ID)
+}
@@ -2,12 +2,23 @@ package database
 
 import (
 	"company-ai-training/internal/models"
+	"fmt"
+	"log"
+	"strings"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-func Initialize(databaseURL string) (*gorm.DB, error) {
+// EmbeddingOptions describe the configured embedder and how to handle a change of embedder
+type EmbeddingOptions struct {
+	Model       string // Provider and model name, recorded on the embedding column
+	Dimension   int
+	Rebuild     bool // Drop embeddings of another model or dimension and queue their documents for re-embedding
+	MaxAttempts int  // Attempts of the queued re-embedding jobs
+}
+
+func Initialize(databaseURL string, embedding EmbeddingOptions) (*gorm.DB, error) {
 	db, err := gorm.Open(postgres.Open(databaseURL), &gorm.Config{})
 	if err != nil {
 		return nil, err
@@ -18,20 +29,340 @@ func Initialize(databaseURL string) (*gorm.DB, error) {
 		return nil, err
 	}
 
+	// Existing rows must belong to a tenant before tenant_id can become NOT NULL
+	if err := ensureDefaultTenant(db); err != nil {
+		return nil, fmt.Errorf("failed to prepare tenant columns: %w", err)
+	}
+
 	// Auto migrate tables
 	err = db.AutoMigrate(
 		&models.Category{},
 		&models.Document{},
+		&models.DocumentVersion{},
 		&models.DocumentCategory{},
 		&models.DocumentChunk{},
 		&models.User{},
 		&models.ChatSession{},
 		&models.ChatMessage{},
 		&models.HRTicket{},
+		&models.IngestionJob{},
+		&models.APIKey{},
+		&models.AccessRule{},
+		&models.EmbeddingCacheEntry{},
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := enforceTenantConstraints(db); err != nil {
+		return nil, fmt.Errorf("failed to apply tenant constraints: %w", err)
+	}
+
+	// The embedding column is sized by the configured embedder, not by a struct tag
+	if err := ensureEmbeddingColumn(db, embedding); err != nil {
+		return nil, err
+	}
+
+	// Cached vectors keep the dimension of the model that produced them
+	if err := db.Exec("ALTER TABLE embedding_cache ADD COLUMN IF NOT EXISTS embedding vector NOT NULL").Error; err != nil {
+		return nil, err
+	}
+
+	// Full-text index backing lexical and hybrid search. The 'simple' configuration only lowercases,
+	// which keeps Vietnamese words, form codes and policy numbers intact.
+	if err := db.Exec(`ALTER TABLE document_chunks ADD COLUMN IF NOT EXISTS content_tsv tsvector
+		GENERATED ALWAYS AS (to_tsvector('simple', content)) STORED`).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_document_chunks_content_tsv ON document_chunks USING GIN (content_tsv)").Error; err != nil {
+		return nil, err
+	}
+
+	// Documents created before duplicate detection get the hash of their text. Their original
+	// files were not kept, so they can only be matched by text.
+	for _, table := range []string{"documents", "document_versions"} {
+		if err := db.Exec(fmt.Sprintf(`UPDATE %s SET text_hash = encode(sha256(convert_to(COALESCE(content, ''), 'UTF8')), 'hex')
+			WHERE text_hash IS NULL OR text_hash = ''`, table)).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// Documents created before version history existed start it with their current content
+	if err := db.Exec(`
+		INSERT INTO document_versions (id, tenant_id, document_id, version, name, type, content, size, file_hash, text_hash, created_at)
+		SELECT gen_random_uuid(), d.tenant_id, d.id, d.version, d.name, d.type, d.content, d.size, d.file_hash, d.text_hash, d.updated_at
+		FROM documents d
+		WHERE NOT EXISTS (SELECT 1 FROM document_versions v WHERE v.document_id = d.id)
+	`).Error; err != nil {
+		return nil, err
+	}
+
+	// Only one job per document may run, so two workers never write the same document's chunks
+	if err := db.Exec(`
+		UPDATE ingestion_jobs SET status = ?, locked_at = NULL
+		WHERE status = ? AND id NOT IN (
+			SELECT DISTINCT ON (document_id) id FROM ingestion_jobs WHERE status = ? ORDER BY document_id, locked_at DESC
+		)
+	`, models.IngestionJobQueued, models.IngestionJobRunning, models.IngestionJobRunning).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Exec(fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS idx_ingestion_jobs_running_document
+		ON ingestion_jobs (document_id) WHERE status = '%s'`, models.IngestionJobRunning)).Error; err != nil {
+		return nil, err
+	}
+
+	// Documents embedded before ingestion status tracking existed are already searchable
+	if err := db.Exec(`
+		UPDATE documents d SET ingestion_status = ?, chunks_total = (SELECT COUNT(*) FROM document_chunks dc WHERE dc.document_id = d.id)
+		WHERE d.ingestion_status = ?
+		  AND EXISTS (SELECT 1 FROM document_chunks dc WHERE dc.document_id = d.id)
+		  AND NOT EXISTS (SELECT 1 FROM ingestion_jobs j WHERE j.document_id = d.id AND j.status IN (?, ?))
+	`, models.DocumentStatusReady, models.DocumentStatusPending, models.IngestionJobQueued, models.IngestionJobRunning).Error; err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
+
+// tenantTables are the tables whose rows belong to a tenant
+var tenantTables = []string{
+	"categories", "documents", "document_versions", "document_categories", "document_chunks", "users", "chat_sessions",
+	"chat_messages", "hr_tickets", "ingestion_jobs", "api_keys", "access_rules",
+}
+
+// ensureDefaultTenant creates the default tenant and assigns it every row that predates
+// multi-tenancy, so AutoMigrate can make tenant_id NOT NULL on populated tables
+func ensureDefaultTenant(db *gorm.DB) error {
+	if err := db.AutoMigrate(&models.Tenant{}); err != nil {
+		return err
+	}
+
+	var tenant models.Tenant
+	if err := db.Where(models.Tenant{Slug: models.DefaultTenantSlug}).
+		Attrs(models.Tenant{Name: "Default"}).
+		FirstOrCreate(&tenant).Error; err != nil {
+		return err
+	}
+
+	for _, table := range tenantTables {
+		if !db.Migrator().HasTable(table) {
+			continue
+		}
+		if err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS tenant_id uuid", table)).Error; err != nil {
+			return err
+		}
+		result := db.Exec(fmt.Sprintf("UPDATE %s SET tenant_id = ? WHERE tenant_id IS NULL", table), tenant.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			log.Printf("Assigned %d existing %s rows to the default tenant", result.RowsAffected, table)
+		}
+	}
+
+	return nil
+}
+
+// enforceTenantConstraints references tenants from every tenant_id column, so rows can never
+// be written for a tenant that does not exist, and drops the global unique constraints that
+// became unique per tenant
+func enforceTenantConstraints(db *gorm.DB) error {
+	for _, table := range tenantTables {
+		constraint := "fk_" + table + "_tenant"
+
+		var count int64
+		if err := db.Raw("SELECT COUNT(*) FROM pg_constraint WHERE conname = ?", constraint).Scan(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+
+		if err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (tenant_id) REFERENCES tenants(id)", table, constraint)).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, legacy := range []struct{ table, column string }{
+		{"categories", "name"},
+		{"users", "email"},
+		{"users", "employee_id"},
+	} {
+		if err := dropSingleColumnUnique(db, legacy.table, legacy.column); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dropSingleColumnUnique removes unique constraints and indexes covering only the given column
+func dropSingleColumnUnique(db *gorm.DB, table, column string) error {
+	var constraints []string
+	if err := db.Raw(`
+		SELECT con.conname
+		FROM pg_constraint con
+		JOIN pg_class rel ON rel.oid = con.conrelid
+		JOIN pg_attribute att ON att.attrelid = rel.oid AND att.attnum = con.conkey[1]
+		WHERE rel.relname = ? AND con.contype = 'u' AND array_length(con.conkey, 1) = 1 AND att.attname = ?
+	`, table, column).Scan(&constraints).Error; err != nil {
+		return err
+	}
+	for _, name := range constraints {
+		log.Printf("Dropping global unique constraint %s, %s.%s is now unique per tenant", name, table, column)
+		if err := db.Exec(fmt.Sprintf(`ALTER TABLE %s DROP CONSTRAINT %q`, table, name)).Error; err != nil {
+			return err
+		}
+	}
+
+	var indexes []string
+	if err := db.Raw(`
+		SELECT idx.relname
+		FROM pg_index x
+		JOIN pg_class idx ON idx.oid = x.indexrelid
+		JOIN pg_class rel ON rel.oid = x.indrelid
+		JOIN pg_attribute att ON att.attrelid = rel.oid AND att.attnum = x.indkey[0]
+		WHERE rel.relname = ? AND x.indisunique AND NOT x.indisprimary AND x.indnatts = 1 AND att.attname = ?
+	`, table, column).Scan(&indexes).Error; err != nil {
+		return err
+	}
+	for _, name := range indexes {
+		log.Printf("Dropping global unique index %s, %s.%s is now unique per tenant", name, table, column)
+		if err := db.Exec(fmt.Sprintf(`DROP INDEX IF EXISTS %q`, name)).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Changes ensureEmbeddingColumn makes to an existing embedding column
+type embeddingColumnChange int
+
+const (
+	embeddingColumnUnchanged   embeddingColumnChange = iota
+	embeddingColumnRecordModel                       // Record the configured model on a column from before models were recorded
+	embeddingColumnReplace                           // Switch the column to the configured model, re-embedding existing chunks
+)
+
+// planEmbeddingColumn decides how to bring a column of current dimension holding vectors of
+// currentModel, empty if unrecorded, to the configured embedder. Vectors of another model or
+// dimension cannot be compared, so replacing a column with chunks needs an explicit rebuild.
+func planEmbeddingColumn(current int, currentModel string, chunkCount int64, opts EmbeddingOptions) (embeddingColumnChange, error) {
+	if current == opts.Dimension && currentModel == opts.Model {
+		return embeddingColumnUnchanged, nil
+	}
+	if current == opts.Dimension && currentModel == "" {
+		// Columns created before the model was recorded are assumed to hold the configured one
+		return embeddingColumnRecordModel, nil
+	}
+	if chunkCount > 0 && !opts.Rebuild {
+		if currentModel == "" {
+			currentModel = "an unrecorded model"
+		}
+		return embeddingColumnUnchanged, fmt.Errorf("document_chunks.embedding holds %d-dimensional vectors of %s but the embedder is %s producing %d; "+
+			"set EMBEDDING_REBUILD=true to re-embed the %d existing chunks with it", current, currentModel, opts.Model, opts.Dimension, chunkCount)
+	}
+	return embeddingColumnReplace, nil
+}
+
+// ensureEmbeddingColumn creates document_chunks.embedding as vector(dimension) and records the
+// model that fills it in the column comment. When the embedder changed, see planEmbeddingColumn,
+// the existing chunks are dropped and their documents queued for re-embedding in one transaction,
+// so every document returns to search once the ingestion workers have caught up.
+func ensureEmbeddingColumn(db *gorm.DB, opts EmbeddingOptions) error {
+	var columns []struct {
+		Dimension int
+		Comment   string
+	}
+	if err := db.Raw(`
+		SELECT atttypmod AS dimension, COALESCE(col_description(attrelid, attnum), '') AS comment
+		FROM pg_attribute
+		WHERE attrelid = 'document_chunks'::regclass AND attname = 'embedding' AND NOT attisdropped
+	`).Scan(&columns).Error; err != nil {
+		return err
+	}
+
+	if len(columns) == 0 {
+		if err := db.Exec(fmt.Sprintf("ALTER TABLE document_chunks ADD COLUMN embedding vector(%d)", opts.Dimension)).Error; err != nil {
+			return err
+		}
+		return setEmbeddingModel(db, opts.Model)
+	}
+
+	current := columns[0].Dimension
+	currentModel := strings.TrimPrefix(columns[0].Comment, embeddingModelPrefix)
+
+	var chunkCount int64
+	if err := db.Model(&models.DocumentChunk{}).Count(&chunkCount).Error; err != nil {
+		return err
+	}
+
+	change, err := planEmbeddingColumn(current, currentModel, chunkCount, opts)
+	if err != nil {
+		return err
+	}
+	switch change {
+	case embeddingColumnUnchanged:
+		return nil
+	case embeddingColumnRecordModel:
+		log.Printf("Recording %s as the model of existing embeddings", opts.Model)
+		return setEmbeddingModel(db, opts.Model)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if chunkCount > 0 {
+			queued, err := queueReembedding(tx, opts.MaxAttempts)
+			if err != nil {
+				return err
+			}
+			log.Printf("Embedding model changed from %s (%d dimensions) to %s (%d dimensions), dropped %d chunks and queued %d documents for re-embedding",
+				currentModel, current, opts.Model, opts.Dimension, chunkCount, queued)
+			if err := tx.Exec("DELETE FROM document_chunks").Error; err != nil {
+				return err
+			}
+		}
+		if current != opts.Dimension {
+			if err := tx.Exec(fmt.Sprintf("ALTER TABLE document_chunks ALTER COLUMN embedding TYPE vector(%d) USING NULL", opts.Dimension)).Error; err != nil {
+				return err
+			}
+		}
+		return setEmbeddingModel(tx, opts.Model)
+	})
+}
+
+// queueReembedding marks every document with chunks as pending and queues an ingestion job
+// for it, replacing the jobs still waiting, and returns how many documents were queued
+func queueReembedding(tx *gorm.DB, maxAttempts int) (int64, error) {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	embedded := `SELECT DISTINCT document_id FROM document_chunks`
+
+	if err := tx.Exec(`UPDATE ingestion_jobs SET status = ?, updated_at = NOW() WHERE status = ?`,
+		models.IngestionJobCancelled, models.IngestionJobQueued).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Exec(`
+		UPDATE documents SET ingestion_status = ?, ingestion_error = '', chunks_processed = 0, chunks_total = 0
+		WHERE deleted_at IS NULL AND id IN (`+embedded+`)
+	`, models.DocumentStatusPending).Error; err != nil {
+		return 0, err
+	}
+	result := tx.Exec(`
+		INSERT INTO ingestion_jobs (id, tenant_id, document_id, strategy, status, attempts, max_attempts, run_at, created_at, updated_at)
+		SELECT gen_random_uuid(), d.tenant_id, d.id, ?, ?, 0, ?, NOW(), NOW(), NOW()
+		FROM documents d
+		WHERE d.deleted_at IS NULL AND d.id IN (`+embedded+`)
+	`, models.IngestionStrategyAuto, models.IngestionJobQueued, maxAttempts)
+	return result.RowsAffected, result.Error
+}
+
+// embeddingModelPrefix starts the comment of the embedding column, followed by the model name
+const embeddingModelPrefix = "model="
+
+// setEmbeddingModel records the model whose vectors the embedding column holds
+func setEmbeddingModel(db *gorm.DB, model string) error {
+	comment := strings.ReplaceAll(embeddingModelPrefix+model, "'", "''")
+	return db.Exec(fmt.Sprintf("COMMENT ON COLUMN document_chunks.embedding IS '%s'", comment)).Error
+}
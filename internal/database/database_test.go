@@ -0,0 +1,58 @@
+package database
+
+import (
+	"company-ai-training/internal/services"
+	"strings"
+	"testing"
+)
+
+func TestPlanEmbeddingColumn(t *testing.T) {
+	// The offline embedder used in CI, as main.go names it
+	hashing := services.NewHashingEmbedder(256)
+	hashModel := "hash/" + hashing.ModelName()
+
+	configured := func(rebuild bool) EmbeddingOptions {
+		return EmbeddingOptions{Model: hashModel, Dimension: hashing.Dimension(), Rebuild: rebuild, MaxAttempts: 5}
+	}
+
+	tests := []struct {
+		name         string
+		current      int
+		currentModel string
+		chunks       int64
+		opts         EmbeddingOptions
+		want         embeddingColumnChange
+		wantErr      string
+	}{
+		{"same embedder", 256, hashModel, 40, configured(false), embeddingColumnUnchanged, ""},
+		{"unrecorded model of the same dimension", 256, "", 40, configured(false), embeddingColumnRecordModel, ""},
+		{"other model without chunks", 256, "ollama/nomic-embed-text", 0, configured(false), embeddingColumnReplace, ""},
+		{"other dimension without chunks", 768, "", 0, configured(false), embeddingColumnReplace, ""},
+		{"other model with chunks", 256, "ollama/nomic-embed-text", 40, configured(false), embeddingColumnUnchanged,
+			"holds 256-dimensional vectors of ollama/nomic-embed-text but the embedder is hash/hashing-v1 producing 256"},
+		{"other dimension with chunks", 768, "gemini/text-embedding-004", 40, configured(false), embeddingColumnUnchanged,
+			"set EMBEDDING_REBUILD=true to re-embed the 40 existing chunks"},
+		{"unrecorded model of another dimension", 768, "", 40, configured(false), embeddingColumnUnchanged, "vectors of an unrecorded model"},
+		{"rebuild other model", 256, "ollama/nomic-embed-text", 40, configured(true), embeddingColumnReplace, ""},
+		{"rebuild other dimension", 768, "gemini/text-embedding-004", 40, configured(true), embeddingColumnReplace, ""},
+		{"rebuild with the same embedder", 256, hashModel, 40, configured(true), embeddingColumnUnchanged, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := planEmbeddingColumn(tt.current, tt.currentModel, tt.chunks, tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("planEmbeddingColumn() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("planEmbeddingColumn() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("planEmbeddingColumn() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Access rule resource types, the table names of Category and Document
+const (
+	AccessResourceCategory = "categories"
+	AccessResourceDocument = "documents"
+)
+
+// AccessRule grants a role, a department or a single user access to a restricted
+// category or document. A resource without rules is visible to everyone; once it has
+// rules only callers matching at least one of them can retrieve it. Each rule sets
+// exactly one of Role, Department and UserID.
+type AccessRule struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	TenantID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"-"`
+	ResourceType string     `gorm:"not null;index:idx_access_rules_resource" json:"resource_type"`
+	ResourceID   uuid.UUID  `gorm:"type:uuid;not null;index:idx_access_rules_resource" json:"resource_id"`
+	Role         string     `json:"role,omitempty"`
+	Department   string     `json:"department,omitempty"`
+	UserID       *uuid.UUID `gorm:"type:uuid" json:"user_id,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
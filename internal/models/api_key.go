@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIKey is a long-lived credential for scripts and integrations. Only the SHA-256
+// hash of the key is stored; the raw key is shown once when it is created.
+type APIKey struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	TenantID   uuid.UUID  `gorm:"type:uuid;not null;index" json:"-"`
+	Name       string     `gorm:"not null" json:"name"`
+	Prefix     string     `gorm:"not null" json:"prefix"` // First characters of the key, to tell keys apart
+	KeyHash    string     `gorm:"not null;uniqueIndex" json:"-"`
+	UserID     *uuid.UUID `gorm:"type:uuid;index" json:"user_id"` // User the key acts as
+	User       *User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Role       string     `json:"role,omitempty"` // Role of service keys without a user; keys with a user use the user's role
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
@@ -30,6 +30,7 @@ type ActionButton struct {
 // HRTicket represents an HR support ticket
 type HRTicket struct {
 	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	TenantID    uuid.UUID `gorm:"type:uuid;not null;index" json:"-"`
 	UserID      *uuid.UUID `gorm:"type:uuid" json:"user_id"`
 	SessionID   uuid.UUID `gorm:"type:uuid;not null" json:"session_id"`
 	Question    string    `gorm:"type:text;not null" json:"question"`
@@ -9,54 +9,128 @@ import (
 
 type Category struct {
 	ID          uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	Name        string         `gorm:"not null;unique" json:"name"`
+	TenantID    uuid.UUID      `gorm:"type:uuid;not null;uniqueIndex:idx_categories_tenant_name" json:"-"`
+	Name        string         `gorm:"not null;uniqueIndex:idx_categories_tenant_name" json:"name"`
 	Description string         `gorm:"type:text" json:"description"`
+	AccessRules []AccessRule   `gorm:"polymorphic:Resource;polymorphicValue:categories" json:"access_rules,omitempty"`
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
+// Document ingestion statuses
+const (
+	DocumentStatusExtracting = "extracting" // Text is being extracted from the uploaded file
+	DocumentStatusPending    = "pending"    // Waiting for an ingestion worker
+	DocumentStatusChunking   = "chunking"   // Text is being split into chunks
+	DocumentStatusEmbedding  = "embedding"  // Chunks are being embedded, see ChunksProcessed/ChunksTotal
+	DocumentStatusReady      = "ready"      // Chunks are searchable
+	DocumentStatusFailed     = "failed"     // Extraction or ingestion gave up, see IngestionError
+)
+
 type Document struct {
-	ID          uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	Name        string         `gorm:"not null" json:"name"`
-	Content     string         `gorm:"type:text" json:"content"`
-	Type        string         `gorm:"not null" json:"type"` // pdf, docx, txt
-	Size        int64          `json:"size"`
-	Categories  []Category     `gorm:"many2many:document_categories;" json:"categories,omitempty"`
-	UploadedAt  time.Time      `json:"uploaded_at"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
-	ChunksCount int            `gorm:"-" json:"chunks_count"` // Virtual field for chunks count
+	ID                 uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	TenantID           uuid.UUID      `gorm:"type:uuid;not null;index" json:"-"`
+	Name               string         `gorm:"not null" json:"name"`
+	Content            string         `gorm:"type:text" json:"content"`
+	Type               string         `gorm:"not null" json:"type"` // File extension without the dot: pdf, docx, xlsx, pptx, html, md, csv, txt
+	Size               int64          `json:"size"`
+	FileHash           string         `gorm:"index" json:"file_hash,omitempty"`               // SHA-256 of the uploaded file, empty for text input
+	TextHash           string         `gorm:"index" json:"text_hash"`                         // SHA-256 of the extracted text
+	BlobKey            string         `json:"-"`                                              // Original file in the blob store, empty for text input
+	ContentType        string         `json:"content_type,omitempty"`                         // MIME type of the original file
+	ExtractionWarnings string         `gorm:"type:text" json:"extraction_warnings,omitempty"` // e.g. pages whose text could not be extracted
+	PageBreaks         string         `gorm:"type:text" json:"-"`                             // Where each page starts in Content as JSON, empty when the source has no pages
+	Version            int            `gorm:"not null;default:1" json:"version"`              // Current entry in document_versions
+	Categories         []Category     `gorm:"many2many:document_categories;" json:"categories,omitempty"`
+	AccessRules        []AccessRule   `gorm:"polymorphic:Resource;polymorphicValue:documents" json:"access_rules,omitempty"`
+	IngestionStatus    string         `gorm:"not null;default:'pending'" json:"ingestion_status"`
+	IngestionError     string         `gorm:"type:text" json:"ingestion_error,omitempty"`
+	ChunksProcessed    int            `gorm:"not null;default:0" json:"chunks_processed"`
+	ChunksTotal        int            `gorm:"not null;default:0" json:"chunks_total"`
+	EmbeddingTexts     int            `gorm:"not null;default:0" json:"embedding_texts"`      // Texts sent to the embedding provider by the last ingestion
+	EmbeddingTokens    int            `gorm:"not null;default:0" json:"embedding_tokens"`     // Their estimated token count
+	EmbeddingCacheHits int            `gorm:"not null;default:0" json:"embedding_cache_hits"` // Texts of the last ingestion served from the embedding cache instead
+	UploadedAt         time.Time      `json:"uploaded_at"`
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	DeletedAt          gorm.DeletedAt `gorm:"index" json:"-"`
+	ChunksCount        int            `gorm:"-" json:"chunks_count"` // Virtual field for chunks count
+}
+
+// DocumentIngestionStatus is the progress of a document through the ingestion pipeline
+type DocumentIngestionStatus struct {
+	DocumentID         uuid.UUID `json:"document_id"`
+	Name               string    `json:"name"`
+	Status             string    `json:"status"`
+	Error              string    `json:"error,omitempty"`
+	ChunksProcessed    int       `json:"chunks_processed"`
+	ChunksTotal        int       `json:"chunks_total"`
+	EmbeddingTexts     int       `json:"embedding_texts"`
+	EmbeddingTokens    int       `json:"embedding_tokens"`
+	EmbeddingCacheHits int       `json:"embedding_cache_hits"`
+}
+
+// IsFinal reports whether the document has left the pipeline
+func (s DocumentIngestionStatus) IsFinal() bool {
+	return s.Status == DocumentStatusReady || s.Status == DocumentStatusFailed
 }
 
 type DocumentCategory struct {
 	DocumentID uuid.UUID `gorm:"type:uuid;primary_key" json:"document_id"`
 	CategoryID uuid.UUID `gorm:"type:uuid;primary_key" json:"category_id"`
+	TenantID   uuid.UUID `gorm:"type:uuid;not null;index" json:"-"`
 	Document   Document  `gorm:"foreignKey:DocumentID" json:"document,omitempty"`
 	Category   Category  `gorm:"foreignKey:CategoryID" json:"category,omitempty"`
 	CreatedAt  time.Time `json:"created_at"`
 }
 
 type DocumentChunk struct {
-	ID         uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	DocumentID uuid.UUID `gorm:"type:uuid;not null" json:"document_id"`
-	Document   Document  `gorm:"foreignKey:DocumentID" json:"document"`
-	Content    string    `gorm:"type:text;not null" json:"content"`
-	ChunkIndex int       `gorm:"not null" json:"chunk_index"`
-	Embedding  []float32 `gorm:"type:vector(768)" json:"-"` // Vector embedding for similarity search
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	TenantID    uuid.UUID `gorm:"type:uuid;not null;index" json:"-"`
+	DocumentID  uuid.UUID `gorm:"type:uuid;not null" json:"document_id"`
+	Document    Document  `gorm:"foreignKey:DocumentID" json:"document"`
+	Content     string    `gorm:"type:text;not null" json:"content"`
+	ChunkIndex  int       `gorm:"not null" json:"chunk_index"`
+	StartOffset int       `gorm:"not null;default:0" json:"start_offset"` // Character offsets of the chunk in the document content
+	EndOffset   int       `gorm:"not null;default:0" json:"end_offset"`
+	SectionPath string    `gorm:"type:text" json:"section_path,omitempty"`        // Enclosing headings, e.g. "Leave > Annual leave"
+	PageStart   int       `gorm:"not null;default:0" json:"page_start,omitempty"` // First page of the chunk, 0 when the source has no pages
+	PageEnd     int       `gorm:"not null;default:0" json:"page_end,omitempty"`   // Last page of the chunk
+	TokenCount  int       `gorm:"not null;default:0" json:"token_count"`          // Estimated model tokens of the content
+	Embedding   []float32 `gorm:"-:migration" json:"-"`                           // Vector embedding, column sized by the configured embedder
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Score       float64   `gorm:"-" json:"score"`               // Virtual field, cosine similarity to the search query, share of its words found in lexical mode
+	Highlight   string    `gorm:"-" json:"highlight,omitempty"` // Virtual field, HTML-escaped snippet with query terms in <mark>
+}
+
+// User roles
+const (
+	RoleAdmin    = "admin"    // Manages documents, categories, users and ingestion
+	RoleHRAgent  = "hr_agent" // Handles HR tickets
+	RoleEmployee = "employee" // Chats and raises tickets
+)
+
+// IsValidRole reports whether role is one of the known user roles
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleAdmin, RoleHRAgent, RoleEmployee:
+		return true
+	}
+	return false
 }
 
 type User struct {
 	ID         uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	Email      string         `gorm:"unique;not null" json:"email"`
+	TenantID   uuid.UUID      `gorm:"type:uuid;not null;uniqueIndex:idx_users_tenant_email;uniqueIndex:idx_users_tenant_employee_id" json:"-"`
+	Email      string         `gorm:"not null;uniqueIndex:idx_users_tenant_email" json:"email"`
 	Name       string         `gorm:"not null" json:"name"`
+	Role       string         `gorm:"not null;default:'employee'" json:"role"`
 	Department string         `json:"department"`
 	Position   string         `json:"position"`
 	StartDate  time.Time      `gorm:"not null" json:"start_date"`
-	EmployeeID string         `gorm:"unique" json:"employee_id"`
+	EmployeeID string         `gorm:"uniqueIndex:idx_users_tenant_employee_id" json:"employee_id"`
 	CreatedAt  time.Time      `json:"created_at"`
 	UpdatedAt  time.Time      `json:"updated_at"`
 	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
@@ -64,10 +138,12 @@ type User struct {
 
 type ChatSession struct {
 	ID         uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	TenantID   uuid.UUID  `gorm:"type:uuid;not null;index" json:"-"`
 	UserID     *uuid.UUID `gorm:"type:uuid" json:"user_id"` // Optional user association
 	User       *User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
 	CategoryID *uuid.UUID `gorm:"type:uuid" json:"category_id"` // Optional category filter
 	Category   *Category  `gorm:"foreignKey:CategoryID" json:"category,omitempty"`
+	SearchMode string     `json:"search_mode,omitempty"` // Optional retrieval mode, empty uses the server default
 	Name       string     `gorm:"not null" json:"name"`
 	CreatedAt  time.Time  `json:"created_at"`
 	UpdatedAt  time.Time  `json:"updated_at"`
@@ -75,10 +151,29 @@ type ChatSession struct {
 
 type ChatMessage struct {
 	ID            uuid.UUID   `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	TenantID      uuid.UUID   `gorm:"type:uuid;not null;index" json:"-"`
 	SessionID     uuid.UUID   `gorm:"type:uuid;not null" json:"session_id"`
 	Session       ChatSession `gorm:"foreignKey:SessionID" json:"session"`
 	Role          string      `gorm:"not null" json:"role"` // user, assistant
 	Content       string      `gorm:"type:text;not null" json:"content"`
-	ContextChunks string      `gorm:"type:text" json:"-"` // Referenced document chunks as JSON string
+	ContextChunks string      `gorm:"type:text" json:"-"`                  // Referenced document chunks as JSON string
+	CitationsJSON string      `gorm:"column:citations;type:text" json:"-"` // Citations as JSON string
+	Citations     []Citation  `gorm:"-" json:"citations,omitempty"`        // Virtual field decoded from CitationsJSON
 	CreatedAt     time.Time   `json:"created_at"`
 }
+
+// Citation maps an inline [n] marker in an assistant answer to the chunk it was drawn from
+type Citation struct {
+	Number       int       `json:"number"`
+	DocumentID   uuid.UUID `json:"document_id"`
+	DocumentName string    `json:"document_name"`
+	ChunkID      uuid.UUID `json:"chunk_id"`
+	ChunkIndex   int       `json:"chunk_index"`
+	StartOffset  int       `json:"start_offset"` // Character offsets of the chunk in the document content
+	EndOffset    int       `json:"end_offset"`
+	SectionPath  string    `json:"section_path,omitempty"`
+	PageStart    int       `json:"page_start,omitempty"`
+	PageEnd      int       `json:"page_end,omitempty"`
+	Snippet      string    `json:"snippet"` // HTML-escaped, with query terms in <mark>
+	Score        float64   `json:"score"`
+}
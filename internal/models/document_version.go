@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DocumentVersion is one revision of a document's content. Versions are never modified:
+// updates and rollbacks append a new version and make it the document's current one.
+type DocumentVersion struct {
+	ID                 uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	TenantID           uuid.UUID  `gorm:"type:uuid;not null;index" json:"-"`
+	DocumentID         uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_document_versions_document_version" json:"document_id"`
+	Version            int        `gorm:"not null;uniqueIndex:idx_document_versions_document_version" json:"version"`
+	Name               string     `gorm:"not null" json:"name"`
+	Type               string     `gorm:"not null" json:"type"`
+	Content            string     `gorm:"type:text" json:"content,omitempty"`
+	Size               int64      `json:"size"`
+	FileHash           string     `json:"file_hash,omitempty"`
+	BlobKey            string     `json:"-"`
+	ContentType        string     `json:"content_type,omitempty"`
+	ExtractionWarnings string     `gorm:"type:text" json:"extraction_warnings,omitempty"`
+	PageBreaks         string     `gorm:"type:text" json:"-"`
+	TextHash           string     `json:"text_hash"`
+	UploadedByID       *uuid.UUID `gorm:"type:uuid" json:"uploaded_by_id,omitempty"`
+	UploadedBy         *User      `gorm:"foreignKey:UploadedByID" json:"uploaded_by,omitempty"`
+	Note               string     `gorm:"type:text" json:"note,omitempty"` // e.g. "Rolled back to version 2"
+	CreatedAt          time.Time  `json:"created_at"`
+}
+
+// Diff line operations
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// DiffLine is one line of a line-based diff between two versions
+type DiffLine struct {
+	Op      string `json:"op"`
+	Text    string `json:"text"`
+	OldLine int    `json:"old_line,omitempty"` // 1-based line in the older version, 0 for inserts
+	NewLine int    `json:"new_line,omitempty"` // 1-based line in the newer version, 0 for deletes
+}
+
+// DocumentDiff is the line-based difference between two versions of a document
+type DocumentDiff struct {
+	DocumentID  uuid.UUID  `json:"document_id"`
+	FromVersion int        `json:"from_version"`
+	ToVersion   int        `json:"to_version"`
+	Added       int        `json:"added"`
+	Removed     int        `json:"removed"`
+	Lines       []DiffLine `json:"lines"`
+}
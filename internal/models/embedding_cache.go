@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// EmbeddingCacheEntry is an embedding vector stored under the hash of the text it was computed
+// from. Vectors only depend on the text and the model, so entries are shared by every tenant.
+// The embedding column itself is an untyped vector added by the database setup.
+type EmbeddingCacheEntry struct {
+	Model      string    `gorm:"primaryKey;type:varchar(255)" json:"model"`
+	Dimension  int       `gorm:"primaryKey" json:"dimension"`
+	TextHash   string    `gorm:"primaryKey;type:char(64)" json:"text_hash"` // Hex SHA-256 of the embedded text
+	Hits       int64     `gorm:"not null;default:0" json:"hits"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `gorm:"not null;index" json:"last_used_at"`
+}
+
+func (EmbeddingCacheEntry) TableName() string {
+	return "embedding_cache"
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Ingestion job statuses
+const (
+	IngestionJobQueued    = "queued"
+	IngestionJobRunning   = "running"
+	IngestionJobSucceeded = "succeeded"
+	IngestionJobDead      = "dead"      // Exhausted its attempts, needs a manual retry
+	IngestionJobCancelled = "cancelled" // Superseded by a newer job for the same document
+)
+
+// Ingestion strategies
+const (
+	IngestionStrategyAuto     = "auto"     // Semantic chunking with legacy fallback
+	IngestionStrategySemantic = "semantic" // Semantic chunking only, with the job's chunk config
+)
+
+// IngestionJob is a durable request to (re)chunk and embed a document
+type IngestionJob struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	TenantID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"-"`
+	DocumentID  uuid.UUID  `gorm:"type:uuid;not null;index" json:"document_id"`
+	Strategy    string     `gorm:"not null;default:'auto'" json:"strategy"`
+	ChunkConfig string     `gorm:"type:text" json:"-"` // Chunk config as JSON string
+	Status      string     `gorm:"not null;default:'queued';index" json:"status"`
+	Attempts    int        `gorm:"not null;default:0" json:"attempts"`
+	MaxAttempts int        `gorm:"not null;default:5" json:"max_attempts"`
+	LastError   string     `gorm:"type:text" json:"last_error,omitempty"`
+	RunAt       time.Time  `gorm:"not null;index" json:"run_at"` // Earliest time the job may be picked up
+	LockedAt    *time.Time `json:"locked_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultTenantSlug identifies the tenant that owns data created before multi-tenancy
+// and requests that do not name a tenant. Its admins manage the other tenants.
+const DefaultTenantSlug = "default"
+
+// Tenant is a company or subsidiary whose data is isolated from the others
+type Tenant struct {
+	ID           uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Slug         string    `gorm:"not null;uniqueIndex" json:"slug"`
+	Name         string    `gorm:"not null" json:"name"`
+	GeminiAPIKey string    `json:"-"`                              // Tenant's own Gemini key, empty uses GEMINI_API_KEY
+	SystemPrompt string    `gorm:"type:text" json:"system_prompt"` // Replaces the default assistant instructions when set
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	HasGeminiKey bool      `gorm:"-" json:"has_gemini_api_key"` // Virtual field, the key itself is never returned
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"company-ai-training/internal/models"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AccessSubject is who documents are retrieved for, checked against access rules
+type AccessSubject struct {
+	UserID     *uuid.UUID
+	Role       string
+	Department string
+}
+
+// unrestricted reports whether the subject bypasses access rules
+func (a *AccessSubject) unrestricted() bool {
+	return a != nil && a.Role == models.RoleAdmin
+}
+
+// AccessSubject returns the caller as an access control subject
+func (p *Principal) AccessSubject() *AccessSubject {
+	return &AccessSubject{UserID: p.UserID, Role: p.Role, Department: p.Department}
+}
+
+// accessSubjectForUser returns the subject for a user, nil for anonymous sessions
+func accessSubjectForUser(user *models.User) *AccessSubject {
+	if user == nil {
+		return nil
+	}
+	return &AccessSubject{UserID: &user.ID, Role: user.Role, Department: user.Department}
+}
+
+// documentAccessFilter builds the SQL condition, on alias d, under which the subject may
+// read a document: the document's own rules, if any, must match, and so must the rules
+// of every restricted category it belongs to. A nil subject only sees unrestricted
+// documents.
+func documentAccessFilter(subject *AccessSubject) (string, []interface{}) {
+	if subject.unrestricted() {
+		return "", nil
+	}
+
+	var role, department string
+	var userID interface{}
+	if subject != nil {
+		role, department = subject.Role, subject.Department
+		if subject.UserID != nil {
+			userID = subject.UserID.String()
+		}
+	}
+
+	match := `((ar.role <> '' AND ar.role = ?) OR (ar.department <> '' AND ar.department = ?) OR ar.user_id = ?)`
+	sql := ` AND (
+				NOT EXISTS (
+					SELECT 1 FROM access_rules ar
+					WHERE ar.resource_type = 'documents' AND ar.resource_id = d.id
+				)
+				OR EXISTS (
+					SELECT 1 FROM access_rules ar
+					WHERE ar.resource_type = 'documents' AND ar.resource_id = d.id AND ` + match + `
+				)
+			) AND NOT EXISTS (
+				SELECT 1 FROM document_categories acl_dc
+				JOIN categories acl_c ON acl_c.id = acl_dc.category_id AND acl_c.deleted_at IS NULL
+				WHERE acl_dc.document_id = d.id
+				AND EXISTS (
+					SELECT 1 FROM access_rules ar
+					WHERE ar.resource_type = 'categories' AND ar.resource_id = acl_dc.category_id
+				)
+				AND NOT EXISTS (
+					SELECT 1 FROM access_rules ar
+					WHERE ar.resource_type = 'categories' AND ar.resource_id = acl_dc.category_id AND ` + match + `
+				)
+			)`
+
+	return sql, []interface{}{role, department, userID, role, department, userID}
+}
+
+// AccessControlService manages access rules on categories and documents
+type AccessControlService struct {
+	db       *gorm.DB
+	tenantID uuid.UUID
+}
+
+func NewAccessControlService(db *gorm.DB) *AccessControlService {
+	return &AccessControlService{
+		db: db,
+	}
+}
+
+// ForTenant returns a copy of the service limited to the tenant's rules and documents
+func (s *AccessControlService) ForTenant(tenantID uuid.UUID) *AccessControlService {
+	return &AccessControlService{
+		db:       scopeToTenant(s.db, tenantID),
+		tenantID: tenantID,
+	}
+}
+
+// GetAccessRules returns the rules of a category or document
+func (s *AccessControlService) GetAccessRules(resourceType string, resourceID uuid.UUID) ([]models.AccessRule, error) {
+	var rules []models.AccessRule
+	if err := s.db.Where("resource_type = ? AND resource_id = ?", resourceType, resourceID).
+		Order("created_at ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// SetAccessRules replaces the rules of a category or document. An empty list makes it visible to everyone.
+func (s *AccessControlService) SetAccessRules(resourceType string, resourceID uuid.UUID, rules []models.AccessRule) ([]models.AccessRule, error) {
+	for i := range rules {
+		if err := validateAccessRule(&rules[i]); err != nil {
+			return nil, err
+		}
+		rules[i].ID = uuid.New()
+		rules[i].TenantID = s.tenantID
+		rules[i].ResourceType = resourceType
+		rules[i].ResourceID = resourceID
+		rules[i].CreatedAt = time.Now()
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("resource_type = ? AND resource_id = ?", resourceType, resourceID).
+			Delete(&models.AccessRule{}).Error; err != nil {
+			return err
+		}
+		if len(rules) == 0 {
+			return nil
+		}
+		return tx.Create(&rules).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update access rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// CanAccessDocument reports whether the subject may read a document
+func (s *AccessControlService) CanAccessDocument(documentID uuid.UUID, subject *AccessSubject) (bool, error) {
+	filterSQL, filterArgs := documentAccessFilter(subject)
+
+	var count int64
+	args := append([]interface{}{documentID, s.tenantID}, filterArgs...)
+	if err := s.db.Raw(`SELECT COUNT(*) FROM documents d WHERE d.id = ? AND d.tenant_id = ? AND d.deleted_at IS NULL`+filterSQL, args...).Scan(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// FilterAccessibleDocuments drops the documents the subject may not read
+func (s *AccessControlService) FilterAccessibleDocuments(docs []models.Document, subject *AccessSubject) ([]models.Document, error) {
+	if subject.unrestricted() || len(docs) == 0 {
+		return docs, nil
+	}
+
+	ids := make([]uuid.UUID, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+
+	filterSQL, filterArgs := documentAccessFilter(subject)
+
+	var allowedIDs []uuid.UUID
+	args := append([]interface{}{ids, s.tenantID}, filterArgs...)
+	if err := s.db.Raw(`SELECT d.id FROM documents d WHERE d.id IN ? AND d.tenant_id = ?`+filterSQL, args...).Scan(&allowedIDs).Error; err != nil {
+		return nil, err
+	}
+
+	allowed := make(map[uuid.UUID]bool, len(allowedIDs))
+	for _, id := range allowedIDs {
+		allowed[id] = true
+	}
+
+	filtered := make([]models.Document, 0, len(docs))
+	for _, doc := range docs {
+		if allowed[doc.ID] {
+			filtered = append(filtered, doc)
+		}
+	}
+	return filtered, nil
+}
+
+// validateAccessRule checks that a rule grants exactly one role, department or user
+func validateAccessRule(rule *models.AccessRule) error {
+	set := 0
+	if rule.Role != "" {
+		if !models.IsValidRole(rule.Role) {
+			return fmt.Errorf("invalid role %q", rule.Role)
+		}
+		set++
+	}
+	if rule.Department != "" {
+		set++
+	}
+	if rule.UserID != nil {
+		set++
+	}
+	if set != 1 {
+		return fmt.Errorf("each access rule must set exactly one of role, department or user_id")
+	}
+	return nil
+}
@@ -0,0 +1,463 @@
+package services
+
+import (
+	"company-ai-training/internal/models"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	apiKeyPrefix = "cak_"
+	jwtClockSkew = time.Minute
+)
+
+// Authentication methods
+const (
+	AuthMethodJWT    = "jwt"
+	AuthMethodAPIKey = "api_key"
+	AuthMethodNone   = "none" // Authentication disabled for local development
+)
+
+// ErrUnauthenticated is returned when credentials are missing, malformed, expired or revoked
+var ErrUnauthenticated = errors.New("invalid or expired credentials")
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	TenantID   uuid.UUID  `json:"tenant_id"`         // Tenant every request of the caller is scoped to
+	UserID     *uuid.UUID `json:"user_id,omitempty"` // Linked user, nil when the caller has no user record
+	Subject    string     `json:"subject"`
+	Email      string     `json:"email,omitempty"`
+	Role       string     `json:"role"`
+	Department string     `json:"department,omitempty"`
+	Method     string     `json:"method"`
+	APIKeyID   *uuid.UUID `json:"api_key_id,omitempty"`
+}
+
+// IsUser reports whether the caller is the given user
+func (p *Principal) IsUser(userID *uuid.UUID) bool {
+	return p.UserID != nil && userID != nil && *p.UserID == *userID
+}
+
+// AuthConfig holds the trusted token issuers
+type AuthConfig struct {
+	JWTSecret   string // Shared secret for HS256 tokens, empty disables HS256
+	JWKSFile    string // Local JWKS file with RSA keys for RS256 tokens, empty disables RS256
+	JWTIssuer   string // Required "iss" claim, empty skips the check
+	JWTAudience string // Required "aud" claim, empty skips the check
+	TrustEmail  bool   // Link tokens to users by an "email" claim the issuer did not mark as verified
+}
+
+// AuthService verifies bearer tokens and API keys
+type AuthService struct {
+	db      *gorm.DB
+	config  AuthConfig
+	rsaKeys map[string]*rsa.PublicKey
+	hmacKey []byte
+}
+
+func NewAuthService(db *gorm.DB, config AuthConfig) (*AuthService, error) {
+	service := &AuthService{
+		db:      db,
+		config:  config,
+		rsaKeys: make(map[string]*rsa.PublicKey),
+	}
+
+	if config.JWTSecret != "" {
+		service.hmacKey = []byte(config.JWTSecret)
+	}
+
+	if config.JWKSFile != "" {
+		if err := service.loadJWKS(config.JWKSFile); err != nil {
+			return nil, fmt.Errorf("failed to load JWKS file: %w", err)
+		}
+	}
+
+	return service, nil
+}
+
+// loadJWKS reads the RSA signing keys from a JSON Web Key Set file
+func (s *AuthService) loadJWKS(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return err
+	}
+
+	for _, key := range jwks.Keys {
+		if key.Kty != "RSA" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return fmt.Errorf("invalid modulus for key %q: %w", key.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return fmt.Errorf("invalid exponent for key %q: %w", key.Kid, err)
+		}
+
+		s.rsaKeys[key.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	if len(s.rsaKeys) == 0 {
+		return errors.New("no RSA signing keys found")
+	}
+	return nil
+}
+
+// Authenticate verifies a credential, which is either a JWT or an API key
+func (s *AuthService) Authenticate(credential string) (*Principal, error) {
+	if strings.HasPrefix(credential, apiKeyPrefix) {
+		return s.AuthenticateAPIKey(credential)
+	}
+	return s.AuthenticateJWT(credential)
+}
+
+// jwtClaims are the claims of a verified token
+type jwtClaims struct {
+	Subject       string          `json:"sub"`
+	Email         string          `json:"email"`
+	EmailVerified json.RawMessage `json:"email_verified"` // Boolean, or a "true"/"false" string for some issuers
+	Tenant        string          `json:"tenant"`         // Tenant slug, absent for the default tenant
+	Issuer        string          `json:"iss"`
+	Audience      json.RawMessage `json:"aud"`
+	ExpiresAt     *int64          `json:"exp"`
+	NotBefore     *int64          `json:"nbf"`
+}
+
+// AuthenticateJWT verifies the signature and claims of an HS256 or RS256 token
+func (s *AuthService) AuthenticateJWT(token string) (*Principal, error) {
+	claims, err := s.verifyJWT(token, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	tenantSlug := claims.Tenant
+	if tenantSlug == "" {
+		tenantSlug = models.DefaultTenantSlug
+	}
+	var tenant models.Tenant
+	if err := s.db.First(&tenant, "slug = ?", tenantSlug).Error; err != nil {
+		return nil, ErrUnauthenticated
+	}
+
+	principal := &Principal{
+		TenantID: tenant.ID,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+		Role:     models.RoleEmployee, // Callers without a user record get the least privileged role
+		Method:   AuthMethodJWT,
+	}
+	if user := s.resolveUser(tenant.ID, claims.Subject, s.linkableEmail(claims)); user != nil {
+		principal.UserID = &user.ID
+		principal.Role = user.Role
+		principal.Department = user.Department
+	}
+
+	return principal, nil
+}
+
+// verifyJWT checks the signature, expiry, issuer and audience of a token at the given time
+// and returns its claims
+func (s *AuthService) verifyJWT(token string, now time.Time) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrUnauthenticated
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, ErrUnauthenticated
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	switch header.Alg {
+	case "HS256":
+		if s.hmacKey == nil {
+			return nil, ErrUnauthenticated
+		}
+		mac := hmac.New(sha256.New, s.hmacKey)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, ErrUnauthenticated
+		}
+	case "RS256":
+		key := s.rsaKeys[header.Kid]
+		if key == nil && header.Kid == "" && len(s.rsaKeys) == 1 {
+			for _, only := range s.rsaKeys {
+				key = only
+			}
+		}
+		if key == nil {
+			return nil, ErrUnauthenticated
+		}
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, ErrUnauthenticated
+		}
+	default:
+		// Never accept "none" or algorithms we did not configure
+		return nil, ErrUnauthenticated
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, ErrUnauthenticated
+	}
+
+	if claims.ExpiresAt == nil || now.After(time.Unix(*claims.ExpiresAt, 0).Add(jwtClockSkew)) {
+		return nil, ErrUnauthenticated
+	}
+	if claims.NotBefore != nil && now.Add(jwtClockSkew).Before(time.Unix(*claims.NotBefore, 0)) {
+		return nil, ErrUnauthenticated
+	}
+	if s.config.JWTIssuer != "" && claims.Issuer != s.config.JWTIssuer {
+		return nil, ErrUnauthenticated
+	}
+	if s.config.JWTAudience != "" && !audienceContains(claims.Audience, s.config.JWTAudience) {
+		return nil, ErrUnauthenticated
+	}
+
+	return &claims, nil
+}
+
+// linkableEmail returns the email claim if it may link the token to a user, which takes the
+// issuer vouching for it: any issuer trusted for sign-in could otherwise mint a token with
+// the email of an existing admin
+func (s *AuthService) linkableEmail(claims *jwtClaims) string {
+	if s.config.TrustEmail {
+		return claims.Email
+	}
+
+	var verified bool
+	if err := json.Unmarshal(claims.EmailVerified, &verified); err != nil {
+		var text string
+		if json.Unmarshal(claims.EmailVerified, &text) == nil {
+			verified = strings.EqualFold(text, "true")
+		}
+	}
+	if !verified {
+		return ""
+	}
+	return claims.Email
+}
+
+// resolveUser links a token subject to a user of the tenant, by user ID or else by a
+// verified email, empty if there is none
+func (s *AuthService) resolveUser(tenantID uuid.UUID, subject, email string) *models.User {
+	var user models.User
+	users := scopeToTenant(s.db, tenantID)
+
+	if id, err := uuid.Parse(subject); err == nil {
+		if err := users.First(&user, "id = ?", id).Error; err == nil {
+			return &user
+		}
+	}
+
+	if email != "" {
+		if err := users.First(&user, "email = ?", email).Error; err == nil {
+			return &user
+		}
+	}
+
+	return nil
+}
+
+// AuthenticateAPIKey looks up an API key by its hash
+func (s *AuthService) AuthenticateAPIKey(rawKey string) (*Principal, error) {
+	var key models.APIKey
+	if err := s.db.Preload("User").First(&key, "key_hash = ?", hashAPIKey(rawKey)).Error; err != nil {
+		return nil, ErrUnauthenticated
+	}
+
+	now := time.Now()
+	if err := checkAPIKey(&key, now); err != nil {
+		return nil, err
+	}
+
+	s.db.Model(&models.APIKey{}).Where("id = ?", key.ID).UpdateColumn("last_used_at", now)
+
+	principal := &Principal{
+		TenantID: key.TenantID,
+		UserID:   key.UserID,
+		Subject:  "api_key:" + key.ID.String(),
+		Role:     key.Role,
+		Method:   AuthMethodAPIKey,
+		APIKeyID: &key.ID,
+	}
+	if key.User != nil {
+		principal.Email = key.User.Email
+		principal.Role = key.User.Role
+		principal.Department = key.User.Department
+	}
+	if principal.Role == "" {
+		principal.Role = models.RoleEmployee
+	}
+
+	return principal, nil
+}
+
+// checkAPIKey rejects a key that is revoked or expired at the given time
+func checkAPIKey(key *models.APIKey, now time.Time) error {
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return ErrUnauthenticated
+	}
+	return nil
+}
+
+// CreateAPIKey generates a new key acting as the given user of the tenant and returns the raw key once
+func (s *AuthService) CreateAPIKey(name string, tenantID uuid.UUID, userID *uuid.UUID, expiresAt *time.Time) (string, *models.APIKey, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	rawKey := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	key := &models.APIKey{
+		ID:        uuid.New(),
+		TenantID:  tenantID,
+		Name:      name,
+		Prefix:    rawKey[:len(apiKeyPrefix)+6],
+		KeyHash:   hashAPIKey(rawKey),
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+
+	if err := s.db.Create(key).Error; err != nil {
+		return "", nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return rawKey, key, nil
+}
+
+// EnsureAPIKey registers a service key of the tenant provided through configuration, such as the bootstrap admin key
+func (s *AuthService) EnsureAPIKey(tenantID uuid.UUID, name, rawKey, role string) (*models.APIKey, error) {
+	if !strings.HasPrefix(rawKey, apiKeyPrefix) || len(rawKey) < len(apiKeyPrefix)+32 {
+		return nil, fmt.Errorf("API key must start with %q and contain at least 32 random characters", apiKeyPrefix)
+	}
+
+	var key models.APIKey
+	err := s.db.First(&key, "key_hash = ?", hashAPIKey(rawKey)).Error
+	if err == nil {
+		if key.Role != role {
+			if err := s.db.Model(&key).UpdateColumn("role", role).Error; err != nil {
+				return nil, err
+			}
+		}
+		return &key, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	key = models.APIKey{
+		ID:        uuid.New(),
+		TenantID:  tenantID,
+		Name:      name,
+		Prefix:    rawKey[:len(apiKeyPrefix)+6],
+		KeyHash:   hashAPIKey(rawKey),
+		Role:      role,
+		CreatedAt: time.Now(),
+	}
+	if err := s.db.Create(&key).Error; err != nil {
+		return nil, fmt.Errorf("failed to register API key: %w", err)
+	}
+	return &key, nil
+}
+
+// GetAPIKeys lists the API keys of a user
+func (s *AuthService) GetAPIKeys(userID uuid.UUID) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes one of the user's API keys
+func (s *AuthService) RevokeAPIKey(id, userID uuid.UUID) error {
+	result := s.db.Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		UpdateColumn("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// hashAPIKey returns the hex SHA-256 of a raw key. Keys carry 256 bits of randomness,
+// so a fast unsalted hash is sufficient and allows lookup by hash.
+func hashAPIKey(rawKey string) string {
+	sum := sha256.Sum256([]byte(rawKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// decodeJWTPart decodes a base64url JSON segment of a token
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// audienceContains checks the "aud" claim, which may be a string or an array of strings
+func audienceContains(raw json.RawMessage, audience string) bool {
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return single == audience
+	}
+
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		for _, aud := range list {
+			if aud == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
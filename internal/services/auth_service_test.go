@@ -0,0 +1,233 @@
+package services
+
+import (
+	"company-ai-training/internal/models"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testJWTSecret = "test-secret"
+
+// signTestJWT builds a token with the given header and claims, signed with HS256 or RS256
+// depending on the header, or left unsigned for other algorithms
+func signTestJWT(t *testing.T, header, claims map[string]interface{}, rsaKey *rsa.PrivateKey) string {
+	t.Helper()
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(header) + "." + encode(claims)
+
+	var signature []byte
+	switch header["alg"] {
+	case "HS256":
+		mac := hmac.New(sha256.New, []byte(testJWTSecret))
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case "RS256":
+		digest := sha256.Sum256([]byte(signed))
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// newTestAuthService trusts the HS256 test secret and an RS256 key loaded from a JWKS file
+func newTestAuthService(t *testing.T, rsaKey *rsa.PrivateKey, config AuthConfig) *AuthService {
+	t.Helper()
+	jwks, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "key-1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+		}},
+	})
+	config.JWKSFile = filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(config.JWKSFile, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config.JWTSecret = testJWTSecret
+
+	service, err := NewAuthService(nil, config)
+	if err != nil {
+		t.Fatalf("NewAuthService() error = %v", err)
+	}
+	return service
+}
+
+func TestVerifyJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := newTestAuthService(t, rsaKey, AuthConfig{JWTIssuer: "https://sso.example.com", JWTAudience: "company-ai"})
+
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub": "user-1",
+			"iss": "https://sso.example.com",
+			"aud": "company-ai",
+			"exp": now.Add(time.Hour).Unix(),
+		}
+		for k, v := range changes {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+	hs256 := map[string]interface{}{"alg": "HS256", "typ": "JWT"}
+	rs256 := map[string]interface{}{"alg": "RS256", "kid": "key-1"}
+
+	// tamper swaps the subject in the payload and keeps the original signature
+	tamper := func(token string) string {
+		parts := strings.Split(token, ".")
+		payload, _ := json.Marshal(claims(map[string]interface{}{"sub": "admin"}))
+		return parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"valid HS256", signTestJWT(t, hs256, claims(nil), nil), false},
+		{"valid RS256", signTestJWT(t, rs256, claims(nil), rsaKey), false},
+		{"audience in a list", signTestJWT(t, hs256, claims(map[string]interface{}{"aud": []string{"other", "company-ai"}}), nil), false},
+		{"expired within clock skew", signTestJWT(t, hs256, claims(map[string]interface{}{"exp": now.Add(-30 * time.Second).Unix()}), nil), false},
+		{"alg none", signTestJWT(t, map[string]interface{}{"alg": "none"}, claims(nil), nil), true},
+		{"wrong alg", signTestJWT(t, map[string]interface{}{"alg": "HS512"}, claims(nil), nil), true},
+		{"RS256 signed by another key", signTestJWT(t, rs256, claims(nil), otherKey), true},
+		{"RS256 unknown kid", signTestJWT(t, map[string]interface{}{"alg": "RS256", "kid": "key-2"}, claims(nil), rsaKey), true},
+		{"tampered HS256 payload", tamper(signTestJWT(t, hs256, claims(nil), nil)), true},
+		{"tampered RS256 payload", tamper(signTestJWT(t, rs256, claims(nil), rsaKey)), true},
+		{"wrong audience", signTestJWT(t, hs256, claims(map[string]interface{}{"aud": "other"}), nil), true},
+		{"missing audience", signTestJWT(t, hs256, claims(map[string]interface{}{"aud": nil}), nil), true},
+		{"wrong issuer", signTestJWT(t, hs256, claims(map[string]interface{}{"iss": "https://evil.example.com"}), nil), true},
+		{"expired", signTestJWT(t, hs256, claims(map[string]interface{}{"exp": now.Add(-2 * time.Minute).Unix()}), nil), true},
+		{"missing exp", signTestJWT(t, hs256, claims(map[string]interface{}{"exp": nil}), nil), true},
+		{"not yet valid", signTestJWT(t, hs256, claims(map[string]interface{}{"nbf": now.Add(5 * time.Minute).Unix()}), nil), true},
+		{"malformed", "not-a-token", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := service.verifyJWT(tt.token, now)
+			if tt.wantErr {
+				if err != ErrUnauthenticated {
+					t.Errorf("verifyJWT() error = %v, want ErrUnauthenticated", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifyJWT() error = %v", err)
+			}
+			if got.Subject != "user-1" {
+				t.Errorf("verifyJWT() subject = %q, want user-1", got.Subject)
+			}
+		})
+	}
+}
+
+func TestVerifyJWTRejectsHS256WithoutSecret(t *testing.T) {
+	// An RS256-only deployment must not accept HS256 tokens, such as ones signed with the public key
+	service := &AuthService{}
+	token := signTestJWT(t, map[string]interface{}{"alg": "HS256"}, map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()}, nil)
+
+	if _, err := service.verifyJWT(token, time.Now()); err != ErrUnauthenticated {
+		t.Errorf("verifyJWT() error = %v, want ErrUnauthenticated", err)
+	}
+}
+
+func TestLinkableEmail(t *testing.T) {
+	tests := []struct {
+		name          string
+		emailVerified string
+		trustEmail    bool
+		want          string
+	}{
+		{"verified", `true`, false, "an@example.com"},
+		{"verified as string", `"true"`, false, "an@example.com"},
+		{"unverified", `false`, false, ""},
+		{"unverified as string", `"false"`, false, ""},
+		{"claim absent", ``, false, ""},
+		{"claim absent, emails trusted", ``, true, "an@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &AuthService{config: AuthConfig{TrustEmail: tt.trustEmail}}
+			claims := &jwtClaims{Email: "an@example.com", EmailVerified: json.RawMessage(tt.emailVerified)}
+			if got := service.linkableEmail(claims); got != tt.want {
+				t.Errorf("linkableEmail() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckAPIKey(t *testing.T) {
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		key     models.APIKey
+		wantErr bool
+	}{
+		{"active", models.APIKey{}, false},
+		{"not yet expired", models.APIKey{ExpiresAt: &future}, false},
+		{"expired", models.APIKey{ExpiresAt: &past}, true},
+		{"revoked", models.APIKey{RevokedAt: &past}, true},
+		{"revoked before expiry", models.APIKey{RevokedAt: &past, ExpiresAt: &future}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkAPIKey(&tt.key, now)
+			if tt.wantErr && err != ErrUnauthenticated {
+				t.Errorf("checkAPIKey() error = %v, want ErrUnauthenticated", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("checkAPIKey() error = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestHashAPIKey(t *testing.T) {
+	key := apiKeyPrefix + "0123456789abcdef0123456789abcdef"
+	if hashAPIKey(key) != hashAPIKey(key) {
+		t.Error("hashAPIKey() is not deterministic")
+	}
+	if hashAPIKey(key) == hashAPIKey(key+"x") {
+		t.Error("hashAPIKey() maps different keys to the same hash")
+	}
+	if len(hashAPIKey(key)) != 64 {
+		t.Errorf("hashAPIKey() length = %d, want 64 hex characters", len(hashAPIKey(key)))
+	}
+}
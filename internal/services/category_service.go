@@ -10,7 +10,8 @@ import (
 )
 
 type CategoryService struct {
-	db *gorm.DB
+	db       *gorm.DB
+	tenantID uuid.UUID
 }
 
 func NewCategoryService(db *gorm.DB) *CategoryService {
@@ -19,10 +20,19 @@ func NewCategoryService(db *gorm.DB) *CategoryService {
 	}
 }
 
+// ForTenant returns a copy of the service that only sees and creates the tenant's categories
+func (s *CategoryService) ForTenant(tenantID uuid.UUID) *CategoryService {
+	return &CategoryService{
+		db:       scopeToTenant(s.db, tenantID),
+		tenantID: tenantID,
+	}
+}
+
 // CreateCategory creates a new category
 func (s *CategoryService) CreateCategory(name, description string) (*models.Category, error) {
 	category := &models.Category{
 		ID:          uuid.New(),
+		TenantID:    s.tenantID,
 		Name:        name,
 		Description: description,
 		CreatedAt:   time.Now(),
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"company-ai-training/internal/config"
+	"fmt"
+	"strings"
+)
+
+// ChatModel is implemented by every LLM backend that can answer chat conversations
+type ChatModel interface {
+	// Chat generates the assistant reply for the given conversation
+	Chat(messages []Message) (string, error)
+	// ChatStream generates the reply incrementally, calling onChunk for every text fragment,
+	// and returns the complete reply once the model has finished
+	ChatStream(messages []Message, onChunk func(string) error) (string, error)
+}
+
+// NewChatModel creates the chat model backend selected in the configuration
+func NewChatModel(cfg *config.Config) (ChatModel, error) {
+	switch strings.ToLower(cfg.ChatProvider) {
+	case "", "gemini":
+		if cfg.GeminiAPIKey == "" {
+			return nil, fmt.Errorf("GEMINI_API_KEY is required for the gemini chat provider")
+		}
+		return &ResilientChatModel{
+			model:      NewGeminiClientV2(cfg.GeminiAPIKey, cfg.ChatModel, "", 0),
+			resilience: resilienceFor("Chat model", "gemini", cfg.GeminiAPIKey, resilienceConfig(cfg)),
+		}, nil
+	case "ollama":
+		return &ResilientChatModel{
+			model:      NewOllamaClient(cfg.OllamaBaseURL, cfg.ChatModel, "", 0),
+			resilience: resilienceFor("Chat model", "ollama", cfg.OllamaBaseURL, resilienceConfig(cfg)),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported chat provider: %s", cfg.ChatProvider)
+	}
+}
+
+// flattenConversation renders a conversation as "role: content" lines for single-prompt APIs
+func flattenConversation(messages []Message) string {
+	var builder strings.Builder
+	for _, msg := range messages {
+		builder.WriteString(fmt.Sprintf("%s: %s\n", msg.Role, msg.Content))
+	}
+	return builder.String()
+}
@@ -0,0 +1,32 @@
+package services
+
+import "testing"
+
+func TestFlattenConversation(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []Message
+		want     string
+	}{
+		{"empty", nil, ""},
+		{"single message", []Message{{Role: "user", Content: "Xin chào"}}, "user: Xin chào\n"},
+		{
+			name: "keeps order and roles",
+			messages: []Message{
+				{Role: "system", Content: "Be brief."},
+				{Role: "user", Content: "How many leave days?"},
+				{Role: "assistant", Content: "12 days."},
+			},
+			want: "system: Be brief.\nuser: How many leave days?\nassistant: 12 days.\n",
+		},
+		{"multi-line content", []Message{{Role: "user", Content: "line 1\nline 2"}}, "user: line 1\nline 2\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := flattenConversation(tt.messages); got != tt.want {
+				t.Errorf("flattenConversation() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
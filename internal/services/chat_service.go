@@ -4,6 +4,9 @@ import (
 	"company-ai-training/internal/models"
 	"encoding/json"
 	"fmt"
+	"html"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,15 +18,30 @@ type ChatService struct {
 	db            *gorm.DB
 	vectorService *VectorService
 	userService   *UserService
-	geminiClient  *GeminiClientV2
+	chatModel     ChatModel
+	tenantID      uuid.UUID
+	systemPrompt  string // Tenant instructions replacing the default prompt, empty keeps the default
 }
 
-func NewChatService(vectorService *VectorService, userService *UserService, geminiAPIKey string) *ChatService {
+func NewChatService(vectorService *VectorService, userService *UserService, chatModel ChatModel) *ChatService {
 	return &ChatService{
 		db:            vectorService.db,
 		vectorService: vectorService,
 		userService:   userService,
-		geminiClient:  NewGeminiClientV2(geminiAPIKey),
+		chatModel:     chatModel,
+	}
+}
+
+// ForTenant returns a copy of the service for one tenant, answering with the tenant's
+// chat model and instructions from the tenant's documents and users
+func (s *ChatService) ForTenant(tenant *TenantContext, vectorService *VectorService, userService *UserService) *ChatService {
+	return &ChatService{
+		db:            scopeToTenant(s.db, tenant.Tenant.ID),
+		vectorService: vectorService,
+		userService:   userService,
+		chatModel:     tenant.ChatModel,
+		tenantID:      tenant.Tenant.ID,
+		systemPrompt:  tenant.Tenant.SystemPrompt,
 	}
 }
 
@@ -34,10 +52,17 @@ func (s *ChatService) CreateSession(name string, userID *uuid.UUID) (*models.Cha
 
 // CreateSessionWithCategory creates a new chat session with category filter
 func (s *ChatService) CreateSessionWithCategory(name string, userID *uuid.UUID, categoryID *uuid.UUID) (*models.ChatSession, error) {
+	return s.CreateSessionWithSettings(name, userID, categoryID, "")
+}
+
+// CreateSessionWithSettings creates a new chat session with category filter and retrieval mode
+func (s *ChatService) CreateSessionWithSettings(name string, userID *uuid.UUID, categoryID *uuid.UUID, searchMode string) (*models.ChatSession, error) {
 	session := &models.ChatSession{
 		ID:         uuid.New(),
+		TenantID:   s.tenantID,
 		UserID:     userID,
 		CategoryID: categoryID,
+		SearchMode: searchMode,
 		Name:       name,
 		CreatedAt:  time.Now(),
 		UpdatedAt:  time.Now(),
@@ -65,6 +90,18 @@ func (s *ChatService) GetSessionMessages(sessionID uuid.UUID) ([]models.ChatMess
 	if err := s.db.Where("session_id = ?", sessionID).Order("created_at ASC").Find(&messages).Error; err != nil {
 		return nil, err
 	}
+
+	// Populate citations for each message. Unreadable citations are logged and left out
+	// rather than hiding the whole conversation.
+	for i := range messages {
+		if messages[i].CitationsJSON != "" {
+			if err := json.Unmarshal([]byte(messages[i].CitationsJSON), &messages[i].Citations); err != nil {
+				fmt.Printf("Warning: invalid citations on chat message %s: %v\n", messages[i].ID, err)
+				messages[i].Citations = nil
+			}
+		}
+	}
+
 	return messages, nil
 }
 
@@ -77,6 +114,15 @@ func (s *ChatService) GetAllSessions() ([]models.ChatSession, error) {
 	return sessions, nil
 }
 
+// GetUserSessions retrieves the chat sessions owned by a user
+func (s *ChatService) GetUserSessions(userID uuid.UUID) ([]models.ChatSession, error) {
+	var sessions []models.ChatSession
+	if err := s.db.Preload("Category").Where("user_id = ?", userID).Order("updated_at DESC").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
 // DeleteSession deletes a chat session and its messages
 func (s *ChatService) DeleteSession(sessionID uuid.UUID) error {
 	// Delete messages first
@@ -88,11 +134,93 @@ func (s *ChatService) DeleteSession(sessionID uuid.UUID) error {
 	return s.db.Delete(&models.ChatSession{}, "id = ?", sessionID).Error
 }
 
+// Stream event types emitted by SendMessageStream
+const (
+	StreamEventSources    = "sources"
+	StreamEventToken      = "token"
+	StreamEventMessage    = "message"
+	StreamEventActionCard = "action_card"
+	StreamEventDone       = "done"
+)
+
+// citationMarker matches inline citations such as [1] in an answer
+var citationMarker = regexp.MustCompile(`\[(\d+)\]`)
+
+// chatTurn holds everything prepared for one question before the model is called
+type chatTurn struct {
+	sessionID       uuid.UUID
+	userMessage     string
+	sources         []models.Citation // Retrieved chunks, numbered as presented to the model
+	contextChunkIDs []uuid.UUID
+	hasRelevantInfo bool
+	conversation    []Message
+}
+
 // SendMessageWithResponse processes user message and generates AI response with action card support
 func (s *ChatService) SendMessageWithResponse(sessionID uuid.UUID, userMessage string) (*models.ChatResponse, error) {
+	turn, err := s.prepareTurn(sessionID, userMessage)
+	if err != nil {
+		return nil, err
+	}
+
+	// Generate AI response
+	response, err := s.chatModel.Chat(turn.conversation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate AI response: %w", err)
+	}
+
+	return s.completeTurn(turn, response)
+}
+
+// SendMessageStream processes user message like SendMessageWithResponse but reports progress through emit:
+// the retrieved sources first, then every generated text fragment, then the saved message and action card.
+func (s *ChatService) SendMessageStream(sessionID uuid.UUID, userMessage string, emit func(event string, data interface{}) error) (*models.ChatResponse, error) {
+	turn, err := s.prepareTurn(sessionID, userMessage)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := emit(StreamEventSources, turn.sources); err != nil {
+		return nil, err
+	}
+
+	// Stream AI response
+	response, err := s.chatModel.ChatStream(turn.conversation, func(text string) error {
+		return emit(StreamEventToken, map[string]string{"text": text})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate AI response: %w", err)
+	}
+
+	chatResponse, err := s.completeTurn(turn, response)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := emit(StreamEventMessage, chatResponse.Message); err != nil {
+		return nil, err
+	}
+	if chatResponse.ActionCard != nil {
+		if err := emit(StreamEventActionCard, chatResponse.ActionCard); err != nil {
+			return nil, err
+		}
+	}
+
+	return chatResponse, emit(StreamEventDone, map[string]string{"message_id": chatResponse.Message.ID.String()})
+}
+
+// prepareTurn saves the user message, retrieves relevant chunks and builds the conversation for the model
+func (s *ChatService) prepareTurn(sessionID uuid.UUID, userMessage string) (*chatTurn, error) {
+	// Get session to check for category filter, which also rejects sessions of other tenants
+	session, err := s.GetSession(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
 	// Save user message
 	userMsg := &models.ChatMessage{
 		ID:        uuid.New(),
+		TenantID:  s.tenantID,
 		SessionID: sessionID,
 		Role:      "user",
 		Content:   userMessage,
@@ -103,27 +231,40 @@ func (s *ChatService) SendMessageWithResponse(sessionID uuid.UUID, userMessage s
 		return nil, fmt.Errorf("failed to save user message: %w", err)
 	}
 
-	// Get session to check for category filter
-	session, err := s.GetSession(sessionID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get session: %w", err)
+	// Retrieval runs with the session user's access; sessions without a user only see unrestricted documents
+	var sessionUser *models.User
+	if session.UserID != nil {
+		if user, err := s.userService.GetUser(*session.UserID); err == nil {
+			sessionUser = user
+		}
 	}
 
-	// Search for relevant document chunks with category filter
-	relevantChunks, err := s.vectorService.SearchSimilarChunksWithCategory(userMessage, 5, session.CategoryID)
+	// Search for relevant document chunks with the session's category filter and search mode
+	relevantChunks, err := s.vectorService.Search(SearchOptions{
+		Query:      userMessage,
+		Limit:      5,
+		CategoryID: session.CategoryID,
+		Mode:       session.SearchMode,
+		Highlight:  true,
+		Subject:    accessSubjectForUser(sessionUser),
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to search relevant chunks: %w", err)
 	}
 
-	// Build context from relevant chunks
+	turn := &chatTurn{
+		sessionID:   sessionID,
+		userMessage: userMessage,
+	}
+
+	// Build numbered context from relevant chunks so the model can cite them as [n]
 	var contextParts []string
-	var contextChunkIDs []uuid.UUID
-	hasRelevantInfo := false
 
-	for _, chunk := range relevantChunks {
-		contextParts = append(contextParts, fmt.Sprintf("Document: %s\nContent: %s", chunk.Document.Name, chunk.Content))
-		contextChunkIDs = append(contextChunkIDs, chunk.ID)
-		hasRelevantInfo = true
+	for i, chunk := range relevantChunks {
+		contextParts = append(contextParts, fmt.Sprintf("[%d] Document: %s\nContent: %s", i+1, chunk.Document.Name, chunk.Content))
+		turn.contextChunkIDs = append(turn.contextChunkIDs, chunk.ID)
+		turn.sources = append(turn.sources, buildCitation(i+1, chunk))
+		turn.hasRelevantInfo = true
 	}
 
 	context := strings.Join(contextParts, "\n\n---\n\n")
@@ -134,20 +275,15 @@ func (s *ChatService) SendMessageWithResponse(sessionID uuid.UUID, userMessage s
 		return nil, fmt.Errorf("failed to get conversation history: %w", err)
 	}
 
-	// Build conversation for AI
-	var conversation []Message
-
 	// Get user context if session has user
 	var userContext string
-	if session.UserID != nil {
-		if user, err := s.userService.GetUser(*session.UserID); err == nil {
-			userContext, _ = s.userService.GetUserContext(user)
-		}
+	if sessionUser != nil {
+		userContext, _ = s.userService.GetUserContext(sessionUser)
 	}
 
 	// Add system prompt with context
 	systemPrompt := s.buildSystemPrompt(context, userContext)
-	conversation = append(conversation, Message{
+	turn.conversation = append(turn.conversation, Message{
 		Role:    "system",
 		Content: systemPrompt,
 	})
@@ -160,37 +296,33 @@ func (s *ChatService) SendMessageWithResponse(sessionID uuid.UUID, userMessage s
 
 	for _, msg := range messages[historyStart:] {
 		if msg.Role == "user" || msg.Role == "assistant" {
-			conversation = append(conversation, Message{
+			turn.conversation = append(turn.conversation, Message{
 				Role:    msg.Role,
 				Content: msg.Content,
 			})
 		}
 	}
 
-	// Build conversation string for Gemini
-	conversationText := ""
-	for _, msg := range conversation {
-		conversationText += fmt.Sprintf("%s: %s\n", msg.Role, msg.Content)
-	}
-
-	fmt.Println(conversationText)
-
-	// Generate AI response
-	response, err := s.geminiClient.Chat(conversationText)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate AI response: %w", err)
-	}
+	return turn, nil
+}
 
-	// Convert context chunks to JSON string
-	contextChunksJSON, _ := json.Marshal(contextChunkIDs)
+// completeTurn saves the assistant message and decides whether to offer an HR ticket
+func (s *ChatService) completeTurn(turn *chatTurn, response string) (*models.ChatResponse, error) {
+	// Convert context chunks and citations to JSON strings
+	contextChunksJSON, _ := json.Marshal(turn.contextChunkIDs)
+	citations := resolveCitations(response, turn.sources)
+	citationsJSON, _ := json.Marshal(citations)
 
 	// Save assistant message
 	assistantMsg := &models.ChatMessage{
 		ID:            uuid.New(),
-		SessionID:     sessionID,
+		TenantID:      s.tenantID,
+		SessionID:     turn.sessionID,
 		Role:          "assistant",
 		Content:       response,
 		ContextChunks: string(contextChunksJSON),
+		CitationsJSON: string(citationsJSON),
+		Citations:     citations,
 		CreatedAt:     time.Now(),
 	}
 
@@ -199,7 +331,7 @@ func (s *ChatService) SendMessageWithResponse(sessionID uuid.UUID, userMessage s
 	}
 
 	// Update session timestamp
-	s.db.Model(&models.ChatSession{}).Where("id = ?", sessionID).Update("updated_at", time.Now())
+	s.db.Model(&models.ChatSession{}).Where("id = ?", turn.sessionID).Update("updated_at", time.Now())
 
 	// Create response
 	chatResponse := &models.ChatResponse{
@@ -207,7 +339,7 @@ func (s *ChatService) SendMessageWithResponse(sessionID uuid.UUID, userMessage s
 	}
 
 	// If no relevant information found, add action card
-	if !hasRelevantInfo || strings.Contains(strings.ToLower(response), "không tìm thấy") ||
+	if !turn.hasRelevantInfo || strings.Contains(strings.ToLower(response), "không tìm thấy") ||
 		strings.Contains(strings.ToLower(response), "không có thông tin") {
 		chatResponse.ActionCard = &models.ActionCard{
 			Type:        "create_ticket",
@@ -218,9 +350,9 @@ func (s *ChatService) SendMessageWithResponse(sessionID uuid.UUID, userMessage s
 				Endpoint: "/api/v1/tickets",
 				Method:   "POST",
 				Payload: map[string]string{
-					"question":   userMessage,
+					"question":   turn.userMessage,
 					"category":   "general",
-					"session_id": sessionID.String(),
+					"session_id": turn.sessionID.String(),
 				},
 			},
 		}
@@ -229,6 +361,52 @@ func (s *ChatService) SendMessageWithResponse(sessionID uuid.UUID, userMessage s
 	return chatResponse, nil
 }
 
+// buildCitation describes a retrieved chunk as citation number n. The snippet is HTML,
+// like the chunk's highlight.
+func buildCitation(n int, chunk models.DocumentChunk) models.Citation {
+	snippet := chunk.Highlight
+	if snippet == "" {
+		snippet = chunk.Content
+		if runes := []rune(snippet); len(runes) > 200 {
+			snippet = string(runes[:200]) + "…"
+		}
+		snippet = html.EscapeString(snippet)
+	}
+
+	return models.Citation{
+		Number:       n,
+		DocumentID:   chunk.DocumentID,
+		DocumentName: chunk.Document.Name,
+		ChunkID:      chunk.ID,
+		ChunkIndex:   chunk.ChunkIndex,
+		StartOffset:  chunk.StartOffset,
+		EndOffset:    chunk.EndOffset,
+		SectionPath:  chunk.SectionPath,
+		PageStart:    chunk.PageStart,
+		PageEnd:      chunk.PageEnd,
+		Snippet:      snippet,
+		Score:        chunk.Score,
+	}
+}
+
+// resolveCitations returns the sources referenced by [n] markers in the answer, in order of first use.
+// Markers that do not correspond to a retrieved source are ignored.
+func resolveCitations(response string, sources []models.Citation) []models.Citation {
+	var citations []models.Citation
+	seen := make(map[int]bool)
+
+	for _, match := range citationMarker.FindAllStringSubmatch(response, -1) {
+		n, err := strconv.Atoi(match[1])
+		if err != nil || n < 1 || n > len(sources) || seen[n] {
+			continue
+		}
+		seen[n] = true
+		citations = append(citations, sources[n-1])
+	}
+
+	return citations
+}
+
 // SendMessage processes a user message and generates AI response (backward compatibility)
 func (s *ChatService) SendMessage(sessionID uuid.UUID, userMessage string) (*models.ChatMessage, error) {
 	response, err := s.SendMessageWithResponse(sessionID, userMessage)
@@ -240,6 +418,10 @@ func (s *ChatService) SendMessage(sessionID uuid.UUID, userMessage string) (*mod
 
 // buildSystemPrompt creates system prompt with document context and user info
 func (s *ChatService) buildSystemPrompt(context string, userContext string) string {
+	if s.systemPrompt != "" {
+		return s.buildTenantSystemPrompt(context, userContext)
+	}
+
 	prompt := `Bạn là một AI assistant được thiết kế để trả lời câu hỏi dựa trên tài liệu nội bộ của công ty.
 
 ## HƯỚNG DẪN:
@@ -257,6 +439,9 @@ func (s *ChatService) buildSystemPrompt(context string, userContext string) stri
 	 - Hiển thị hình ảnh tài liệu theo dạng:  
      ![Hình ảnh tài liệu](URL)
 8. Đối với dạng câu hỏi kết quả. Hãy trả lời ngắn gọn kết quả cho người dùng
+9. Mỗi tài liệu tham khảo được đánh số dạng [1], [2]... Khi sử dụng thông tin từ tài liệu nào,
+   hãy ghi số trích dẫn tương ứng ngay sau câu đó, ví dụ: "Nhân viên được nghỉ 12 ngày phép [1]."
+   Chỉ dùng các số có trong phần TÀI LIỆU THAM KHẢO.
 
 ## NGỮ CẢNH NGƯỜI DÙNG:
 	Tên nhân viên: Nguyễn Quý Năng
@@ -282,3 +467,25 @@ Hãy trả lời câu hỏi dựa trên thông tin trên và xuất kết quả
 
 	return prompt
 }
+
+// buildTenantSystemPrompt uses the tenant's own instructions. The citation rule is kept
+// because citations are resolved from the [n] markers in the answer.
+func (s *ChatService) buildTenantSystemPrompt(context string, userContext string) string {
+	prompt := s.systemPrompt + `
+
+Mỗi tài liệu tham khảo được đánh số dạng [1], [2]... Khi sử dụng thông tin từ tài liệu nào,
+hãy ghi số trích dẫn tương ứng ngay sau câu đó. Chỉ dùng các số có trong phần TÀI LIỆU THAM KHẢO.`
+
+	if userContext != "" {
+		prompt += "\n\n## NGỮ CẢNH NGƯỜI DÙNG:\n" + userContext
+	}
+
+	if context != "" {
+		prompt += fmt.Sprintf(`
+
+## TÀI LIỆU THAM KHẢO:
+%s`, context)
+	}
+
+	return prompt
+}
@@ -0,0 +1,279 @@
+package services
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// locateFallbackBytes is the length of the chunk prefix and suffix searched for when a chunk
+// cannot be found verbatim in the document content
+const locateFallbackBytes = 64
+
+// maxPlainHeadingRunes is the length above which a line of plain text is never a heading
+const maxPlainHeadingRunes = 120
+
+// markdownHeadingPattern matches ATX headings, as written by the DOCX, HTML and Office extractors
+var markdownHeadingPattern = regexp.MustCompile(`^ {0,3}(#{1,6})[ \t]+(.+?)[ \t#]*$`)
+
+// legalHeadingPattern matches the part, chapter, section and article headings of plain text
+// such as extracted PDFs, e.g. "CHƯƠNG III - TIỀN LƯƠNG" or "Điều 5. Nghỉ phép năm". The number
+// must end the line or be followed by punctuation, which leaves "Điều 5 quy định..." alone.
+var legalHeadingPattern = regexp.MustCompile(`(?i)^(phần|chương|mục|điều)\s+(\d+|[ivxlc]+)\s*([.:\-–]|$)`)
+
+// numberedHeadingPattern matches numbered headings of two levels or more, e.g. "1.2 Nghỉ ốm",
+// but not amounts such as "1.500.000 đồng"
+var numberedHeadingPattern = regexp.MustCompile(`^(\d{1,2}(?:\.\d{1,2}){1,3})\.?\s+\p{Lu}`)
+
+// legalHeadingLevels nests plain-text headings. They do not mix with Markdown headings, which
+// come from other extractors, so they share its levels.
+var legalHeadingLevels = map[string]int{"phần": 1, "chương": 2, "mục": 3, "điều": 4}
+
+// textHeading is a heading line of a text
+type textHeading struct {
+	start, end int // Byte range of the line, without its line break
+	level      int
+	title      string
+}
+
+// findHeadings returns the heading lines of the text, Markdown or plain-text ones
+func findHeadings(text string) []textHeading {
+	var headings []textHeading
+	for start := 0; start < len(text); {
+		end := strings.IndexByte(text[start:], '\n')
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += start
+		}
+		if level, title, ok := parseHeading(text[start:end]); ok {
+			headings = append(headings, textHeading{start: start, end: end, level: level, title: title})
+		}
+		start = end + 1
+	}
+	return headings
+}
+
+// parseHeading returns the level and title of a heading line
+func parseHeading(line string) (int, string, bool) {
+	if match := markdownHeadingPattern.FindStringSubmatch(line); match != nil {
+		return len(match[1]), strings.TrimSpace(match[2]), true
+	}
+
+	title := strings.TrimSpace(line)
+	if title == "" || utf8.RuneCountInString(title) > maxPlainHeadingRunes {
+		return 0, "", false
+	}
+	if match := legalHeadingPattern.FindStringSubmatch(title); match != nil {
+		return legalHeadingLevels[strings.ToLower(match[1])], title, true
+	}
+	if match := numberedHeadingPattern.FindStringSubmatch(title); match != nil {
+		return legalHeadingLevels["điều"] + strings.Count(match[1], "."), title, true
+	}
+	return 0, "", false
+}
+
+// docHeading is a heading of the document content at a character offset
+type docHeading struct {
+	offset int
+	level  int
+	title  string
+}
+
+// docPage is the character offset in the document content at which a page starts
+type docPage struct {
+	Offset int `json:"offset"`
+	Page   int `json:"page"`
+}
+
+// annotateChunks records where each chunk comes from in the document content: its character
+// offsets, the headings enclosing it, the pages it spans and its estimated token count.
+// Chunkers normalize the text they split, so chunks are located by their non-space characters.
+func annotateChunks(content string, pages []docPage, chunks []SemanticChunk) {
+	locator := newChunkLocator(content)
+	headings := documentHeadings(content)
+
+	for i := range chunks {
+		chunk := &chunks[i]
+		chunk.StartOffset, chunk.EndOffset = locator.locate(chunk.Content)
+		chunk.SectionPath = sectionPathAt(headings, chunk.StartOffset)
+		if len(pages) > 0 {
+			chunk.PageStart = pageAt(pages, chunk.StartOffset)
+			chunk.PageEnd = pageAt(pages, max(chunk.EndOffset-1, chunk.StartOffset))
+		}
+		chunk.TokenCount = estimateTokens(chunk.Content)
+	}
+}
+
+// chunkLocator finds chunks, in order, in the document content they were cut from
+type chunkLocator struct {
+	compact string // Non-space characters of the content
+	offsets []int  // Character offset in the content of every byte of compact
+	from    int    // Where the search for the next chunk starts in compact
+}
+
+func newChunkLocator(content string) *chunkLocator {
+	compact, offsets := compactText(content)
+	return &chunkLocator{compact: compact, offsets: offsets}
+}
+
+// locate returns the character offsets of the chunk in the content. Chunks that cannot be
+// found verbatim are located by their beginning and end.
+func (l *chunkLocator) locate(chunk string) (int, int) {
+	key, _ := compactText(chunk)
+	if key == "" || len(l.offsets) == 0 {
+		offset := l.offsetAt(l.from)
+		return offset, offset
+	}
+
+	if idx := strings.Index(l.compact[l.from:], key); idx >= 0 {
+		start := l.from + idx
+		l.from = start + 1 // Overlapping chunks start after the previous one
+		return l.offsets[start], l.offsets[start+len(key)-1] + 1
+	}
+
+	prefix := truncateUTF8(key, locateFallbackBytes)
+	idx := strings.Index(l.compact[l.from:], prefix)
+	if idx < 0 {
+		offset := l.offsetAt(l.from)
+		return offset, offset + utf8.RuneCountInString(chunk)
+	}
+	start := l.from + idx
+	l.from = start + 1
+
+	suffix := key[len(key)-len(truncateUTF8Suffix(key, locateFallbackBytes)):]
+	end := l.offsets[start] + utf8.RuneCountInString(chunk)
+	if idx := strings.Index(l.compact[start:], suffix); idx >= 0 {
+		end = l.offsets[start+idx+len(suffix)-1] + 1
+	}
+	return l.offsets[start], end
+}
+
+// offsetAt returns the character offset of position i of compact, or the end of the content
+func (l *chunkLocator) offsetAt(i int) int {
+	if i < len(l.offsets) {
+		return l.offsets[i]
+	}
+	if len(l.offsets) == 0 {
+		return 0
+	}
+	return l.offsets[len(l.offsets)-1] + 1
+}
+
+// compactText drops whitespace and the dots of ellipses longer than three, as the semantic
+// chunker does, and returns the character offset in s of every byte kept
+func compactText(s string) (string, []int) {
+	var compact strings.Builder
+	offsets := make([]int, 0, len(s))
+	dots := 0
+
+	offset := 0
+	for _, r := range s {
+		keep := !unicode.IsSpace(r)
+		if keep && r == '.' {
+			dots++
+			keep = dots <= 3
+		} else if keep {
+			dots = 0
+		}
+
+		if keep {
+			compact.WriteRune(r)
+			for n := utf8.RuneLen(r); n > 0; n-- {
+				offsets = append(offsets, offset)
+			}
+		}
+		offset++
+	}
+
+	return compact.String(), offsets
+}
+
+// truncateUTF8 returns at most n bytes from the start of s without splitting a character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// truncateUTF8Suffix returns at most n bytes from the end of s without splitting a character
+func truncateUTF8Suffix(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	start := len(s) - n
+	for start < len(s) && !utf8.RuneStart(s[start]) {
+		start++
+	}
+	return s[start:]
+}
+
+// documentHeadings returns the headings of the content with their character offsets
+func documentHeadings(content string) []docHeading {
+	var headings []docHeading
+	offset, last := 0, 0
+	for _, heading := range findHeadings(content) {
+		offset += utf8.RuneCountInString(content[last:heading.start])
+		last = heading.start
+		headings = append(headings, docHeading{offset: offset, level: heading.level, title: heading.title})
+	}
+	return headings
+}
+
+// sectionPathAt returns the titles of the headings enclosing the offset, outermost first,
+// e.g. "Leave > Annual leave"
+func sectionPathAt(headings []docHeading, offset int) string {
+	var path []docHeading
+	for _, heading := range headings {
+		if heading.offset > offset {
+			break
+		}
+		for len(path) > 0 && path[len(path)-1].level >= heading.level {
+			path = path[:len(path)-1]
+		}
+		path = append(path, heading)
+	}
+
+	titles := make([]string, len(path))
+	for i, heading := range path {
+		titles[i] = heading.title
+	}
+	return strings.Join(titles, " > ")
+}
+
+// pageAt returns the page the offset falls on. Text before the first marker belongs to the first page.
+func pageAt(pages []docPage, offset int) int {
+	i := sort.Search(len(pages), func(i int) bool { return pages[i].Offset > offset })
+	if i == 0 {
+		return pages[0].Page
+	}
+	return pages[i-1].Page
+}
+
+// estimateTokens approximates the number of model tokens in text without calling a tokenizer:
+// about four characters per token, and at least one token per word or punctuation mark
+func estimateTokens(text string) int {
+	chars, words := 0, 0
+	inWord := false
+	for _, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+			inWord = false
+			continue
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			words++
+			inWord = false
+		case !inWord:
+			words++
+			inWord = true
+		}
+		chars++
+	}
+	return max((chars+3)/4, words)
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+// testHandbook is extracted PDF text with Vietnamese headings spread over three pages
+var testHandbook = pageMarker(1) + "\n# Chương 3. Nghỉ phép\n\n## Điều 5. Nghỉ phép năm\n\n" +
+	"Người lao động được nghỉ phép năm 12 ngày...... hưởng nguyên lương.\n\n" +
+	pageMarker(2) + "\nSố ngày nghỉ   phép chưa dùng được cộng dồn sang quý I năm sau.\n\n" +
+	"## Điều 6. Nghỉ ốm\n\nNghỉ ốm cần giấy xác nhận của cơ sở y tế.\n\n" +
+	pageMarker(3) + "\n# Chương 4. Tiền lương\n\nLương được trả vào ngày 5 hằng tháng.\n"
+
+// runeSlice returns the characters of s from start to end
+func runeSlice(s string, start, end int) string {
+	runes := []rune(s)
+	return string(runes[start:end])
+}
+
+func TestAnnotateChunksOffsets(t *testing.T) {
+	content, pageBreaks := splitPageMarkers(testHandbook)
+
+	// Chunkers collapse whitespace and long ellipses, and consecutive chunks may overlap
+	chunks := []SemanticChunk{
+		{Content: "Người lao động được nghỉ phép năm 12 ngày... hưởng nguyên lương."},
+		{Content: "hưởng nguyên lương. Số ngày nghỉ phép chưa dùng được cộng dồn sang quý I năm sau."},
+		{Content: "Nghỉ ốm cần giấy xác nhận của cơ sở y tế."},
+		{Content: "Lương được trả vào ngày 5 hằng tháng."},
+	}
+	annotateChunks(content, documentPages(pageBreaks), chunks)
+
+	want := []struct {
+		section   string
+		pageStart int
+		pageEnd   int
+	}{
+		{"Chương 3. Nghỉ phép > Điều 5. Nghỉ phép năm", 1, 1},
+		{"Chương 3. Nghỉ phép > Điều 5. Nghỉ phép năm", 1, 2},
+		{"Chương 3. Nghỉ phép > Điều 6. Nghỉ ốm", 2, 2},
+		{"Chương 4. Tiền lương", 3, 3},
+	}
+
+	for i, chunk := range chunks {
+		located := runeSlice(content, chunk.StartOffset, chunk.EndOffset)
+		if got, _ := compactText(located); got != mustCompact(chunk.Content) {
+			t.Errorf("chunk %d located as %q, want %q", i, located, chunk.Content)
+		}
+		if chunk.SectionPath != want[i].section {
+			t.Errorf("chunk %d SectionPath = %q, want %q", i, chunk.SectionPath, want[i].section)
+		}
+		if chunk.PageStart != want[i].pageStart || chunk.PageEnd != want[i].pageEnd {
+			t.Errorf("chunk %d pages = %d-%d, want %d-%d", i, chunk.PageStart, chunk.PageEnd, want[i].pageStart, want[i].pageEnd)
+		}
+		if chunk.TokenCount == 0 {
+			t.Errorf("chunk %d TokenCount = 0", i)
+		}
+	}
+}
+
+func TestAnnotateChunksVerbatimOffsets(t *testing.T) {
+	content, pageBreaks := splitPageMarkers(testHandbook)
+
+	// Chunks cut verbatim from the content are found at exactly their characters
+	var chunks []SemanticChunk
+	for _, paragraph := range strings.Split(content, "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			chunks = append(chunks, SemanticChunk{Content: paragraph})
+		}
+	}
+	annotateChunks(content, documentPages(pageBreaks), chunks)
+
+	for i, chunk := range chunks {
+		if got := runeSlice(content, chunk.StartOffset, chunk.EndOffset); got != chunk.Content {
+			t.Errorf("chunk %d: content[%d:%d] = %q, want %q", i, chunk.StartOffset, chunk.EndOffset, got, chunk.Content)
+		}
+	}
+}
+
+func TestChunkLocatorFallsBackToPrefix(t *testing.T) {
+	content := "Điều 1. " + strings.Repeat("Quy định chung về thời giờ làm việc. ", 4) + "Hết."
+	locator := newChunkLocator(content)
+
+	// The chunker rewrote the middle, so the chunk is located by its beginning and end
+	chunk := "Điều 1. " + strings.Repeat("Quy định chung về thời giờ làm việc. ", 2) + "(lược bớt) " +
+		strings.Repeat("Quy định chung về thời giờ làm việc. ", 2) + "Hết."
+	start, end := locator.locate(chunk)
+	if start != 0 || end != len([]rune(content)) {
+		t.Errorf("locate() = %d-%d, want 0-%d", start, end, len([]rune(content)))
+	}
+
+	// Chunks not in the content keep their length from where the search stopped
+	missing := "Không có trong tài liệu"
+	if start, end := locator.locate(missing); end-start != len([]rune(missing)) {
+		t.Errorf("locate() of a missing chunk = %d-%d, want %d characters", start, end, len([]rune(missing)))
+	}
+}
+
+func TestSectionPathAt(t *testing.T) {
+	headings := documentHeadings("# A\ntext\n## B\ntext\n### C\ntext\n## D\ntext\n# E\n")
+
+	tests := []struct {
+		offset int
+		want   string
+	}{
+		{0, "A"},
+		{5, "A"},
+		{12, "A > B"},
+		{22, "A > B > C"},
+		{33, "A > D"},
+		{40, "E"},
+	}
+
+	for _, tt := range tests {
+		if got := sectionPathAt(headings, tt.offset); got != tt.want {
+			t.Errorf("sectionPathAt(%d) = %q, want %q", tt.offset, got, tt.want)
+		}
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"   ", 0},
+		{"nghỉ phép", 2},
+		{"Người lao động được nghỉ phép năm 12 ngày.", 10},
+		{"abcdefghijklmnopqrstuvwxyz", 7},
+	}
+
+	for _, tt := range tests {
+		if got := estimateTokens(tt.text); got != tt.want {
+			t.Errorf("estimateTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+// mustCompact returns the non-space characters compactText keeps of s
+func mustCompact(s string) string {
+	compact, _ := compactText(s)
+	return compact
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"company-ai-training/internal/models"
+	"fmt"
+	"strings"
+)
+
+// maxDiffCells bounds the LCS table (changed old lines x changed new lines) to keep
+// the memory of a single diff around 64MB
+const maxDiffCells = 16 * 1024 * 1024
+
+// diffLines computes a line-based diff of two texts using the longest common subsequence
+// of their lines. The common prefix and suffix are matched first, so small edits to large
+// documents stay cheap.
+func diffLines(oldText, newText string) ([]models.DiffLine, error) {
+	oldLines := splitLines(oldText)
+	newLines := splitLines(newText)
+
+	prefix := 0
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix &&
+		oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+
+	a := oldLines[prefix : len(oldLines)-suffix]
+	b := newLines[prefix : len(newLines)-suffix]
+	if len(a)*len(b) > maxDiffCells {
+		return nil, fmt.Errorf("versions differ in too many lines to diff (%d and %d changed lines)", len(a), len(b))
+	}
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	width := len(b) + 1
+	lcs := make([]int32, (len(a)+1)*width)
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i*width+j] = lcs[(i+1)*width+j+1] + 1
+			} else if lcs[(i+1)*width+j] >= lcs[i*width+j+1] {
+				lcs[i*width+j] = lcs[(i+1)*width+j]
+			} else {
+				lcs[i*width+j] = lcs[i*width+j+1]
+			}
+		}
+	}
+
+	lines := make([]models.DiffLine, 0, len(oldLines)+len(b))
+	for i := 0; i < prefix; i++ {
+		lines = append(lines, models.DiffLine{Op: models.DiffEqual, Text: oldLines[i], OldLine: i + 1, NewLine: i + 1})
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, models.DiffLine{Op: models.DiffEqual, Text: a[i], OldLine: prefix + i + 1, NewLine: prefix + j + 1})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[(i+1)*width+j] >= lcs[i*width+j+1]):
+			lines = append(lines, models.DiffLine{Op: models.DiffDelete, Text: a[i], OldLine: prefix + i + 1})
+			i++
+		default:
+			lines = append(lines, models.DiffLine{Op: models.DiffInsert, Text: b[j], NewLine: prefix + j + 1})
+			j++
+		}
+	}
+
+	for k := 0; k < suffix; k++ {
+		oldIndex := len(oldLines) - suffix + k
+		newIndex := len(newLines) - suffix + k
+		lines = append(lines, models.DiffLine{Op: models.DiffEqual, Text: oldLines[oldIndex], OldLine: oldIndex + 1, NewLine: newIndex + 1})
+	}
+
+	return lines, nil
+}
+
+// splitLines splits text into lines, treating an empty text as having none
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"company-ai-training/internal/models"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// formatDiff renders diff lines as "=1,1 text", "-2 text" and "+2 text"
+func formatDiff(lines []models.DiffLine) []string {
+	var result []string
+	for _, line := range lines {
+		switch line.Op {
+		case models.DiffEqual:
+			result = append(result, fmt.Sprintf("=%d,%d %s", line.OldLine, line.NewLine, line.Text))
+		case models.DiffDelete:
+			result = append(result, fmt.Sprintf("-%d %s", line.OldLine, line.Text))
+		case models.DiffInsert:
+			result = append(result, fmt.Sprintf("+%d %s", line.NewLine, line.Text))
+		}
+	}
+	return result
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		oldText string
+		newText string
+		want    []string
+	}{
+		{"both empty", "", "", nil},
+		{"identical", "a\nb\n", "a\nb", []string{"=1,1 a", "=2,2 b"}},
+		{"created", "", "a\nb", []string{"+1 a", "+2 b"}},
+		{"cleared", "a\nb", "", []string{"-1 a", "-2 b"}},
+		{
+			name:    "changed line",
+			oldText: "Nghỉ phép\n12 ngày\nHết",
+			newText: "Nghỉ phép\n14 ngày\nHết",
+			want:    []string{"=1,1 Nghỉ phép", "-2 12 ngày", "+2 14 ngày", "=3,3 Hết"},
+		},
+		{
+			name:    "inserted and deleted lines shift numbers",
+			oldText: "a\nb\nc\nd",
+			newText: "a\nx\nb\nd\ne",
+			want:    []string{"=1,1 a", "+2 x", "=2,3 b", "-3 c", "=4,4 d", "+5 e"},
+		},
+		{
+			name:    "windows line endings",
+			oldText: "a\r\nb\r\n",
+			newText: "a\nb\nc\n",
+			want:    []string{"=1,1 a", "=2,2 b", "+3 c"},
+		},
+		{
+			name:    "moved line",
+			oldText: "a\nb\nc",
+			newText: "c\na\nb",
+			want:    []string{"+1 c", "=1,2 a", "=2,3 b", "-3 c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, err := diffLines(tt.oldText, tt.newText)
+			if err != nil {
+				t.Fatalf("diffLines() error = %v", err)
+			}
+			if got := formatDiff(lines); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffLines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffLinesRebuildsBothVersions(t *testing.T) {
+	oldText := "Điều 1\nĐiều 2\nnội dung\nĐiều 3\nnội dung\nĐiều 4\nhết"
+	newText := "Điều 1\nnội dung mới\nĐiều 3\nnội dung\nnội dung\nĐiều 5\nhết"
+
+	lines, err := diffLines(oldText, newText)
+	if err != nil {
+		t.Fatalf("diffLines() error = %v", err)
+	}
+
+	var oldLines, newLines []string
+	for _, line := range lines {
+		if line.Op != models.DiffInsert {
+			oldLines = append(oldLines, line.Text)
+			if line.OldLine != len(oldLines) {
+				t.Errorf("line %q OldLine = %d, want %d", line.Text, line.OldLine, len(oldLines))
+			}
+		}
+		if line.Op != models.DiffDelete {
+			newLines = append(newLines, line.Text)
+			if line.NewLine != len(newLines) {
+				t.Errorf("line %q NewLine = %d, want %d", line.Text, line.NewLine, len(newLines))
+			}
+		}
+	}
+	if got := strings.Join(oldLines, "\n"); got != oldText {
+		t.Errorf("old version rebuilt as %q, want %q", got, oldText)
+	}
+	if got := strings.Join(newLines, "\n"); got != newText {
+		t.Errorf("new version rebuilt as %q, want %q", got, newText)
+	}
+}
+
+func TestDiffLinesRejectsHugeChanges(t *testing.T) {
+	var oldLines, newLines []string
+	for i := 0; i < 4100; i++ {
+		oldLines = append(oldLines, fmt.Sprintf("old %d", i))
+		newLines = append(newLines, fmt.Sprintf("new %d", i))
+	}
+
+	if _, err := diffLines(strings.Join(oldLines, "\n"), strings.Join(newLines, "\n")); err == nil {
+		t.Error("diffLines() error = nil, want an error for versions too different to diff")
+	}
+
+	// A small edit to the same large document is diffed through its common prefix and suffix
+	edited := append([]string(nil), oldLines...)
+	edited[2000] = "edited"
+	lines, err := diffLines(strings.Join(oldLines, "\n"), strings.Join(edited, "\n"))
+	if err != nil {
+		t.Fatalf("diffLines() error = %v", err)
+	}
+	if len(lines) != len(oldLines)+1 {
+		t.Errorf("len(diffLines()) = %d, want %d", len(lines), len(oldLines)+1)
+	}
+}
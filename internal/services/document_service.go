@@ -1,134 +1,139 @@
 package services
 
 import (
-	"bytes"
 	"company-ai-training/internal/models"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
+	"log"
 	"mime/multipart"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/ledongthuc/pdf"
-	"github.com/unidoc/unioffice/document"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-type DocumentService struct {
-	db *gorm.DB
-}
+// Policies for an upload identical to an existing document of the tenant
+const (
+	DuplicatePolicyReject         = "reject"          // Fail with a DuplicateDocumentError
+	DuplicatePolicyReturnExisting = "return_existing" // Return the existing document unchanged
+	DuplicatePolicyNewVersion     = "new_version"     // Replace the existing document's content as a new version
+)
 
-func NewDocumentService(db *gorm.DB) *DocumentService {
-	return &DocumentService{
-		db: db,
+// IsValidDuplicatePolicy reports whether policy is a supported duplicate policy, empty meaning the default
+func IsValidDuplicatePolicy(policy string) bool {
+	switch policy {
+	case "", DuplicatePolicyReject, DuplicatePolicyReturnExisting, DuplicatePolicyNewVersion:
+		return true
 	}
+	return false
 }
 
-func (s *DocumentService) UploadDocument(file *multipart.FileHeader) (*models.Document, error) {
-	// Validate file type
-	ext := strings.ToLower(filepath.Ext(file.Filename))
-	if ext != ".pdf" && ext != ".docx" && ext != ".txt" {
-		return nil, errors.New("unsupported file type. Only PDF, DOCX, and TXT files are allowed")
-	}
+// Upload outcomes
+const (
+	UploadOutcomeCreated    = "created"     // A new document was created
+	UploadOutcomeExisting   = "existing"    // A duplicate was found and returned unchanged
+	UploadOutcomeNewVersion = "new_version" // A duplicate was found and replaced as a new version
+)
 
-	// Open file
-	src, err := file.Open()
-	if err != nil {
-		return nil, err
-	}
-	defer src.Close()
+// UploadResult is the document an upload resolved to
+type UploadResult struct {
+	Document *models.Document
+	Outcome  string
+}
 
-	// Extract content based on file type
-	var content string
-	switch ext {
-	case ".pdf":
-		content, err = s.extractPDFContent(src)
-	case ".docx":
-		content, err = s.extractDocxContent(src)
-	case ".txt":
-		content, err = s.extractTextContent(src)
-	}
+// ExtractionError is returned when no text could be extracted from an uploaded file. The
+// document is kept in the failed status, with the reason in its IngestionError.
+type ExtractionError struct {
+	Document *models.Document
+	Err      error
+}
 
-	if err != nil {
-		return nil, err
-	}
+func (e *ExtractionError) Error() string {
+	return fmt.Sprintf("failed to extract text from %s: %v", e.Document.Name, e.Err)
+}
 
-	// Create document record
-	doc := &models.Document{
-		ID:         uuid.New(),
-		Name:       file.Filename,
-		Content:    content,
-		Type:       strings.TrimPrefix(ext, "."),
-		Size:       int64(len(content)),
-		UploadedAt: time.Now(),
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
-	}
+func (e *ExtractionError) Unwrap() error { return e.Err }
 
-	// Save to database
-	if err := s.db.Create(doc).Error; err != nil {
-		return nil, err
-	}
+// DuplicateDocumentError is returned when an upload is rejected as a duplicate
+type DuplicateDocumentError struct {
+	Existing *models.Document
+}
 
-	return doc, nil
+func (e *DuplicateDocumentError) Error() string {
+	return fmt.Sprintf("document is identical to existing document %q (%s)", e.Existing.Name, e.Existing.ID)
 }
 
-func (s *DocumentService) CreateDocumentFromText(name, content string) (*models.Document, error) {
-	// Create document record from text content
-	doc := &models.Document{
-		ID:         uuid.New(),
-		Name:       name,
-		Content:    content,
-		Type:       "txt",
-		Size:       int64(len(content)),
-		UploadedAt: time.Now(),
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
+type DocumentService struct {
+	db              *gorm.DB
+	blobStore       BlobStore
+	extractors      *ExtractorRegistry
+	tenantID        uuid.UUID
+	duplicatePolicy string
+}
+
+func NewDocumentService(db *gorm.DB, blobStore BlobStore, extractors *ExtractorRegistry, duplicatePolicy string) *DocumentService {
+	return &DocumentService{
+		db:              db,
+		blobStore:       blobStore,
+		extractors:      extractors,
+		duplicatePolicy: duplicatePolicy,
 	}
+}
 
-	// Save to database
-	if err := s.db.Create(doc).Error; err != nil {
-		return nil, err
+// ForTenant returns a copy of the service that only sees and creates the tenant's documents
+func (s *DocumentService) ForTenant(tenantID uuid.UUID) *DocumentService {
+	return &DocumentService{
+		db:              scopeToTenant(s.db, tenantID),
+		blobStore:       s.blobStore,
+		extractors:      s.extractors,
+		tenantID:        tenantID,
+		duplicatePolicy: s.duplicatePolicy,
 	}
+}
 
-	return doc, nil
+func (s *DocumentService) UploadDocument(file *multipart.FileHeader, uploadedBy *uuid.UUID, duplicatePolicy string) (*UploadResult, error) {
+	return s.UploadDocumentWithCategories(file, nil, uploadedBy, duplicatePolicy)
 }
 
-func (s *DocumentService) CreateDocumentFromTextWithCategories(name, content string, categoryIDs []uuid.UUID) (*models.Document, error) {
+func (s *DocumentService) CreateDocumentFromText(name, content string, uploadedBy *uuid.UUID, duplicatePolicy string) (*UploadResult, error) {
+	return s.CreateDocumentFromTextWithCategories(name, content, nil, uploadedBy, duplicatePolicy)
+}
+
+func (s *DocumentService) CreateDocumentFromTextWithCategories(name, content string, categoryIDs []uuid.UUID, uploadedBy *uuid.UUID, duplicatePolicy string) (*UploadResult, error) {
 	// Create document record from text content with categories
 	doc := &models.Document{
 		ID:         uuid.New(),
+		TenantID:   s.tenantID,
 		Name:       name,
 		Content:    content,
 		Type:       "txt",
 		Size:       int64(len(content)),
+		TextHash:   hashContent([]byte(content)),
+		Version:    1,
 		UploadedAt: time.Now(),
 		CreatedAt:  time.Now(),
 		UpdatedAt:  time.Now(),
 	}
 
-	// Save to database
-	if err := s.db.Create(doc).Error; err != nil {
-		return nil, err
-	}
-
-	// Associate categories if provided
-	if len(categoryIDs) > 0 {
-		if err := s.AssignCategoriesToDocument(doc.ID, categoryIDs); err != nil {
-			return nil, err
-		}
-	}
-
-	return doc, nil
+	return s.saveDocument(doc, nil, categoryIDs, uploadedBy, duplicatePolicy)
 }
 
-func (s *DocumentService) UploadDocumentWithCategories(file *multipart.FileHeader, categoryIDs []uuid.UUID) (*models.Document, error) {
-	// Validate file type
+func (s *DocumentService) UploadDocumentWithCategories(file *multipart.FileHeader, categoryIDs []uuid.UUID, uploadedBy *uuid.UUID, duplicatePolicy string) (*UploadResult, error) {
+	// Find the extractor by extension, or by the declared content type for files without one
 	ext := strings.ToLower(filepath.Ext(file.Filename))
-	if ext != ".pdf" && ext != ".docx" && ext != ".txt" {
-		return nil, errors.New("unsupported file type. Only PDF, DOCX, and TXT files are allowed")
+	extractor, ok := s.extractors.Lookup(ext, file.Header.Get("Content-Type"))
+	if !ok {
+		return nil, fmt.Errorf("unsupported file type. Supported types: %s", strings.Join(s.extractors.Extensions(), ", "))
+	}
+	if !slices.Contains(extractor.Extensions(), ext) {
+		ext = extractor.Extensions()[0] // Matched by content type
 	}
 
 	// Open file
@@ -138,46 +143,292 @@ func (s *DocumentService) UploadDocumentWithCategories(file *multipart.FileHeade
 	}
 	defer src.Close()
 
-	// Extract content based on file type
-	var content string
-	switch ext {
-	case ".pdf":
-		content, err = s.extractPDFContent(src)
-	case ".docx":
-		content, err = s.extractDocxContent(src)
-	case ".txt":
-		content, err = s.extractTextContent(src)
+	// Keep the raw bytes, they are hashed to detect re-uploads of the same file
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, err
 	}
 
-	if err != nil {
+	// The document exists while its text is extracted, so the extraction and its failure
+	// show in its ingestion status
+	placeholder := &models.Document{
+		ID:              uuid.New(),
+		TenantID:        s.tenantID,
+		Name:            file.Filename,
+		Type:            strings.TrimPrefix(ext, "."),
+		IngestionStatus: models.DocumentStatusExtracting,
+		Version:         1,
+		UploadedAt:      time.Now(),
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+	}
+	if err := s.db.Create(placeholder).Error; err != nil {
 		return nil, err
 	}
 
-	// Create document record with categories
+	// A partially readable file is kept, with the unreadable parts reported on the document
+	var warnings string
+	content, err := extractor.Extract(data)
+	var partial *PartialExtractionError
+	if errors.As(err, &partial) {
+		warnings = partial.Error()
+		fmt.Printf("Warning: %s: %s\n", file.Filename, warnings)
+	} else if err != nil {
+		placeholder.IngestionStatus = models.DocumentStatusFailed
+		placeholder.IngestionError = err.Error()
+		setDocumentStatus(s.db, placeholder.ID, placeholder.IngestionStatus, map[string]interface{}{
+			"ingestion_error": placeholder.IngestionError,
+		})
+		return nil, &ExtractionError{Document: placeholder, Err: err}
+	}
+
+	content, pageBreaks := splitPageMarkers(content)
+
+	// Keep the original file. Blobs are addressed by content, so re-uploads share one copy.
+	// It is stored by saveDocument, only if the upload creates a document or version.
+	fileHash := hashContent(data)
+	contentType := extractorContentType(extractor)
+	blobKey := fmt.Sprintf("tenants/%s/files/%s%s", s.tenantID, fileHash, ext)
+
+	// Fill in the document record with categories
 	doc := &models.Document{
-		ID:         uuid.New(),
-		Name:       file.Filename,
-		Content:    content,
-		Type:       strings.TrimPrefix(ext, "."),
-		Size:       int64(len(content)),
-		UploadedAt: time.Now(),
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
+		ID:                 placeholder.ID,
+		TenantID:           s.tenantID,
+		Name:               file.Filename,
+		Content:            content,
+		Type:               strings.TrimPrefix(ext, "."),
+		Size:               int64(len(content)),
+		FileHash:           fileHash,
+		TextHash:           hashContent([]byte(content)),
+		BlobKey:            blobKey,
+		ContentType:        contentType,
+		ExtractionWarnings: warnings,
+		PageBreaks:         pageBreaks,
+		IngestionStatus:    models.DocumentStatusExtracting,
+		Version:            1,
+		UploadedAt:         placeholder.UploadedAt,
+		CreatedAt:          placeholder.CreatedAt,
+		UpdatedAt:          time.Now(),
+	}
+
+	result, err := s.saveDocument(doc, data, categoryIDs, uploadedBy, duplicatePolicy)
+	if err != nil {
+		// Nothing was uploaded, rejected duplicates included, unless saving got past the record
+		if err := s.db.Unscoped().Where("ingestion_status = ?", models.DocumentStatusExtracting).
+			Delete(&models.Document{}, "id = ?", doc.ID).Error; err != nil {
+			log.Printf("Failed to remove placeholder of document %s: %v", doc.ID, err)
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// saveDocument creates a document with its first version, unless the tenant already has one
+// with the same file or extracted text, in which case the duplicate policy decides. The
+// original file, if any, is stored under doc.BlobKey once the document or version is created.
+// A document in the extracting status replaces its placeholder record, which is removed if
+// the upload resolves to an existing document.
+func (s *DocumentService) saveDocument(doc *models.Document, data []byte, categoryIDs []uuid.UUID, uploadedBy *uuid.UUID, duplicatePolicy string) (*UploadResult, error) {
+	if duplicatePolicy == "" {
+		duplicatePolicy = s.duplicatePolicy
 	}
+	if !IsValidDuplicatePolicy(duplicatePolicy) {
+		return nil, fmt.Errorf("invalid duplicate_policy %q, expected reject, return_existing or new_version", duplicatePolicy)
+	}
+
+	result := &UploadResult{Document: doc, Outcome: UploadOutcomeCreated}
+	blobStored := false
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Serialize uploads of the same text within the tenant so concurrent duplicates are caught
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", s.tenantID.String()+doc.TextHash).Error; err != nil {
+			return err
+		}
+
+		existing, err := findDuplicateDocument(tx, doc)
+		if err != nil {
+			return err
+		}
+
+		if existing == nil {
+			if err := s.putDocumentBlob(tx, doc, data); err != nil {
+				return err
+			}
+			blobStored = doc.BlobKey != ""
+			if doc.IngestionStatus == models.DocumentStatusExtracting {
+				doc.IngestionStatus = models.DocumentStatusPending
+				if err := tx.Save(doc).Error; err != nil {
+					return err
+				}
+			} else if err := tx.Create(doc).Error; err != nil {
+				return err
+			}
+			return tx.Create(newDocumentVersion(doc, uploadedBy, "")).Error
+		}
+
+		if doc.IngestionStatus == models.DocumentStatusExtracting {
+			if err := tx.Unscoped().Delete(&models.Document{}, "id = ?", doc.ID).Error; err != nil {
+				return err
+			}
+		}
 
-	// Save to database
-	if err := s.db.Create(doc).Error; err != nil {
+		switch duplicatePolicy {
+		case DuplicatePolicyReturnExisting:
+			result.Document, result.Outcome = existing, UploadOutcomeExisting
+			return nil
+		case DuplicatePolicyNewVersion:
+			result.Document, result.Outcome = existing, UploadOutcomeNewVersion
+			if err := s.putDocumentBlob(tx, doc, data); err != nil {
+				return err
+			}
+			blobStored = doc.BlobKey != ""
+			_, err := addDocumentVersion(tx, existing.ID, func(current *models.Document) {
+				current.Name = doc.Name
+				current.Type = doc.Type
+				current.Content = doc.Content
+				current.FileHash = doc.FileHash
+				current.TextHash = doc.TextHash
+				current.BlobKey = doc.BlobKey
+				current.ContentType = doc.ContentType
+				current.ExtractionWarnings = doc.ExtractionWarnings
+				current.PageBreaks = doc.PageBreaks
+			}, uploadedBy, "Replaced by a duplicate upload")
+			return err
+		default:
+			return &DuplicateDocumentError{Existing: existing}
+		}
+	})
+	if err != nil {
+		// The blob may be new, with nothing left referring to it after the rollback
+		if blobStored {
+			s.deleteUnreferencedBlob(doc.BlobKey)
+		}
 		return nil, err
 	}
 
+	if result.Outcome == UploadOutcomeExisting {
+		return result, nil
+	}
+
 	// Associate categories if provided
 	if len(categoryIDs) > 0 {
-		if err := s.AssignCategoriesToDocument(doc.ID, categoryIDs); err != nil {
+		if err := s.AssignCategoriesToDocument(result.Document.ID, categoryIDs); err != nil {
 			return nil, err
 		}
 	}
 
-	return doc, nil
+	if result.Outcome == UploadOutcomeNewVersion {
+		if result.Document, err = s.GetDocument(result.Document.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// findDuplicateDocument returns the oldest document with the same raw file or extracted text
+// as doc, or nil. Empty texts, such as scanned PDFs without a text layer, only match by file.
+func findDuplicateDocument(tx *gorm.DB, doc *models.Document) (*models.Document, error) {
+	var existing models.Document
+	err := tx.Where("id <> ? AND ingestion_status <> ?", doc.ID, models.DocumentStatusExtracting).
+		Where("((file_hash <> '' AND file_hash = ?) OR (? AND text_hash = ?))",
+			doc.FileHash, strings.TrimSpace(doc.Content) != "", doc.TextHash).
+		Order("created_at ASC").
+		First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+// OpenDocumentFile opens the original uploaded file of a document and returns its size,
+// or ErrBlobNotFound for documents created from text
+func (s *DocumentService) OpenDocumentFile(doc *models.Document) (io.ReadCloser, int64, error) {
+	if doc.BlobKey == "" {
+		return nil, 0, ErrBlobNotFound
+	}
+	return s.blobStore.Get(doc.BlobKey)
+}
+
+// putDocumentBlob stores the original file of a document being saved in tx. The blob key
+// stays locked until tx ends, so deleteUnreferencedBlob cannot remove the blob before the
+// document referring to it is committed.
+func (s *DocumentService) putDocumentBlob(tx *gorm.DB, doc *models.Document, data []byte) error {
+	if doc.BlobKey == "" {
+		return nil
+	}
+	if err := lockBlobKey(tx, doc.BlobKey); err != nil {
+		return err
+	}
+	if err := s.blobStore.Put(doc.BlobKey, data, doc.ContentType); err != nil {
+		return fmt.Errorf("failed to store original file: %w", err)
+	}
+	return nil
+}
+
+// deleteUnreferencedBlob removes the blob stored under key unless a version of a document
+// still refers to it. Blobs are addressed by content, so documents and versions with the
+// same file share one. Failures only leave the blob behind, so they are logged.
+func (s *DocumentService) deleteUnreferencedBlob(key string) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockBlobKey(tx, key); err != nil {
+			return err
+		}
+
+		// Every document's current file is also recorded in its latest version
+		var references int64
+		if err := tx.Raw(`
+			SELECT COUNT(*) FROM document_versions v
+			JOIN documents d ON d.id = v.document_id AND d.deleted_at IS NULL
+			WHERE v.blob_key = ?
+		`, key).Scan(&references).Error; err != nil {
+			return err
+		}
+		if references > 0 {
+			return nil
+		}
+		return s.blobStore.Delete(key)
+	})
+	if err != nil {
+		fmt.Printf("Warning: failed to delete blob %s: %v\n", key, err)
+	}
+}
+
+// lockBlobKey serializes storing and deleting the blob under key until tx ends
+func lockBlobKey(tx *gorm.DB, key string) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "blob:"+key).Error
+}
+
+// hashContent returns the hex SHA-256 of data
+func hashContent(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// newDocumentVersion snapshots the document's current content as its version doc.Version
+func newDocumentVersion(doc *models.Document, uploadedBy *uuid.UUID, note string) *models.DocumentVersion {
+	return &models.DocumentVersion{
+		ID:                 uuid.New(),
+		TenantID:           doc.TenantID,
+		DocumentID:         doc.ID,
+		Version:            doc.Version,
+		Name:               doc.Name,
+		Type:               doc.Type,
+		Content:            doc.Content,
+		Size:               doc.Size,
+		FileHash:           doc.FileHash,
+		TextHash:           doc.TextHash,
+		BlobKey:            doc.BlobKey,
+		ContentType:        doc.ContentType,
+		ExtractionWarnings: doc.ExtractionWarnings,
+		PageBreaks:         doc.PageBreaks,
+		UploadedByID:       uploadedBy,
+		Note:               note,
+		CreatedAt:          time.Now(),
+	}
 }
 
 func (s *DocumentService) GetDocument(id uuid.UUID) (*models.Document, error) {
@@ -236,7 +487,39 @@ func (s *DocumentService) GetDocumentsByCategory(categoryID uuid.UUID) ([]models
 	return docs, nil
 }
 
+// GetIngestionStatuses returns the ingestion progress of the given documents
+func (s *DocumentService) GetIngestionStatuses(ids []uuid.UUID) ([]models.DocumentIngestionStatus, error) {
+	var statuses []models.DocumentIngestionStatus
+	if err := s.db.Model(&models.Document{}).
+		Select("id AS document_id, name, ingestion_status AS status, ingestion_error AS error, chunks_processed, chunks_total, embedding_texts, embedding_tokens, embedding_cache_hits").
+		Where("id IN ?", ids).
+		Scan(&statuses).Error; err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
 func (s *DocumentService) AssignCategoriesToDocument(documentID uuid.UUID, categoryIDs []uuid.UUID) error {
+	// Only the tenant's own documents and categories can be linked
+	var docCount int64
+	if err := s.db.Model(&models.Document{}).Where("id = ?", documentID).Count(&docCount).Error; err != nil {
+		return err
+	}
+	if docCount == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	categoryIDs = uniqueIDs(categoryIDs)
+	if len(categoryIDs) > 0 {
+		var count int64
+		if err := s.db.Model(&models.Category{}).Where("id IN ?", categoryIDs).Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) != len(categoryIDs) {
+			return errors.New("one or more categories do not exist")
+		}
+	}
+
 	// First, remove existing associations
 	if err := s.db.Where("document_id = ?", documentID).Delete(&models.DocumentCategory{}).Error; err != nil {
 		return err
@@ -247,6 +530,7 @@ func (s *DocumentService) AssignCategoriesToDocument(documentID uuid.UUID, categ
 		docCategory := &models.DocumentCategory{
 			DocumentID: documentID,
 			CategoryID: categoryID,
+			TenantID:   s.tenantID,
 			CreatedAt:  time.Now(),
 		}
 		if err := s.db.Create(docCategory).Error; err != nil {
@@ -268,6 +552,14 @@ func (s *DocumentService) GetDocumentCategories(documentID uuid.UUID) ([]models.
 }
 
 func (s *DocumentService) DeleteDocument(id uuid.UUID) error {
+	// Original files of the document and its versions, deleted with it unless shared
+	var blobKeys []string
+	if err := s.db.Model(&models.DocumentVersion{}).
+		Where("document_id = ? AND blob_key <> ''", id).
+		Distinct().Pluck("blob_key", &blobKeys).Error; err != nil {
+		return err
+	}
+
 	// Delete document chunks first
 	if err := s.db.Where("document_id = ?", id).Delete(&models.DocumentChunk{}).Error; err != nil {
 		return err
@@ -283,94 +575,166 @@ func (s *DocumentService) DeleteDocument(id uuid.UUID) error {
 		return err
 	}
 
+	for _, key := range blobKeys {
+		s.deleteUnreferencedBlob(key)
+	}
+
 	return nil
 }
 
-func (s *DocumentService) UpdateDocument(id uuid.UUID, content string) error {
-	// Delete existing chunks first
-	if err := s.db.Where("document_id = ?", id).Delete(&models.DocumentChunk{}).Error; err != nil {
-		return err
+// UpdateDocument replaces the document's content with a new version, whose chunks must be
+// re-embedded. Previous versions are kept.
+func (s *DocumentService) UpdateDocument(id uuid.UUID, content string, uploadedBy *uuid.UUID) (*models.DocumentVersion, error) {
+	return s.addVersion(id, func(doc *models.Document) {
+		doc.Content = content
+		doc.FileHash = "" // Edited text no longer matches an uploaded file
+		doc.TextHash = hashContent([]byte(content))
+		doc.BlobKey = ""
+		doc.ContentType = ""
+		doc.ExtractionWarnings = ""
+		doc.PageBreaks = "" // Page boundaries of the file no longer apply
+	}, uploadedBy, "")
+}
+
+// RollbackDocument restores the content of an earlier version as a new version, whose
+// chunks must be re-embedded
+func (s *DocumentService) RollbackDocument(id uuid.UUID, version int, uploadedBy *uuid.UUID) (*models.DocumentVersion, error) {
+	target, err := s.GetDocumentVersion(id, version)
+	if err != nil {
+		return nil, err
 	}
+	return s.addVersion(id, func(doc *models.Document) {
+		doc.Name = target.Name
+		doc.Type = target.Type
+		doc.Content = target.Content
+		doc.FileHash = target.FileHash
+		doc.TextHash = target.TextHash
+		doc.BlobKey = target.BlobKey
+		doc.ContentType = target.ContentType
+		doc.ExtractionWarnings = target.ExtractionWarnings
+		doc.PageBreaks = target.PageBreaks
+	}, uploadedBy, fmt.Sprintf("Rolled back to version %d", version))
+}
 
-	// Update document content and timestamp
-	if err := s.db.Model(&models.Document{}).Where("id = ?", id).Updates(map[string]interface{}{
-		"content":    content,
-		"updated_at": time.Now(),
-	}).Error; err != nil {
+// addVersion applies a change to the document as its next version, recording it in its history
+func (s *DocumentService) addVersion(id uuid.UUID, apply func(doc *models.Document), uploadedBy *uuid.UUID, note string) (*models.DocumentVersion, error) {
+	var version *models.DocumentVersion
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		version, err = addDocumentVersion(tx, id, apply, uploadedBy, note)
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-
-	return nil
+	return version, nil
 }
 
-func (s *DocumentService) extractPDFContent(reader io.Reader) (string, error) {
-	// Read all data into memory
-	data, err := io.ReadAll(reader)
-	if err != nil {
-		return "", err
+// addDocumentVersion is addVersion within the caller's transaction
+func addDocumentVersion(tx *gorm.DB, id uuid.UUID, apply func(doc *models.Document), uploadedBy *uuid.UUID, note string) (*models.DocumentVersion, error) {
+	// Lock the document so concurrent updates get consecutive version numbers
+	var doc models.Document
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&doc, "id = ?", id).Error; err != nil {
+		return nil, err
 	}
 
-	// Create a bytes reader that implements io.ReaderAt
-	bytesReader := bytes.NewReader(data)
+	apply(&doc)
+	doc.Size = int64(len(doc.Content))
+	doc.Version++
+	doc.UpdatedAt = time.Now()
 
-	pdfReader, err := pdf.NewReader(bytesReader, int64(len(data)))
-	if err != nil {
-		return "", err
+	version := newDocumentVersion(&doc, uploadedBy, note)
+	if err := tx.Create(version).Error; err != nil {
+		return nil, err
 	}
 
-	var content strings.Builder
-	numPages := pdfReader.NumPage()
-
-	for i := 1; i <= numPages; i++ {
-		page := pdfReader.Page(i)
-		if page.V.IsNull() {
-			continue
-		}
+	if err := tx.Model(&models.Document{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"name":                doc.Name,
+		"type":                doc.Type,
+		"content":             doc.Content,
+		"size":                doc.Size,
+		"file_hash":           doc.FileHash,
+		"text_hash":           doc.TextHash,
+		"blob_key":            doc.BlobKey,
+		"content_type":        doc.ContentType,
+		"extraction_warnings": doc.ExtractionWarnings,
+		"page_breaks":         doc.PageBreaks,
+		"version":             doc.Version,
+		"updated_at":          doc.UpdatedAt,
+	}).Error; err != nil {
+		return nil, err
+	}
 
-		text, err := page.GetPlainText(nil)
-		if err != nil {
-			continue // Skip pages with extraction errors
-		}
+	// The old chunks stay searchable until the re-embedding job replaces them at once, so
+	// a document is never left without chunks if that job cannot be queued
+	return version, nil
+}
 
-		content.WriteString(text)
-		content.WriteString("\n")
+// GetDocumentVersions lists a document's versions, newest first, without their content
+func (s *DocumentService) GetDocumentVersions(documentID uuid.UUID) ([]models.DocumentVersion, error) {
+	var versions []models.DocumentVersion
+	if err := s.db.Omit("content").Preload("UploadedBy").
+		Where("document_id = ?", documentID).
+		Order("version DESC").
+		Find(&versions).Error; err != nil {
+		return nil, err
 	}
+	return versions, nil
+}
 
-	return content.String(), nil
+// GetDocumentVersion retrieves one version of a document with its content
+func (s *DocumentService) GetDocumentVersion(documentID uuid.UUID, version int) (*models.DocumentVersion, error) {
+	var v models.DocumentVersion
+	if err := s.db.Preload("UploadedBy").
+		First(&v, "document_id = ? AND version = ?", documentID, version).Error; err != nil {
+		return nil, err
+	}
+	return &v, nil
 }
 
-func (s *DocumentService) extractDocxContent(reader io.Reader) (string, error) {
-	// Read all data into memory
-	data, err := io.ReadAll(reader)
+// DiffDocumentVersions compares two versions of a document line by line
+func (s *DocumentService) DiffDocumentVersions(documentID uuid.UUID, fromVersion, toVersion int) (*models.DocumentDiff, error) {
+	from, err := s.GetDocumentVersion(documentID, fromVersion)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	to, err := s.GetDocumentVersion(documentID, toVersion)
+	if err != nil {
+		return nil, err
 	}
 
-	// Create a bytes reader that implements io.ReaderAt
-	bytesReader := bytes.NewReader(data)
-
-	doc, err := document.Read(bytesReader, int64(len(data)))
+	lines, err := diffLines(from.Content, to.Content)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer doc.Close()
 
-	var content strings.Builder
-	for _, para := range doc.Paragraphs() {
-		for _, run := range para.Runs() {
-			content.WriteString(run.Text())
+	diff := &models.DocumentDiff{
+		DocumentID:  documentID,
+		FromVersion: fromVersion,
+		ToVersion:   toVersion,
+		Lines:       lines,
+	}
+	for _, line := range lines {
+		switch line.Op {
+		case models.DiffInsert:
+			diff.Added++
+		case models.DiffDelete:
+			diff.Removed++
 		}
-		content.WriteString("\n")
 	}
 
-	return content.String(), nil
+	return diff, nil
 }
 
-func (s *DocumentService) extractTextContent(reader io.Reader) (string, error) {
-	data, err := io.ReadAll(reader)
-	if err != nil {
-		return "", err
+// uniqueIDs returns ids without duplicates, keeping their order
+func uniqueIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	unique := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
 	}
-
-	return string(data), nil
+	return unique
 }
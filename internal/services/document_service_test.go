@@ -0,0 +1,137 @@
+package services
+
+import (
+	"company-ai-training/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// dryRunDB returns a database that builds queries without running them, and the SQL of
+// every query and statement it was asked for
+func dryRunDB(t *testing.T) (*gorm.DB, *[]string) {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 sslmode=disable"}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var queries []string
+	capture := func(tx *gorm.DB) {
+		queries = append(queries, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+	}
+	db.Callback().Query().After("gorm:query").Register("test:capture", capture)
+	db.Callback().Raw().After("gorm:raw").Register("test:capture", capture)
+	db.Callback().Delete().After("gorm:delete").Register("test:capture", capture)
+	return db, &queries
+}
+
+func TestIsValidDuplicatePolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   bool
+	}{
+		{"", true},
+		{DuplicatePolicyReject, true},
+		{DuplicatePolicyReturnExisting, true},
+		{DuplicatePolicyNewVersion, true},
+		{"overwrite", false},
+		{"Reject", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsValidDuplicatePolicy(tt.policy); got != tt.want {
+			t.Errorf("IsValidDuplicatePolicy(%q) = %v, want %v", tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestHashContent(t *testing.T) {
+	// SHA-256 of "abc" from FIPS 180-2
+	if got := hashContent([]byte("abc")); got != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("hashContent(abc) = %s", got)
+	}
+	if hashContent([]byte("Nghỉ phép")) == hashContent([]byte("Nghỉ phép ")) {
+		t.Error("hashContent() ignores a trailing space")
+	}
+}
+
+func TestFindDuplicateDocumentQuery(t *testing.T) {
+	tenantID, docID := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name    string
+		doc     models.Document
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "matches by file or text",
+			doc:  models.Document{ID: docID, FileHash: "file-hash", TextHash: "text-hash", Content: "Nghỉ phép năm"},
+			want: []string{
+				`"documents"."tenant_id" = '` + tenantID.String() + `'`,
+				`id <> '` + docID.String() + `'`,
+				`ingestion_status <> 'extracting'`,
+				`(file_hash <> '' AND file_hash = 'file-hash') OR (true AND text_hash = 'text-hash')`,
+				`"documents"."deleted_at" IS NULL`,
+				`ORDER BY created_at ASC`,
+			},
+		},
+		{
+			name: "empty text only matches by file",
+			doc:  models.Document{ID: docID, FileHash: "file-hash", TextHash: hashContent(nil), Content: "  \n"},
+			want: []string{`(false AND text_hash = '` + hashContent(nil) + `')`},
+		},
+		{
+			name:    "text input without a file",
+			doc:     models.Document{ID: docID, TextHash: "text-hash", Content: "Nghỉ phép năm"},
+			want:    []string{`(file_hash <> '' AND file_hash = '')`, `(true AND text_hash = 'text-hash')`},
+			notWant: []string{`file_hash = 'file-hash'`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, queries := dryRunDB(t)
+			if _, err := findDuplicateDocument(scopeToTenant(db, tenantID), &tt.doc); err != nil {
+				t.Fatalf("findDuplicateDocument() error = %v", err)
+			}
+			if len(*queries) != 1 {
+				t.Fatalf("queries = %q, want one", *queries)
+			}
+			query := (*queries)[0]
+			for _, part := range tt.want {
+				if !strings.Contains(query, part) {
+					t.Errorf("query %s\ndoes not contain %s", query, part)
+				}
+			}
+			for _, part := range tt.notWant {
+				if strings.Contains(query, part) {
+					t.Errorf("query %s\ncontains %s", query, part)
+				}
+			}
+		})
+	}
+}
+
+func TestSaveDocumentRejectsUnknownPolicy(t *testing.T) {
+	service := &DocumentService{duplicatePolicy: DuplicatePolicyReject}
+	doc := &models.Document{ID: uuid.New(), Name: "a.txt", Content: "a"}
+
+	if _, err := service.saveDocument(doc, nil, nil, nil, "overwrite"); err == nil || !strings.Contains(err.Error(), "invalid duplicate_policy") {
+		t.Errorf("saveDocument() error = %v, want an invalid duplicate_policy error", err)
+	}
+}
+
+func TestDuplicateDocumentError(t *testing.T) {
+	existing := &models.Document{ID: uuid.MustParse("4b5b3e55-8c1c-4f39-9a43-7d3f2f2a1b10"), Name: "Sổ tay.pdf"}
+	err := &DuplicateDocumentError{Existing: existing}
+
+	want := `document is identical to existing document "Sổ tay.pdf" (4b5b3e55-8c1c-4f39-9a43-7d3f2f2a1b10)`
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
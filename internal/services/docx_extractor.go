@@ -0,0 +1,336 @@
+package services
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/unidoc/unioffice/document"
+	"github.com/unidoc/unioffice/schema/soo/wml"
+)
+
+// maxStyleDepth bounds the walk up a style's basedOn chain
+const maxStyleDepth = 10
+
+// DOCXExtractor converts Word documents to Markdown, keeping heading levels, numbered
+// and bulleted lists and tables so that chunking and the model can use the structure
+type DOCXExtractor struct{}
+
+func (e *DOCXExtractor) Extensions() []string { return []string{".docx"} }
+func (e *DOCXExtractor) MIMETypes() []string {
+	return []string{"application/vnd.openxmlformats-officedocument.wordprocessingml.document"}
+}
+
+func (e *DOCXExtractor) Extract(data []byte) (string, error) {
+	doc, err := document.Read(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	defer doc.Close()
+
+	return docxToMarkdown(doc), nil
+}
+
+// docxToMarkdown renders the body of a Word document as Markdown
+func docxToMarkdown(doc *document.Document) string {
+	body := doc.X().Body
+	if body == nil {
+		return ""
+	}
+
+	writer := &docxMarkdownWriter{doc: doc, listCounters: make(map[int64][]int)}
+	forEachDocxBlock(body.EG_BlockLevelElts, func(p *wml.CT_P, tbl *wml.CT_Tbl) {
+		if p != nil {
+			writer.writeParagraph(p)
+		} else {
+			writer.writeTable(tbl)
+		}
+	})
+
+	if writer.content.Len() == 0 {
+		return ""
+	}
+	return writer.content.String() + "\n"
+}
+
+// docxMarkdownWriter renders the body of a Word document block by block
+type docxMarkdownWriter struct {
+	doc     *document.Document
+	content strings.Builder
+	inList  bool
+	// listCounters holds the current item number of every level of each numbering instance
+	listCounters map[int64][]int
+}
+
+// startBlock separates a new block from the previous one. Consecutive list items stay
+// on adjacent lines so that they form a single Markdown list.
+func (w *docxMarkdownWriter) startBlock(listItem bool) {
+	if w.content.Len() > 0 {
+		if listItem && w.inList {
+			w.content.WriteString("\n")
+		} else {
+			w.content.WriteString("\n\n")
+		}
+	}
+	w.inList = listItem
+}
+
+func (w *docxMarkdownWriter) writeParagraph(p *wml.CT_P) {
+	text := strings.TrimSpace(docxParagraphText(p))
+	if text == "" {
+		return
+	}
+
+	if level := w.headingLevel(p); level > 0 {
+		w.startBlock(false)
+		w.content.WriteString(strings.Repeat("#", level) + " " + collapseSpaces(text))
+		return
+	}
+
+	if numID, level, ok := w.numbering(p); ok {
+		w.startBlock(true)
+		w.content.WriteString(strings.Repeat("   ", int(level)) + w.listMarker(numID, level) + " " + collapseSpaces(text))
+		return
+	}
+
+	w.startBlock(false)
+	w.content.WriteString(text)
+}
+
+// headingLevel returns the Markdown heading level of a paragraph styled as a title or
+// heading, directly or through the styles it is based on, and 0 otherwise
+func (w *docxMarkdownWriter) headingLevel(p *wml.CT_P) int {
+	if p.PPr == nil || p.PPr.PStyle == nil {
+		return 0
+	}
+
+	for _, style := range w.styleChain(p.PPr.PStyle.ValAttr) {
+		if style.Name == nil {
+			continue
+		}
+		name := strings.ToLower(style.Name.ValAttr)
+		if name == "title" {
+			return 1
+		}
+		if digits, ok := strings.CutPrefix(name, "heading "); ok {
+			if level, err := strconv.Atoi(digits); err == nil && level > 0 {
+				return min(level, 6)
+			}
+		}
+	}
+	return 0
+}
+
+// numbering returns the numbering instance and level of a list paragraph, set on the
+// paragraph itself or inherited from its style, such as "List Bullet"
+func (w *docxMarkdownWriter) numbering(p *wml.CT_P) (int64, int64, bool) {
+	if p.PPr == nil {
+		return 0, 0, false
+	}
+
+	numPr := p.PPr.NumPr
+	if numPr == nil && p.PPr.PStyle != nil {
+		for _, style := range w.styleChain(p.PPr.PStyle.ValAttr) {
+			if style.PPr != nil && style.PPr.NumPr != nil {
+				numPr = style.PPr.NumPr
+				break
+			}
+		}
+	}
+
+	// Numbering instance 0 explicitly removes the numbering
+	if numPr == nil || numPr.NumId == nil || numPr.NumId.ValAttr == 0 {
+		return 0, 0, false
+	}
+
+	var level int64
+	if numPr.Ilvl != nil {
+		level = max(numPr.Ilvl.ValAttr, 0)
+	}
+	return numPr.NumId.ValAttr, level, true
+}
+
+// listMarker returns "-" for bulleted levels and the item number, e.g. "3.", for numbered ones
+func (w *docxMarkdownWriter) listMarker(numID, level int64) string {
+	lvl := w.doc.GetNumberingLevelByIds(numID, level).X()
+	if lvl == nil || lvl.NumFmt == nil || lvl.NumFmt.ValAttr == wml.ST_NumberFormatBullet ||
+		lvl.NumFmt.ValAttr == wml.ST_NumberFormatNone {
+		return "-"
+	}
+
+	counters := w.listCounters[numID]
+	for int64(len(counters)) <= level {
+		counters = append(counters, 0)
+	}
+	if counters[level] == 0 && lvl.Start != nil {
+		counters[level] = int(lvl.Start.ValAttr) - 1
+	}
+	counters[level]++
+	// Deeper levels restart after an item of their parent level
+	for i := level + 1; i < int64(len(counters)); i++ {
+		counters[i] = 0
+	}
+	w.listCounters[numID] = counters
+
+	return strconv.Itoa(counters[level]) + "."
+}
+
+// styleChain returns the style with the given ID followed by the styles it is based on
+func (w *docxMarkdownWriter) styleChain(styleID string) []*wml.CT_Style {
+	var chain []*wml.CT_Style
+	for styleID != "" && len(chain) < maxStyleDepth {
+		style := w.doc.GetStyleByID(styleID).X()
+		if style == nil {
+			break
+		}
+		chain = append(chain, style)
+
+		styleID = ""
+		if style.BasedOn != nil {
+			styleID = style.BasedOn.ValAttr
+		}
+	}
+	return chain
+}
+
+// writeTable renders a table as a Markdown table with its first row as the header.
+// Merged cells are expanded so every row keeps one value per column.
+func (w *docxMarkdownWriter) writeTable(tbl *wml.CT_Tbl) {
+	rows := docxTableRows(tbl)
+
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	if width == 0 {
+		return
+	}
+
+	w.startBlock(false)
+	for i, row := range rows {
+		cells := make([]string, width)
+		for j, value := range row {
+			cells[j] = strings.ReplaceAll(value, "|", "\\|")
+		}
+
+		if i > 0 {
+			w.content.WriteString("\n")
+		}
+		w.content.WriteString("| " + strings.Join(cells, " | ") + " |")
+		if i == 0 {
+			w.content.WriteString("\n|" + strings.Repeat(" --- |", width))
+		}
+	}
+}
+
+// docxTableRows returns the text of every cell of a table. Cells spanning several grid
+// columns are followed by empty cells, and vertically merged cells repeat the value of
+// the cell they continue so that each row can be read on its own.
+func docxTableRows(tbl *wml.CT_Tbl) [][]string {
+	var rows [][]string
+	for _, rowContent := range tbl.EG_ContentRowContent {
+		for _, tr := range rowContent.Tr {
+			var row []string
+			for _, cellContent := range tr.EG_ContentCellContent {
+				for _, tc := range cellContent.Tc {
+					text := docxCellText(tc)
+
+					span := 1
+					if tc.TcPr != nil {
+						if tc.TcPr.GridSpan != nil && tc.TcPr.GridSpan.ValAttr > 1 {
+							span = int(tc.TcPr.GridSpan.ValAttr)
+						}
+						vMerge := tc.TcPr.VMerge
+						if vMerge != nil && vMerge.ValAttr != wml.ST_MergeRestart && len(rows) > 0 {
+							if above := rows[len(rows)-1]; len(row) < len(above) {
+								text = above[len(row)]
+							}
+						}
+					}
+
+					row = append(row, text)
+					for i := 1; i < span; i++ {
+						row = append(row, "")
+					}
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// docxCellText returns the text of a table cell on one line, including nested tables
+func docxCellText(tc *wml.CT_Tc) string {
+	var parts []string
+	forEachDocxBlock(tc.EG_BlockLevelElts, func(p *wml.CT_P, tbl *wml.CT_Tbl) {
+		if p != nil {
+			parts = append(parts, docxParagraphText(p))
+			return
+		}
+		for _, row := range docxTableRows(tbl) {
+			parts = append(parts, row...)
+		}
+	})
+	return collapseSpaces(strings.Join(parts, " "))
+}
+
+// forEachDocxBlock calls visit with every paragraph and table in document order,
+// descending into content controls
+func forEachDocxBlock(elts []*wml.EG_BlockLevelElts, visit func(p *wml.CT_P, tbl *wml.CT_Tbl)) {
+	for _, elt := range elts {
+		for _, content := range elt.EG_ContentBlockContent {
+			visitDocxBlocks(content.P, content.Tbl, content.Sdt, visit)
+		}
+	}
+}
+
+func visitDocxBlocks(paragraphs []*wml.CT_P, tables []*wml.CT_Tbl, sdt *wml.CT_SdtBlock, visit func(p *wml.CT_P, tbl *wml.CT_Tbl)) {
+	if sdt != nil && sdt.SdtContent != nil {
+		visitDocxBlocks(sdt.SdtContent.P, sdt.SdtContent.Tbl, sdt.SdtContent.Sdt, visit)
+	}
+	for _, p := range paragraphs {
+		visit(p, nil)
+	}
+	for _, tbl := range tables {
+		visit(nil, tbl)
+	}
+}
+
+// docxParagraphText concatenates the runs of a paragraph, including hyperlinks and inline content controls
+func docxParagraphText(p *wml.CT_P) string {
+	var text strings.Builder
+	for _, content := range p.EG_PContent {
+		if content.Hyperlink != nil {
+			writeDocxRuns(&text, content.Hyperlink.EG_ContentRunContent)
+		}
+		writeDocxRuns(&text, content.EG_ContentRunContent)
+	}
+	return text.String()
+}
+
+func writeDocxRuns(text *strings.Builder, runs []*wml.EG_ContentRunContent) {
+	for _, run := range runs {
+		if run.Sdt != nil && run.Sdt.SdtContent != nil {
+			writeDocxRuns(text, run.Sdt.SdtContent.EG_ContentRunContent)
+		}
+		if run.R == nil {
+			continue
+		}
+		for _, inner := range run.R.EG_RunInnerContent {
+			switch {
+			case inner.T != nil:
+				text.WriteString(inner.T.Content)
+			case inner.Tab != nil:
+				text.WriteString("\t")
+			case inner.Br != nil, inner.Cr != nil:
+				text.WriteString("\n")
+			}
+		}
+	}
+}
+
+// collapseSpaces joins the words of s with single spaces, for text that must stay on one line
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/unidoc/unioffice/document"
+	"github.com/unidoc/unioffice/schema/soo/wml"
+)
+
+func TestDocxToMarkdownHeadings(t *testing.T) {
+	doc := document.New()
+	// A custom style counts as a heading through the style it is based on
+	chapter := doc.Styles.AddStyle("ChapterHeading", wml.ST_StyleTypeParagraph, false)
+	chapter.SetName("Chapter Heading")
+	chapter.SetBasedOn("Heading2")
+
+	for _, p := range []struct{ style, text string }{
+		{"Title", "Sổ tay nhân viên"},
+		{"Heading1", "Phần 1   Quy định chung"},
+		{"ChapterHeading", "Chương 1"},
+		{"", "Nhân viên làm việc\ttừ thứ Hai đến thứ Sáu."},
+		{"Heading3", "   "},
+		{"Normal", "Giờ làm việc: 8:00 - 17:00."},
+	} {
+		para := doc.AddParagraph()
+		if p.style != "" {
+			para.SetStyle(p.style)
+		}
+		para.AddRun().AddText(p.text)
+	}
+
+	want := "# Sổ tay nhân viên\n\n" +
+		"# Phần 1 Quy định chung\n\n" +
+		"## Chương 1\n\n" +
+		"Nhân viên làm việc\ttừ thứ Hai đến thứ Sáu.\n\n" +
+		"Giờ làm việc: 8:00 - 17:00.\n"
+	if got := docxToMarkdown(doc); got != want {
+		t.Errorf("docxToMarkdown() = %q, want %q", got, want)
+	}
+}
+
+func TestDocxToMarkdownLists(t *testing.T) {
+	doc := document.New()
+	steps := doc.Numbering.AddDefinition()
+	steps.AddLevel().SetFormat(wml.ST_NumberFormatDecimal)
+	steps.AddLevel().SetFormat(wml.ST_NumberFormatBullet)
+	sub := steps.AddLevel()
+	sub.SetFormat(wml.ST_NumberFormatDecimal)
+	sub.X().Start = &wml.CT_DecimalNumber{ValAttr: 3}
+
+	item := func(text string, level int) document.Paragraph {
+		para := doc.AddParagraph()
+		para.SetNumberingDefinition(steps)
+		para.SetNumberingLevel(level)
+		para.AddRun().AddText(text)
+		return para
+	}
+
+	doc.AddParagraph().AddRun().AddText("Thủ tục xin nghỉ phép:")
+	first := item("Gửi đơn", 0)
+	item("qua email", 1)
+	item("Mẫu A", 2)
+	item("Mẫu B", 2)
+	item("Chờ duyệt", 0)
+	item("Mẫu C", 2)
+	// Numbering instance 0 turns the numbering of a paragraph off
+	item("Ghi chú", 0).X().PPr.NumPr.NumId.ValAttr = 0
+
+	// A list style numbers its paragraphs without numbering of their own
+	listStyle := doc.Styles.AddStyle("ListSteps", wml.ST_StyleTypeParagraph, false)
+	listStyle.SetName("List Steps")
+	listStyle.X().PPr = &wml.CT_PPrGeneral{NumPr: &wml.CT_NumPr{
+		NumId: &wml.CT_DecimalNumber{ValAttr: first.X().PPr.NumPr.NumId.ValAttr},
+	}}
+	styled := doc.AddParagraph()
+	styled.SetStyle("ListSteps")
+	styled.AddRun().AddText("Nhận kết quả")
+
+	want := "Thủ tục xin nghỉ phép:\n\n" +
+		"1. Gửi đơn\n" +
+		"   - qua email\n" +
+		"      3. Mẫu A\n" +
+		"      4. Mẫu B\n" +
+		"2. Chờ duyệt\n" +
+		"      3. Mẫu C\n\n" +
+		"Ghi chú\n\n" +
+		"3. Nhận kết quả\n"
+	if got := docxToMarkdown(doc); got != want {
+		t.Errorf("docxToMarkdown() = %q, want %q", got, want)
+	}
+}
+
+func TestDocxToMarkdownTables(t *testing.T) {
+	doc := document.New()
+	doc.AddParagraph().AddRun().AddText("Bảng phép năm")
+
+	table := doc.AddTable()
+	addRow := func(cells ...string) document.Row {
+		row := table.AddRow()
+		for _, text := range cells {
+			row.AddCell().AddParagraph().AddRun().AddText(text)
+		}
+		return row
+	}
+	addRow("Thâm niên", "Số ngày", "Ghi chú")
+	spanned := addRow("Dưới 5 năm", "12 | 14")
+	spanned.Cells()[1].Properties().SetColumnSpan(2)
+	restart := addRow("Từ 5 năm", "13", "Cộng  thêm")
+	restart.Cells()[2].Properties().SetVerticalMerge(wml.ST_MergeRestart)
+	merged := addRow("Từ 10 năm", "14", "")
+	merged.Cells()[2].Properties().SetVerticalMerge(wml.ST_MergeContinue)
+
+	// A nested table is flattened into its cell
+	nested := addRow("Quản lý", "", "")
+	inner := nested.Cells()[1].AddTable().AddRow()
+	inner.AddCell().AddParagraph().AddRun().AddText("15")
+	inner.AddCell().AddParagraph().AddRun().AddText("+1")
+
+	want := "Bảng phép năm\n\n" +
+		"| Thâm niên | Số ngày | Ghi chú |\n" +
+		"| --- | --- | --- |\n" +
+		"| Dưới 5 năm | 12 \\| 14 |  |\n" +
+		"| Từ 5 năm | 13 | Cộng thêm |\n" +
+		"| Từ 10 năm | 14 | Cộng thêm |\n" +
+		"| Quản lý | 15 +1 |  |\n"
+	if got := docxToMarkdown(doc); got != want {
+		t.Errorf("docxToMarkdown() = %q, want %q", got, want)
+	}
+}
+
+func TestDocxToMarkdownEmpty(t *testing.T) {
+	doc := document.New()
+	doc.AddParagraph().AddRun().AddText("  ")
+
+	if got := docxToMarkdown(doc); got != "" {
+		t.Errorf("docxToMarkdown() = %q, want empty", got)
+	}
+}
+
+func TestDocxParagraphText(t *testing.T) {
+	doc := document.New()
+	para := doc.AddParagraph()
+	run := para.AddRun()
+	run.AddText("Liên hệ")
+	run.AddTab()
+	run.AddText("phòng Nhân sự")
+	run.AddBreak()
+	para.AddHyperLink().AddRun().AddText("hr@example.com")
+
+	if got := docxParagraphText(para.X()); got != "Liên hệ\tphòng Nhân sự\nhr@example.com" {
+		t.Errorf("docxParagraphText() = %q", got)
+	}
+}
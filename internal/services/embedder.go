@@ -0,0 +1,228 @@
+package services
+
+import (
+	"company-ai-training/internal/config"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Embedder is implemented by every backend that can turn text into embedding vectors
+type Embedder interface {
+	// GenerateEmbedding returns a vector of exactly Dimension() values for text
+	GenerateEmbedding(text string) ([]float32, error)
+	// ModelName identifies the embedding model, vectors from different models are not comparable
+	ModelName() string
+	// Dimension is the length of every vector returned by GenerateEmbedding
+	Dimension() int
+}
+
+// BatchEmbedder is implemented by embedders that can embed several texts in one request
+type BatchEmbedder interface {
+	// GenerateEmbeddings returns one vector per text, in the same order
+	GenerateEmbeddings(texts []string) ([][]float32, error)
+}
+
+// EmbedConfig controls how ingestion groups and parallelizes embedding requests
+type EmbedConfig struct {
+	BatchSize   int // Texts per request, for embedders implementing BatchEmbedder
+	Concurrency int // Requests in flight per document
+}
+
+// NewEmbedder creates the embedding backend selected in the configuration
+func NewEmbedder(cfg *config.Config) (Embedder, error) {
+	switch strings.ToLower(cfg.EmbeddingProvider) {
+	case "", "gemini":
+		if cfg.GeminiAPIKey == "" {
+			return nil, fmt.Errorf("GEMINI_API_KEY is required for the gemini embedding provider")
+		}
+		return newResilientEmbedder(NewGeminiClientV2(cfg.GeminiAPIKey, "", cfg.EmbeddingModel, cfg.EmbeddingDimension),
+			resilienceFor("Embedding", "gemini", cfg.GeminiAPIKey, resilienceConfig(cfg))), nil
+	case "ollama":
+		return newResilientEmbedder(NewOllamaClient(cfg.OllamaBaseURL, "", cfg.EmbeddingModel, cfg.EmbeddingDimension),
+			resilienceFor("Embedding", "ollama", cfg.OllamaBaseURL, resilienceConfig(cfg))), nil
+	case "hash":
+		return NewHashingEmbedder(cfg.EmbeddingDimension), nil
+	default:
+		return nil, fmt.Errorf("unsupported embedding provider: %s", cfg.EmbeddingProvider)
+	}
+}
+
+// embedTexts embeds texts in batches on a bounded pool of workers and returns their vectors
+// in order, with the texts that were sent to the provider rather than served from a cache.
+// Embedders without batch support get one text per request. onProgress is called, never
+// concurrently, with the number of texts embedded so far. The first failure stops the
+// remaining batches.
+func embedTexts(embedder Embedder, texts []string, cfg EmbedConfig, onProgress func(done int)) ([][]float32, []string, error) {
+	batcher, canBatch := embedder.(BatchEmbedder)
+	cacher, caches := embedder.(cachingEmbedder)
+	batchSize := max(cfg.BatchSize, 1)
+	if !canBatch {
+		batchSize = 1
+	}
+
+	type batch struct{ start, end int }
+	batches := make(chan batch)
+	go func() {
+		defer close(batches)
+		for start := 0; start < len(texts); start += batchSize {
+			batches <- batch{start, min(start+batchSize, len(texts))}
+		}
+	}()
+
+	embeddings := make([][]float32, len(texts))
+	var (
+		sent     []string
+		mu       sync.Mutex
+		done     int
+		firstErr error
+		wg       sync.WaitGroup
+	)
+
+	workers := min(max(cfg.Concurrency, 1), (len(texts)+batchSize-1)/batchSize)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range batches {
+				mu.Lock()
+				failed := firstErr != nil
+				mu.Unlock()
+				if failed {
+					continue // Drain the remaining batches
+				}
+
+				var vectors [][]float32
+				var err error
+				batchSent := texts[b.start:b.end]
+				if caches {
+					vectors, batchSent, err = cacher.embedCached(texts[b.start:b.end])
+				} else if canBatch {
+					vectors, err = batcher.GenerateEmbeddings(texts[b.start:b.end])
+				} else {
+					var vector []float32
+					vector, err = embedder.GenerateEmbedding(texts[b.start])
+					vectors = [][]float32{vector}
+				}
+				if err == nil && len(vectors) != b.end-b.start {
+					err = fmt.Errorf("expected %d embeddings, got %d", b.end-b.start, len(vectors))
+				}
+
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = fmt.Errorf("failed to generate embeddings for chunks %d-%d: %w", b.start, b.end-1, err)
+					}
+				} else {
+					copy(embeddings[b.start:b.end], vectors)
+					sent = append(sent, batchSent...)
+					done += b.end - b.start
+					if onProgress != nil {
+						onProgress(done)
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, nil, firstErr
+	}
+	return embeddings, sent, nil
+}
+
+// fitEmbeddingDimension mean-pools a provider vector down to the target dimension
+func fitEmbeddingDimension(values []float32, targetDim int) ([]float32, error) {
+	if len(values) == targetDim {
+		return values, nil
+	}
+	if len(values) < targetDim {
+		return nil, fmt.Errorf("embedding has %d dimensions, expected at least %d", len(values), targetDim)
+	}
+
+	pooled := make([]float32, targetDim)
+	groupSize := len(values) / targetDim
+	for i := 0; i < targetDim; i++ {
+		start := i * groupSize
+		end := start + groupSize
+		if i == targetDim-1 {
+			end = len(values)
+		}
+		var sum float64
+		for j := start; j < end; j++ {
+			sum += float64(values[j])
+		}
+		pooled[i] = float32(sum / float64(end-start))
+	}
+	return pooled, nil
+}
+
+// HashingEmbedder is a deterministic, offline embedder based on feature hashing.
+// It needs no network access, which makes it suitable for local development and CI,
+// but it only captures lexical overlap and is no substitute for a real model.
+type HashingEmbedder struct {
+	dimension int
+}
+
+func NewHashingEmbedder(dimension int) *HashingEmbedder {
+	return &HashingEmbedder{dimension: dimension}
+}
+
+// GenerateEmbedding hashes word unigrams and bigrams into a signed, L2-normalized vector
+func (e *HashingEmbedder) GenerateEmbedding(text string) ([]float32, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, fmt.Errorf("text cannot be empty")
+	}
+
+	tokens := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	vector := make([]float32, e.dimension)
+	for i, token := range tokens {
+		e.addFeature(vector, token, 1)
+		if i > 0 {
+			e.addFeature(vector, tokens[i-1]+" "+token, 0.5)
+		}
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v * v)
+	}
+	if norm > 0 {
+		scale := float32(1 / math.Sqrt(norm))
+		for i := range vector {
+			vector[i] *= scale
+		}
+	}
+
+	return vector, nil
+}
+
+// addFeature adds a weighted feature to the bucket selected by its hash
+func (e *HashingEmbedder) addFeature(vector []float32, feature string, weight float32) {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	sum := h.Sum64()
+
+	bucket := int(sum % uint64(e.dimension))
+	if sum&(1<<63) != 0 {
+		weight = -weight
+	}
+	vector[bucket] += weight
+}
+
+func (e *HashingEmbedder) ModelName() string {
+	return "hashing-v1"
+}
+
+func (e *HashingEmbedder) Dimension() int {
+	return e.dimension
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestHashingEmbedder(t *testing.T) {
+	embedder := NewHashingEmbedder(64)
+	if embedder.Dimension() != 64 {
+		t.Errorf("Dimension() = %d, want 64", embedder.Dimension())
+	}
+
+	first, err := embedder.GenerateEmbedding("Nhân viên được nghỉ phép 12 ngày mỗi năm")
+	if err != nil {
+		t.Fatalf("GenerateEmbedding() error = %v", err)
+	}
+	if len(first) != 64 {
+		t.Fatalf("len(embedding) = %d, want 64", len(first))
+	}
+
+	// Deterministic across instances, so stored vectors stay comparable between runs
+	again, _ := NewHashingEmbedder(64).GenerateEmbedding("nhân viên được NGHỈ PHÉP 12 ngày, mỗi năm!")
+	if !reflect.DeepEqual(first, again) {
+		t.Error("embeddings of the same words differ")
+	}
+
+	var norm float64
+	for _, v := range first {
+		norm += float64(v * v)
+	}
+	if math.Abs(norm-1) > 1e-5 {
+		t.Errorf("squared norm = %v, want 1", norm)
+	}
+
+	related, _ := embedder.GenerateEmbedding("Số ngày nghỉ phép của nhân viên")
+	unrelated, _ := embedder.GenerateEmbedding("VPN setup guide for laptops")
+	v := &VectorService{}
+	if v.cosineSimilarity(first, related) <= v.cosineSimilarity(first, unrelated) {
+		t.Error("text sharing words is not closer than unrelated text")
+	}
+
+	if _, err := embedder.GenerateEmbedding("   "); err == nil {
+		t.Error("GenerateEmbedding() of blank text error = nil, want an error")
+	}
+}
@@ -0,0 +1,292 @@
+package services
+
+import (
+	"company-ai-training/internal/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EmbeddingCache stores embedding vectors keyed by model, dimension and the SHA-256 of the
+// embedded text, so unchanged chunks and repeated queries are not sent to the provider again
+type EmbeddingCache struct {
+	db *gorm.DB
+}
+
+// EmbeddingCacheStats summarizes the cached vectors of one model
+type EmbeddingCacheStats struct {
+	Model       string    `json:"model"`
+	Dimension   int       `json:"dimension"`
+	Entries     int64     `json:"entries"`
+	Hits        int64     `json:"hits"`
+	OldestEntry time.Time `json:"oldest_entry"`
+	LastUsedAt  time.Time `json:"last_used_at"`
+}
+
+// EmbeddingCachePurge selects the entries removed by Purge, zero values match everything
+type EmbeddingCachePurge struct {
+	Model        string
+	Dimension    int
+	UnusedBefore *time.Time // Only entries not used since then
+}
+
+func NewEmbeddingCache(db *gorm.DB) *EmbeddingCache {
+	return &EmbeddingCache{db: db}
+}
+
+// lookup returns the cached vectors of the given text hashes, counting a hit for each
+func (c *EmbeddingCache) lookup(model string, dimension int, hashes []string) (map[string][]float32, error) {
+	var rows []struct {
+		TextHash  string
+		Embedding string
+	}
+	if err := c.db.Raw(`
+		SELECT text_hash, embedding::text AS embedding
+		FROM embedding_cache
+		WHERE model = ? AND dimension = ? AND text_hash IN ?
+	`, model, dimension, hashes).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	found := make(map[string][]float32, len(rows))
+	for _, row := range rows {
+		vector, err := parseVector(row.Embedding)
+		if err != nil || len(vector) != dimension {
+			continue // Treat unreadable entries as misses, they are overwritten on store
+		}
+		found[row.TextHash] = vector
+	}
+
+	hits := make([]string, 0, len(found))
+	for hash := range found {
+		hits = append(hits, hash)
+	}
+	if len(hits) == 0 {
+		return found, nil
+	}
+	if err := c.db.Exec(`
+		UPDATE embedding_cache SET hits = hits + 1, last_used_at = NOW()
+		WHERE model = ? AND dimension = ? AND text_hash IN ?
+	`, model, dimension, hits).Error; err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// store saves freshly computed vectors
+func (c *EmbeddingCache) store(model string, dimension int, hashes []string, embeddings [][]float32) error {
+	return c.db.Transaction(func(tx *gorm.DB) error {
+		for i, hash := range hashes {
+			if err := tx.Exec(`
+				INSERT INTO embedding_cache (model, dimension, text_hash, embedding, hits, created_at, last_used_at)
+				VALUES (?, ?, ?, ?::vector, 0, NOW(), NOW())
+				ON CONFLICT (model, dimension, text_hash) DO UPDATE SET embedding = EXCLUDED.embedding, last_used_at = NOW()
+			`, model, dimension, hash, formatVector(embeddings[i])).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Stats returns the number of entries and hits per model
+func (c *EmbeddingCache) Stats() ([]EmbeddingCacheStats, error) {
+	var stats []EmbeddingCacheStats
+	err := c.db.Model(&models.EmbeddingCacheEntry{}).
+		Select("model, dimension, COUNT(*) AS entries, COALESCE(SUM(hits), 0) AS hits, MIN(created_at) AS oldest_entry, MAX(last_used_at) AS last_used_at").
+		Group("model, dimension").
+		Order("model, dimension").
+		Scan(&stats).Error
+	return stats, err
+}
+
+// Purge deletes the matching entries and returns how many were removed
+func (c *EmbeddingCache) Purge(filter EmbeddingCachePurge) (int64, error) {
+	query := c.db.Session(&gorm.Session{AllowGlobalUpdate: true})
+	if filter.Model != "" {
+		query = query.Where("model = ?", filter.Model)
+	}
+	if filter.Dimension > 0 {
+		query = query.Where("dimension = ?", filter.Dimension)
+	}
+	if filter.UnusedBefore != nil {
+		query = query.Where("last_used_at < ?", *filter.UnusedBefore)
+	}
+
+	result := query.Delete(&models.EmbeddingCacheEntry{})
+	return result.RowsAffected, result.Error
+}
+
+// embeddingStore is where a CachedEmbedder keeps its vectors, an *EmbeddingCache in production
+type embeddingStore interface {
+	lookup(model string, dimension int, hashes []string) (map[string][]float32, error)
+	store(model string, dimension int, hashes []string, embeddings [][]float32) error
+}
+
+// cachingEmbedder is implemented by embedders that answer some texts without calling the provider
+type cachingEmbedder interface {
+	// embedCached returns the vectors of texts and the distinct texts sent to the provider for them
+	embedCached(texts []string) ([][]float32, []string, error)
+}
+
+// CachedEmbedder serves embeddings from the cache and only sends uncached texts to the provider.
+// Cache failures are logged and fall back to the provider.
+type CachedEmbedder struct {
+	embedder Embedder
+	cache    embeddingStore
+}
+
+// cachedBatchEmbedder is a CachedEmbedder for an embedder that supports batching
+type cachedBatchEmbedder struct {
+	*CachedEmbedder
+	batcher BatchEmbedder
+}
+
+// NewCachedEmbedder wraps embedder, keeping its batch support if it has any
+func NewCachedEmbedder(embedder Embedder, cache *EmbeddingCache) Embedder {
+	return newCachedEmbedder(embedder, cache)
+}
+
+func newCachedEmbedder(embedder Embedder, cache embeddingStore) Embedder {
+	cached := &CachedEmbedder{embedder: embedder, cache: cache}
+	if batcher, ok := embedder.(BatchEmbedder); ok {
+		return &cachedBatchEmbedder{CachedEmbedder: cached, batcher: batcher}
+	}
+	return cached
+}
+
+// GenerateEmbedding returns the cached vector of text, embedding it on a miss
+func (e *CachedEmbedder) GenerateEmbedding(text string) ([]float32, error) {
+	embeddings, _, err := e.embedCached([]string{text})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+// embedCached embeds the texts missing from the cache one per provider request
+func (e *CachedEmbedder) embedCached(texts []string) ([][]float32, []string, error) {
+	return e.embed(texts, func(texts []string) ([][]float32, error) {
+		embeddings := make([][]float32, len(texts))
+		for i, text := range texts {
+			embedding, err := e.embedder.GenerateEmbedding(text)
+			if err != nil {
+				return nil, err
+			}
+			embeddings[i] = embedding
+		}
+		return embeddings, nil
+	})
+}
+
+func (e *CachedEmbedder) ModelName() string {
+	return e.embedder.ModelName()
+}
+
+func (e *CachedEmbedder) Dimension() int {
+	return e.embedder.Dimension()
+}
+
+// GenerateEmbeddings returns the cached vectors of texts, embedding the misses in one request
+func (e *cachedBatchEmbedder) GenerateEmbeddings(texts []string) ([][]float32, error) {
+	embeddings, _, err := e.embedCached(texts)
+	return embeddings, err
+}
+
+// embedCached embeds the texts missing from the cache in one provider request
+func (e *cachedBatchEmbedder) embedCached(texts []string) ([][]float32, []string, error) {
+	return e.embed(texts, e.batcher.GenerateEmbeddings)
+}
+
+// embed looks texts up in the cache and calls generate once with the distinct texts missing
+// from it, which it returns with the vectors of all texts
+func (e *CachedEmbedder) embed(texts []string, generate func([]string) ([][]float32, error)) ([][]float32, []string, error) {
+	model, dimension := e.embedder.ModelName(), e.embedder.Dimension()
+
+	hashes := make([]string, len(texts))
+	for i, text := range texts {
+		hashes[i] = embeddingTextHash(text)
+	}
+
+	found, err := e.cache.lookup(model, dimension, hashes)
+	if err != nil {
+		log.Printf("Warning: embedding cache lookup failed: %v", err)
+	}
+
+	var missTexts, missHashes []string
+	queued := make(map[string]bool)
+	for i, hash := range hashes {
+		if _, ok := found[hash]; !ok && !queued[hash] {
+			queued[hash] = true
+			missTexts = append(missTexts, texts[i])
+			missHashes = append(missHashes, hash)
+		}
+	}
+
+	if len(missTexts) > 0 {
+		embeddings, err := generate(missTexts)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(embeddings) != len(missTexts) {
+			return nil, nil, fmt.Errorf("expected %d embeddings, got %d", len(missTexts), len(embeddings))
+		}
+		if err := e.cache.store(model, dimension, missHashes, embeddings); err != nil {
+			log.Printf("Warning: failed to cache embeddings: %v", err)
+		}
+		if found == nil {
+			found = make(map[string][]float32, len(missHashes))
+		}
+		for i, hash := range missHashes {
+			found[hash] = embeddings[i]
+		}
+	}
+
+	result := make([][]float32, len(texts))
+	for i, hash := range hashes {
+		result[i] = found[hash]
+	}
+	return result, missTexts, nil
+}
+
+// embeddingTextHash returns the cache key of a text
+func embeddingTextHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// formatVector renders a vector as a pgvector literal without losing precision
+func formatVector(vector []float32) string {
+	values := make([]string, len(vector))
+	for i, v := range vector {
+		values[i] = strconv.FormatFloat(float64(v), 'g', -1, 32)
+	}
+	return "[" + strings.Join(values, ",") + "]"
+}
+
+// parseVector reads a pgvector literal such as [0.1,-2,3e-05]
+func parseVector(literal string) ([]float32, error) {
+	literal = strings.TrimSpace(literal)
+	if !strings.HasPrefix(literal, "[") || !strings.HasSuffix(literal, "]") {
+		return nil, fmt.Errorf("invalid vector literal")
+	}
+	fields := strings.Split(literal[1:len(literal)-1], ",")
+	vector := make([]float32, len(fields))
+	for i, field := range fields {
+		value, err := strconv.ParseFloat(strings.TrimSpace(field), 32)
+		if err != nil {
+			return nil, err
+		}
+		vector[i] = float32(value)
+	}
+	return vector, nil
+}
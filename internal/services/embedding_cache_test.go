@@ -0,0 +1,233 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// memoryEmbeddingStore is an embeddingStore kept in memory
+type memoryEmbeddingStore struct {
+	vectors map[string][]float32
+	failing bool
+}
+
+func (s *memoryEmbeddingStore) lookup(model string, dimension int, hashes []string) (map[string][]float32, error) {
+	if s.failing {
+		return nil, errors.New("database is down")
+	}
+	found := make(map[string][]float32)
+	for _, hash := range hashes {
+		if vector, ok := s.vectors[model+"/"+hash]; ok {
+			found[hash] = vector
+		}
+	}
+	return found, nil
+}
+
+func (s *memoryEmbeddingStore) store(model string, dimension int, hashes []string, embeddings [][]float32) error {
+	if s.failing {
+		return errors.New("database is down")
+	}
+	for i, hash := range hashes {
+		s.vectors[model+"/"+hash] = embeddings[i]
+	}
+	return nil
+}
+
+// recordingEmbedder records the texts of every provider request
+type recordingEmbedder struct {
+	requests [][]string
+}
+
+func (e *recordingEmbedder) GenerateEmbedding(text string) ([]float32, error) {
+	e.requests = append(e.requests, []string{text})
+	return []float32{float32(len(text)), 1}, nil
+}
+
+func (e *recordingEmbedder) GenerateEmbeddings(texts []string) ([][]float32, error) {
+	e.requests = append(e.requests, texts)
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		embeddings[i] = []float32{float32(len(text)), 1}
+	}
+	return embeddings, nil
+}
+
+func (e *recordingEmbedder) ModelName() string { return "recording" }
+func (e *recordingEmbedder) Dimension() int    { return 2 }
+
+// singleEmbedder hides the batch support of a recordingEmbedder
+type singleEmbedder struct {
+	provider *recordingEmbedder
+}
+
+func (e singleEmbedder) GenerateEmbedding(text string) ([]float32, error) {
+	return e.provider.GenerateEmbedding(text)
+}
+func (e singleEmbedder) ModelName() string { return e.provider.ModelName() }
+func (e singleEmbedder) Dimension() int    { return e.provider.Dimension() }
+
+func TestCachedEmbedderSkipsProviderForRepeatedTexts(t *testing.T) {
+	tests := []struct {
+		name         string
+		batch        bool
+		wantRequests [][]string
+	}{
+		{"batch provider", true, [][]string{{"nghỉ phép", "nghỉ ốm"}}},
+		{"single provider", false, [][]string{{"nghỉ phép"}, {"nghỉ ốm"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &recordingEmbedder{}
+			var embedder Embedder = singleEmbedder{provider}
+			if tt.batch {
+				embedder = provider
+			}
+			cached := newCachedEmbedder(embedder, &memoryEmbeddingStore{vectors: make(map[string][]float32)})
+			cfg := EmbedConfig{BatchSize: 10, Concurrency: 1}
+
+			// The first ingestion sends each distinct text once
+			texts := []string{"nghỉ phép", "nghỉ ốm", "nghỉ phép"}
+			embeddings, sent, err := embedTexts(cached, texts, cfg, nil)
+			if err != nil {
+				t.Fatalf("embedTexts() error = %v", err)
+			}
+			if !reflect.DeepEqual(provider.requests, tt.wantRequests) {
+				t.Errorf("provider requests = %q, want %q", provider.requests, tt.wantRequests)
+			}
+			if !reflect.DeepEqual(embeddings[0], embeddings[2]) {
+				t.Errorf("repeated text embedded as %v and %v", embeddings[0], embeddings[2])
+			}
+			var usage embeddingUsage
+			usage.add(texts, sent, false)
+			if usage.ChunkTexts != 2 || usage.CacheHits != 1 {
+				t.Errorf("usage = %+v, want 2 chunk texts and 1 cache hit", usage)
+			}
+
+			// Re-embedding the same text makes no provider call and counts no provider usage
+			calls := len(provider.requests)
+			again, sent, err := embedTexts(cached, []string{"nghỉ phép"}, cfg, nil)
+			if err != nil {
+				t.Fatalf("embedTexts() error = %v", err)
+			}
+			if len(provider.requests) != calls {
+				t.Errorf("provider called for a cached text: %q", provider.requests[calls:])
+			}
+			if !reflect.DeepEqual(again[0], embeddings[0]) {
+				t.Errorf("cached embedding = %v, want %v", again[0], embeddings[0])
+			}
+			usage = embeddingUsage{}
+			usage.add([]string{"nghỉ phép"}, sent, false)
+			if want := (embeddingUsage{CacheHits: 1}); usage != want {
+				t.Errorf("usage = %+v, want %+v", usage, want)
+			}
+		})
+	}
+}
+
+func TestCachedEmbedderFallsBackToProvider(t *testing.T) {
+	provider := &recordingEmbedder{}
+	cached := newCachedEmbedder(provider, &memoryEmbeddingStore{failing: true})
+
+	// An unavailable cache neither fails the embedding nor hides the provider calls
+	for i := 0; i < 2; i++ {
+		_, sent, err := embedTexts(cached, []string{"nghỉ phép"}, EmbedConfig{BatchSize: 10}, nil)
+		if err != nil {
+			t.Fatalf("embedTexts() error = %v", err)
+		}
+		if len(sent) != 1 {
+			t.Errorf("sent = %q, want the text sent to the provider", sent)
+		}
+	}
+	if len(provider.requests) != 2 {
+		t.Errorf("provider requests = %d, want 2", len(provider.requests))
+	}
+}
+
+func TestEmbedTextsWithoutCacheSendsEveryText(t *testing.T) {
+	provider := &recordingEmbedder{}
+	texts := []string{"a", "b", "c", "a", "d"}
+
+	_, sent, err := embedTexts(provider, texts, EmbedConfig{BatchSize: 2, Concurrency: 2}, nil)
+	if err != nil {
+		t.Fatalf("embedTexts() error = %v", err)
+	}
+	sort.Strings(sent)
+	if want := []string{"a", "a", "b", "c", "d"}; !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent = %q, want %q", sent, want)
+	}
+}
+
+func TestVectorLiteralRoundTrip(t *testing.T) {
+	vector := []float32{0.1, -2, 3e-05, 0.33333334}
+
+	got, err := parseVector(formatVector(vector))
+	if err != nil {
+		t.Fatalf("parseVector() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, vector) {
+		t.Errorf("parseVector(formatVector()) = %v, want %v", got, vector)
+	}
+
+	for _, literal := range []string{"", "0.1,0.2", "[0.1,abc]"} {
+		if _, err := parseVector(literal); err == nil {
+			t.Errorf("parseVector(%q) error = nil, want an error", literal)
+		}
+	}
+}
+
+func TestEmbeddingTextHash(t *testing.T) {
+	// SHA-256 of "abc" from FIPS 180-2
+	if got := embeddingTextHash("abc"); got != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("embeddingTextHash(abc) = %s", got)
+	}
+
+	// Texts differing only in normalization or whitespace embed differently and keep their own entries
+	texts := []string{"Nghỉ phép", "Nghỉ phép", "Nghỉ phép ", "nghỉ phép"}
+	seen := make(map[string]string)
+	for _, text := range texts {
+		hash := embeddingTextHash(text)
+		if other, ok := seen[hash]; ok {
+			t.Errorf("embeddingTextHash(%q) = embeddingTextHash(%q)", text, other)
+		}
+		seen[hash] = text
+	}
+}
+
+func TestEmbeddingCachePurgeQuery(t *testing.T) {
+	unusedBefore := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		filter EmbeddingCachePurge
+		want   string
+	}{
+		{"everything", EmbeddingCachePurge{}, `DELETE FROM "embedding_cache"`},
+		{
+			name:   "one model",
+			filter: EmbeddingCachePurge{Model: "text-embedding-004", Dimension: 768},
+			want:   `DELETE FROM "embedding_cache" WHERE model = 'text-embedding-004' AND dimension = 768`,
+		},
+		{
+			name:   "unused entries",
+			filter: EmbeddingCachePurge{UnusedBefore: &unusedBefore},
+			want:   `DELETE FROM "embedding_cache" WHERE last_used_at < '2026-01-02 03:04:05'`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, statements := dryRunDB(t)
+			if _, err := NewEmbeddingCache(db).Purge(tt.filter); err != nil {
+				t.Fatalf("Purge() error = %v", err)
+			}
+			if len(*statements) != 1 || (*statements)[0] != tt.want {
+				t.Errorf("statements = %q, want %q", *statements, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Extractor is implemented by every file format whose text can be indexed
+type Extractor interface {
+	// Extract returns the text content of the file. When only some parts could be read it
+	// returns their text together with a *PartialExtractionError.
+	Extract(data []byte) (string, error)
+	// Extensions lists the handled file extensions, lowercase with the leading dot
+	Extensions() []string
+	// MIMETypes lists the handled MIME types, the first one being used when serving the file
+	MIMETypes() []string
+}
+
+// PageError is a page whose text could not be extracted
+type PageError struct {
+	Page int
+	Err  error
+}
+
+// PartialExtractionError reports the pages that were skipped while extracting the rest of a file
+type PartialExtractionError struct {
+	Pages []PageError
+}
+
+func (e *PartialExtractionError) Error() string {
+	parts := make([]string, len(e.Pages))
+	for i, page := range e.Pages {
+		parts[i] = fmt.Sprintf("page %d: %v", page.Page, page.Err)
+	}
+	return fmt.Sprintf("%d page(s) could not be extracted (%s)", len(e.Pages), strings.Join(parts, "; "))
+}
+
+// ExtractorRegistry finds the extractor for an uploaded file by extension or MIME type
+type ExtractorRegistry struct {
+	byExtension map[string]Extractor
+	byMIMEType  map[string]Extractor
+}
+
+func NewExtractorRegistry(extractors ...Extractor) *ExtractorRegistry {
+	registry := &ExtractorRegistry{
+		byExtension: make(map[string]Extractor),
+		byMIMEType:  make(map[string]Extractor),
+	}
+	for _, extractor := range extractors {
+		registry.Register(extractor)
+	}
+	return registry
+}
+
+// DefaultExtractorRegistry returns a registry with every built-in extractor
+func DefaultExtractorRegistry() *ExtractorRegistry {
+	return NewExtractorRegistry(
+		&PDFExtractor{},
+		&DOCXExtractor{},
+		&XLSXExtractor{},
+		&PPTXExtractor{},
+		&HTMLExtractor{},
+		&MarkdownExtractor{},
+		&CSVExtractor{},
+		&TextExtractor{},
+	)
+}
+
+// Register adds an extractor, replacing any registered for the same extensions or MIME types
+func (r *ExtractorRegistry) Register(extractor Extractor) {
+	for _, ext := range extractor.Extensions() {
+		r.byExtension[strings.ToLower(ext)] = extractor
+	}
+	for _, mimeType := range extractor.MIMETypes() {
+		r.byMIMEType[strings.ToLower(mimeType)] = extractor
+	}
+}
+
+// Lookup returns the extractor for a file extension, falling back to its declared MIME type
+func (r *ExtractorRegistry) Lookup(ext, contentType string) (Extractor, bool) {
+	if extractor, ok := r.byExtension[strings.ToLower(ext)]; ok {
+		return extractor, true
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		if extractor, ok := r.byMIMEType[mediaType]; ok {
+			return extractor, true
+		}
+	}
+	return nil, false
+}
+
+// Extensions lists every supported file extension
+func (r *ExtractorRegistry) Extensions() []string {
+	extensions := make([]string, 0, len(r.byExtension))
+	for ext := range r.byExtension {
+		extensions = append(extensions, ext)
+	}
+	sort.Strings(extensions)
+	return extensions
+}
+
+// extractorContentType returns the MIME type an extracted file is served with
+func extractorContentType(extractor Extractor) string {
+	contentType := extractor.MIMETypes()[0]
+	if strings.HasPrefix(contentType, "text/") {
+		contentType += "; charset=utf-8"
+	}
+	return contentType
+}
+
+// tableToText renders a table for retrieval. The first non-empty row is taken as the
+// header, and every other row becomes one line of "header: value" pairs so that each
+// line still makes sense once the table is split into chunks.
+func tableToText(rows [][]string) string {
+	var header []string
+	var builder strings.Builder
+
+	for _, row := range rows {
+		for i := range row {
+			row[i] = strings.Join(strings.Fields(row[i]), " ")
+		}
+		if isEmptyRow(row) {
+			continue
+		}
+
+		if header == nil {
+			header = row
+			builder.WriteString(strings.Join(nonEmpty(row), " | "))
+			builder.WriteString("\n")
+			continue
+		}
+
+		var pairs []string
+		for i, value := range row {
+			if value == "" {
+				continue
+			}
+			if i < len(header) && header[i] != "" {
+				pairs = append(pairs, header[i]+": "+value)
+			} else {
+				pairs = append(pairs, value)
+			}
+		}
+		builder.WriteString(strings.Join(pairs, "; "))
+		builder.WriteString("\n")
+	}
+
+	return builder.String()
+}
+
+func isEmptyRow(row []string) bool {
+	for _, value := range row {
+		if value != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func nonEmpty(values []string) []string {
+	var result []string
+	for _, value := range values {
+		if value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// pageMarkerPattern matches the marker that page-aware extractors write at the start of every
+// page, with the line break after it
+var pageMarkerPattern = regexp.MustCompile(`<!-- page (\d+) -->\n?`)
+
+// pageMarker returns the marker for the start of a page in extracted text
+func pageMarker(page int) string {
+	return fmt.Sprintf("<!-- page %d -->", page)
+}
+
+// splitPageMarkers removes the page markers from extracted text and returns where each page
+// starts in what is left, encoded for Document.PageBreaks. Markers never reach the stored
+// content, so documents, versions and diffs show only the text of the pages.
+func splitPageMarkers(text string) (string, string) {
+	matches := pageMarkerPattern.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text, ""
+	}
+
+	var content strings.Builder
+	pages := make([]docPage, 0, len(matches))
+	offset, last := 0, 0
+	for _, match := range matches {
+		content.WriteString(text[last:match[0]])
+		offset += utf8.RuneCountInString(text[last:match[0]])
+		last = match[1]
+		page, _ := strconv.Atoi(text[match[2]:match[3]])
+		pages = append(pages, docPage{Offset: offset, Page: page})
+	}
+	content.WriteString(text[last:])
+
+	encoded, _ := json.Marshal(pages)
+	return content.String(), string(encoded)
+}
+
+// documentPages decodes Document.PageBreaks, nil when the document has no pages
+func documentPages(pageBreaks string) []docPage {
+	if pageBreaks == "" {
+		return nil
+	}
+	var pages []docPage
+	if err := json.Unmarshal([]byte(pageBreaks), &pages); err != nil {
+		log.Printf("Ignoring invalid page breaks: %v", err)
+		return nil
+	}
+	return pages
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestExtractorRegistryLookup(t *testing.T) {
+	registry := DefaultExtractorRegistry()
+
+	tests := []struct {
+		name        string
+		ext         string
+		contentType string
+		want        Extractor
+	}{
+		{"extension", ".pdf", "", &PDFExtractor{}},
+		{"uppercase extension", ".DOCX", "", &DOCXExtractor{}},
+		{"extension wins over content type", ".csv", "text/html", &CSVExtractor{}},
+		{"content type without extension", "", "text/markdown", &MarkdownExtractor{}},
+		{"content type with parameters", ".bin", "text/html; charset=utf-8", &HTMLExtractor{}},
+		{"uppercase content type", "", "Application/PDF", &PDFExtractor{}},
+		{"unknown", ".exe", "application/octet-stream", nil},
+		{"invalid content type", "", "text/html; =", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := registry.Lookup(tt.ext, tt.contentType)
+			if ok != (tt.want != nil) {
+				t.Fatalf("Lookup(%q, %q) ok = %v", tt.ext, tt.contentType, ok)
+			}
+			if reflect.TypeOf(got) != reflect.TypeOf(tt.want) {
+				t.Errorf("Lookup(%q, %q) = %T, want %T", tt.ext, tt.contentType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractorRegistryRegisterReplaces(t *testing.T) {
+	registry := NewExtractorRegistry(&TextExtractor{}, &MarkdownExtractor{})
+	registry.Register(&HTMLExtractor{})
+
+	if got := registry.Extensions(); !reflect.DeepEqual(got, []string{".htm", ".html", ".markdown", ".md", ".txt"}) {
+		t.Errorf("Extensions() = %q", got)
+	}
+
+	// A later extractor takes over the extensions it declares
+	registry.Register(&markdownAsText{})
+	if got, _ := registry.Lookup(".md", ""); reflect.TypeOf(got) != reflect.TypeOf(&markdownAsText{}) {
+		t.Errorf("Lookup(.md) = %T after Register, want *markdownAsText", got)
+	}
+	if got, _ := registry.Lookup(".markdown", ""); reflect.TypeOf(got) != reflect.TypeOf(&MarkdownExtractor{}) {
+		t.Errorf("Lookup(.markdown) = %T, want *MarkdownExtractor", got)
+	}
+}
+
+// markdownAsText handles .md files as plain text
+type markdownAsText struct{ TextExtractor }
+
+func (e *markdownAsText) Extensions() []string { return []string{".md"} }
+
+func TestExtractorContentType(t *testing.T) {
+	tests := []struct {
+		extractor Extractor
+		want      string
+	}{
+		{&TextExtractor{}, "text/plain; charset=utf-8"},
+		{&MarkdownExtractor{}, "text/markdown; charset=utf-8"},
+		{&PDFExtractor{}, "application/pdf"},
+		{&XLSXExtractor{}, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+	}
+
+	for _, tt := range tests {
+		if got := extractorContentType(tt.extractor); got != tt.want {
+			t.Errorf("extractorContentType(%T) = %q, want %q", tt.extractor, got, tt.want)
+		}
+	}
+}
+
+func TestTextExtractors(t *testing.T) {
+	tests := []struct {
+		name      string
+		extractor Extractor
+		data      string
+		want      string
+	}{
+		{"text strips BOM and CRLF", &TextExtractor{}, "\xEF\xBB\xBFNghỉ phép\r\nnăm\r\n", "Nghỉ phép\nnăm\n"},
+		{"markdown is kept", &MarkdownExtractor{}, "# Quy định\r\n\r\n- Nghỉ phép\r\n", "# Quy định\n\n- Nghỉ phép\n"},
+		{
+			name:      "csv with commas",
+			extractor: &CSVExtractor{},
+			data:      "Họ tên,Phòng ban,Số ngày\nNguyễn Văn A,Kế toán,12\nTrần Thị B,,15\n",
+			want:      "Họ tên | Phòng ban | Số ngày\nHọ tên: Nguyễn Văn A; Phòng ban: Kế toán; Số ngày: 12\nHọ tên: Trần Thị B; Số ngày: 15\n",
+		},
+		{
+			name:      "csv from Excel with semicolons",
+			extractor: &CSVExtractor{},
+			data:      "\xEF\xBB\xBFMã;Mô tả\r\n;\r\nVPN;\"Kết nối; từ xa\"\r\n",
+			want:      "Mã | Mô tả\nMã: VPN; Mô tả: Kết nối; từ xa\n",
+		},
+		{
+			name:      "csv with extra columns",
+			extractor: &CSVExtractor{},
+			data:      "a\tb\n1\t2\t3\n",
+			want:      "a | b\na: 1; b: 2; 3\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.extractor.Extract([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Extract() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectCSVDelimiter(t *testing.T) {
+	tests := []struct {
+		text string
+		want rune
+	}{
+		{"a,b,c\n1;2;3;4", ','},
+		{"a;b;c", ';'},
+		{"a\tb", '\t'},
+		{"single column", ','},
+		{"", ','},
+	}
+
+	for _, tt := range tests {
+		if got := detectCSVDelimiter(tt.text); got != tt.want {
+			t.Errorf("detectCSVDelimiter(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestHTMLExtractor(t *testing.T) {
+	page := `<!DOCTYPE html>
+<html>
+<head><title>Wiki</title><style>p { color: red }</style></head>
+<body>
+<h1>Quy định nghỉ phép</h1>
+<script>track()</script>
+<p>Nhân viên được nghỉ
+   <b>12 ngày</b> mỗi năm.<br>Xem thêm bên dưới.</p>
+<div><div><h2>Thủ tục</h2></div></div>
+<ul><li>Gửi đơn</li><li>Chờ duyệt</li></ul>
+<table><tr><th>Loại</th><th>Số ngày</th></tr><tr><td>Phép năm</td><td>12</td></tr></table>
+</body>
+</html>`
+
+	want := "# Quy định nghỉ phép\n\n" +
+		"Nhân viên được nghỉ 12 ngày mỗi năm.\nXem thêm bên dưới.\n\n" +
+		"## Thủ tục\n\n" +
+		"- Gửi đơn\n- Chờ duyệt\n\n" +
+		"Loại | Số ngày\nPhép năm | 12\n"
+
+	got, err := (&HTMLExtractor{}).Extract([]byte(page))
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("Extract() = %q, want %q", got, want)
+	}
+}
+
+func TestPartialExtractionError(t *testing.T) {
+	err := &PartialExtractionError{Pages: []PageError{
+		{Page: 2, Err: errors.New("invalid font")},
+		{Page: 5, Err: errors.New("no text")},
+	}}
+
+	want := "2 page(s) could not be extracted (page 2: invalid font; page 5: no text)"
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
@@ -10,11 +10,20 @@ import (
 	"google.golang.org/genai"
 )
 
+const (
+	defaultGeminiChatModel      = "gemini-2.0-flash"
+	defaultGeminiEmbeddingModel = "gemini-embedding-001"
+	defaultEmbeddingDimension   = 768
+)
+
 type GeminiClientV2 struct {
-	client *genai.Client
+	client         *genai.Client
+	chatModel      string
+	embeddingModel string
+	embeddingDim   int
 }
 
-func NewGeminiClientV2(apiKey string) *GeminiClientV2 {
+func NewGeminiClientV2(apiKey, chatModel, embeddingModel string, embeddingDim int) *GeminiClientV2 {
 	ctx := context.Background()
 
 	// Create client with API key
@@ -25,31 +34,52 @@ func NewGeminiClientV2(apiKey string) *GeminiClientV2 {
 		log.Fatalf("Failed to create Genai client: %v", err)
 	}
 
+	if chatModel == "" {
+		chatModel = defaultGeminiChatModel
+	}
+	if embeddingModel == "" {
+		embeddingModel = defaultGeminiEmbeddingModel
+	}
+	if embeddingDim <= 0 {
+		embeddingDim = defaultEmbeddingDimension
+	}
+
 	return &GeminiClientV2{
-		client: client,
+		client:         client,
+		chatModel:      chatModel,
+		embeddingModel: embeddingModel,
+		embeddingDim:   embeddingDim,
 	}
 }
 
 // GenerateEmbedding generates embedding for given text using official SDK
 func (g *GeminiClientV2) GenerateEmbedding(text string) ([]float32, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	// Clean text
-	text = strings.TrimSpace(text)
-	if text == "" {
-		return nil, fmt.Errorf("text cannot be empty")
+	embeddings, err := g.GenerateEmbeddings([]string{text})
+	if err != nil {
+		return nil, err
 	}
+	return embeddings[0], nil
+}
 
-	// Create content for embedding
-	contents := []*genai.Content{
-		genai.NewContentFromText(text, genai.RoleUser),
+// GenerateEmbeddings embeds several texts with a single EmbedContent request
+func (g *GeminiClientV2) GenerateEmbeddings(texts []string) ([][]float32, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	// Create one content per text
+	contents := make([]*genai.Content, len(texts))
+	for i, text := range texts {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return nil, fmt.Errorf("text cannot be empty")
+		}
+		contents[i] = genai.NewContentFromText(text, genai.RoleUser)
 	}
 
-	// Generate embedding using official SDK
-	fmt.Printf("Calling Gemini API for embedding (text length: %d)...\n", len(text))
+	// Generate embeddings using official SDK
+	fmt.Printf("Calling Gemini API for %d embedding(s)...\n", len(texts))
 	result, err := g.client.Models.EmbedContent(ctx,
-		"gemini-embedding-001",
+		g.embeddingModel,
 		contents,
 		nil, // Use default config
 	)
@@ -59,61 +89,43 @@ func (g *GeminiClientV2) GenerateEmbedding(text string) ([]float32, error) {
 	}
 	fmt.Printf("Gemini API call successful\n")
 
-	if len(result.Embeddings) == 0 || len(result.Embeddings[0].Values) == 0 {
-		return nil, fmt.Errorf("no embedding values returned")
+	if len(result.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(result.Embeddings))
 	}
 
-	// Downsample to 768 dims to reduce memory/DB footprint
-	values := result.Embeddings[0].Values
-	targetDim := 768
-	if len(values) > targetDim {
-		pooled := make([]float32, targetDim)
-		groupSize := len(values) / targetDim
-		if groupSize < 1 {
-			groupSize = 1
+	// Downsample to the configured dimension to reduce memory/DB footprint
+	embeddings := make([][]float32, len(texts))
+	for i, embedding := range result.Embeddings {
+		if embedding == nil || len(embedding.Values) == 0 {
+			return nil, fmt.Errorf("no embedding values returned")
 		}
-		for i := 0; i < targetDim; i++ {
-			start := i * groupSize
-			end := start + groupSize
-			if start >= len(values) {
-				break
-			}
-			if end > len(values) {
-				end = len(values)
-			}
-			var sum float64
-			for j := start; j < end; j++ {
-				sum += float64(values[j])
-			}
-			count := end - start
-			if count > 0 {
-				pooled[i] = float32(sum / float64(count))
-			}
+		if embeddings[i], err = fitEmbeddingDimension(embedding.Values, g.embeddingDim); err != nil {
+			return nil, err
 		}
-		return pooled, nil
 	}
+	return embeddings, nil
+}
+
+// ModelName returns the embedding model used by GenerateEmbedding
+func (g *GeminiClientV2) ModelName() string {
+	return g.embeddingModel
+}
 
-	return values, nil
+// Dimension returns the length of vectors produced by GenerateEmbedding
+func (g *GeminiClientV2) Dimension() int {
+	return g.embeddingDim
 }
 
 // Chat generates response using Gemini chat API
-func (g *GeminiClientV2) Chat(conversation string) (string, error) {
+func (g *GeminiClientV2) Chat(messages []Message) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	// Create content for chat
-	contents := []*genai.Content{
-		genai.NewContentFromText(conversation, genai.RoleUser),
-	}
-
-	// Generate response using Gemini 2.0 Flash
+	// Generate response using the configured Gemini model
 	result, err := g.client.Models.GenerateContent(ctx,
-		"gemini-2.0-flash",
-		contents,
-		&genai.GenerateContentConfig{
-			Temperature:     genai.Ptr(float32(0.7)),
-			MaxOutputTokens: 2048,
-		},
+		g.chatModel,
+		g.chatContents(messages),
+		g.chatConfig(),
 	)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate chat response: %w", err)
@@ -138,6 +150,53 @@ func (g *GeminiClientV2) Chat(conversation string) (string, error) {
 	return response, nil
 }
 
+// ChatStream generates response using the Gemini streaming API, reporting each text fragment to onChunk
+func (g *GeminiClientV2) ChatStream(messages []Message, onChunk func(string) error) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	var response strings.Builder
+	for result, err := range g.client.Models.GenerateContentStream(ctx, g.chatModel, g.chatContents(messages), g.chatConfig()) {
+		if err != nil {
+			return "", fmt.Errorf("failed to stream chat response: %w", err)
+		}
+		if len(result.Candidates) == 0 || result.Candidates[0].Content == nil {
+			continue
+		}
+
+		for _, part := range result.Candidates[0].Content.Parts {
+			if part.Text == "" || part.Thought {
+				continue
+			}
+			response.WriteString(part.Text)
+			if err := onChunk(part.Text); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	if response.Len() == 0 {
+		return "", fmt.Errorf("empty response generated")
+	}
+
+	return response.String(), nil
+}
+
+// chatContents converts a conversation into the single prompt sent to Gemini
+func (g *GeminiClientV2) chatContents(messages []Message) []*genai.Content {
+	return []*genai.Content{
+		genai.NewContentFromText(flattenConversation(messages), genai.RoleUser),
+	}
+}
+
+// chatConfig returns the generation settings shared by Chat and ChatStream
+func (g *GeminiClientV2) chatConfig() *genai.GenerateContentConfig {
+	return &genai.GenerateContentConfig{
+		Temperature:     genai.Ptr(float32(0.7)),
+		MaxOutputTokens: 2048,
+	}
+}
+
 // Close closes the client connection
 func (g *GeminiClientV2) Close() error {
 	// Note: genai.Client doesn't have Close method in current version
@@ -0,0 +1,491 @@
+package services
+
+import (
+	"company-ai-training/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	ingestionPollInterval = 2 * time.Second
+	ingestionBaseBackoff  = 5 * time.Second
+	ingestionMaxBackoff   = 10 * time.Minute
+	// Running jobs refresh locked_at every heartbeat interval, one not refreshed within the
+	// lock timeout belongs to a worker that died
+	ingestionHeartbeatInterval = time.Minute
+	ingestionLockTimeout       = 5 * time.Minute
+)
+
+// IngestionService runs chunking and embedding as durable jobs stored in ingestion_jobs.
+// Jobs survive restarts, failed attempts are retried with exponential backoff and jobs
+// that exhaust their attempts are parked in the dead state until retried manually.
+// At most one job per document runs at a time, newer jobs wait for it to finish.
+type IngestionService struct {
+	db            *gorm.DB
+	vectorService *VectorService
+	tenantService *TenantService
+	workers       int
+	maxAttempts   int
+	wake          chan struct{}
+	tenantID      uuid.UUID
+}
+
+func NewIngestionService(db *gorm.DB, vectorService *VectorService, tenantService *TenantService, workers, maxAttempts int) *IngestionService {
+	if workers < 1 {
+		workers = 1
+	}
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	return &IngestionService{
+		db:            db,
+		vectorService: vectorService,
+		tenantService: tenantService,
+		workers:       workers,
+		maxAttempts:   maxAttempts,
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+// ForTenant returns a copy of the service that only sees and enqueues the tenant's jobs.
+// Workers are shared: they are started on the root service and process every tenant's jobs.
+func (s *IngestionService) ForTenant(tenantID uuid.UUID) *IngestionService {
+	scoped := *s
+	scoped.db = scopeToTenant(s.db, tenantID)
+	scoped.tenantID = tenantID
+	return &scoped
+}
+
+// Start requeues jobs abandoned by stopped workers and launches the worker pool. Running
+// jobs may belong to live workers of other instances, so only expired locks are taken over;
+// jobs interrupted by a restart of this instance resume once their lock times out.
+func (s *IngestionService) Start() error {
+	resumed, err := requeueExpiredJobs(s.db)
+	if err != nil {
+		return fmt.Errorf("failed to resume ingestion jobs: %w", err)
+	}
+	if resumed > 0 {
+		log.Printf("Resumed %d interrupted ingestion jobs", resumed)
+	}
+
+	// Extraction runs while an upload is handled, one still running after the lock timeout
+	// was interrupted with its process
+	result := s.db.Model(&models.Document{}).
+		Where("ingestion_status = ? AND updated_at < ?", models.DocumentStatusExtracting, time.Now().Add(-ingestionLockTimeout)).
+		UpdateColumns(map[string]interface{}{
+			"ingestion_status": models.DocumentStatusFailed,
+			"ingestion_error":  "text extraction was interrupted, upload the file again",
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to fail interrupted extractions: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Marked %d interrupted extractions as failed", result.RowsAffected)
+	}
+
+	for i := 0; i < s.workers; i++ {
+		go s.worker(i + 1)
+	}
+
+	log.Printf("Started %d ingestion workers", s.workers)
+	return nil
+}
+
+// Enqueue schedules a document for chunking and embedding, cancelling any job still waiting for it.
+// A job already running for the document finishes first.
+func (s *IngestionService) Enqueue(documentID uuid.UUID, strategy string, config *ChunkConfig) (*models.IngestionJob, error) {
+	if strategy == "" {
+		strategy = models.IngestionStrategyAuto
+	}
+
+	job := &models.IngestionJob{
+		ID:          uuid.New(),
+		TenantID:    s.tenantID,
+		DocumentID:  documentID,
+		Strategy:    strategy,
+		Status:      models.IngestionJobQueued,
+		MaxAttempts: s.maxAttempts,
+		RunAt:       time.Now(),
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+
+	if config != nil {
+		configJSON, err := json.Marshal(config)
+		if err != nil {
+			return nil, err
+		}
+		job.ChunkConfig = string(configJSON)
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// A newer job makes queued work for the same document obsolete
+		if err := tx.Model(&models.IngestionJob{}).
+			Where("document_id = ? AND status = ?", documentID, models.IngestionJobQueued).
+			Updates(map[string]interface{}{
+				"status":     models.IngestionJobCancelled,
+				"updated_at": time.Now(),
+			}).Error; err != nil {
+			return err
+		}
+		result := tx.Model(&models.Document{}).Where("id = ?", documentID).UpdateColumns(map[string]interface{}{
+			"ingestion_status": models.DocumentStatusPending,
+			"ingestion_error":  "",
+			"chunks_processed": 0,
+			"chunks_total":     0,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Create(job).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue ingestion job: %w", err)
+	}
+
+	s.notify()
+	return job, nil
+}
+
+// GetJob retrieves an ingestion job by ID
+func (s *IngestionService) GetJob(id uuid.UUID) (*models.IngestionJob, error) {
+	var job models.IngestionJob
+	if err := s.db.First(&job, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetJobs lists ingestion jobs, optionally filtered by status and document
+func (s *IngestionService) GetJobs(status string, documentID *uuid.UUID, limit int) ([]models.IngestionJob, error) {
+	var jobs []models.IngestionJob
+	query := s.db.Order("created_at DESC")
+
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if documentID != nil {
+		query = query.Where("document_id = ?", *documentID)
+	}
+
+	if err := query.Limit(limit).Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// RetryJob moves a dead job back to the queue with a fresh set of attempts
+func (s *IngestionService) RetryJob(id uuid.UUID) (*models.IngestionJob, error) {
+	result := s.db.Model(&models.IngestionJob{}).
+		Where("id = ? AND status = ?", id, models.IngestionJobDead).
+		Updates(map[string]interface{}{
+			"status":     models.IngestionJobQueued,
+			"attempts":   0,
+			"run_at":     time.Now(),
+			"locked_at":  nil,
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.New("only dead jobs can be retried")
+	}
+
+	job, err := s.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+	setDocumentStatus(s.db, job.DocumentID, models.DocumentStatusPending, map[string]interface{}{
+		"ingestion_error": "",
+	})
+
+	s.notify()
+	return job, nil
+}
+
+// notify wakes an idle worker without blocking
+func (s *IngestionService) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// worker claims and runs jobs until the process exits
+func (s *IngestionService) worker(id int) {
+	ticker := time.NewTicker(ingestionPollInterval)
+	defer ticker.Stop()
+
+	for {
+		job, err := s.claimNextJob()
+		if err != nil {
+			log.Printf("Ingestion worker %d failed to claim job: %v", id, err)
+		}
+
+		if job == nil {
+			select {
+			case <-s.wake:
+			case <-ticker.C:
+			}
+			continue
+		}
+
+		s.runJob(job)
+	}
+}
+
+// claimNextJob locks the oldest due job so that no other worker or instance picks it up
+func (s *IngestionService) claimNextJob() (*models.IngestionJob, error) {
+	var claimed *models.IngestionJob
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := requeueExpiredJobs(tx); err != nil {
+			return err
+		}
+
+		// Documents with a running job are skipped, the unique index on running jobs per
+		// document settles claims racing for the same document
+		var job models.IngestionJob
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND run_at <= ?", models.IngestionJobQueued, time.Now()).
+			Where(`NOT EXISTS (SELECT 1 FROM ingestion_jobs running
+				WHERE running.document_id = ingestion_jobs.document_id AND running.status = ?)`, models.IngestionJobRunning).
+			Order("run_at ASC").
+			Limit(1).
+			Find(&job)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		now := time.Now()
+		job.Status = models.IngestionJobRunning
+		job.Attempts++
+		job.LockedAt = &now
+		job.UpdatedAt = now
+
+		if err := tx.Model(&job).Updates(map[string]interface{}{
+			"status":     job.Status,
+			"attempts":   job.Attempts,
+			"locked_at":  job.LockedAt,
+			"updated_at": job.UpdatedAt,
+		}).Error; err != nil {
+			return err
+		}
+
+		claimed = &job
+		return nil
+	})
+
+	return claimed, err
+}
+
+// requeueExpiredJobs queues again the running jobs whose lock was not refreshed within the
+// lock timeout, which belong to a worker that died, and returns how many there were
+func requeueExpiredJobs(db *gorm.DB) (int64, error) {
+	result := db.Model(&models.IngestionJob{}).
+		Where("status = ? AND locked_at < ?", models.IngestionJobRunning, time.Now().Add(-ingestionLockTimeout)).
+		Updates(map[string]interface{}{
+			"status":     models.IngestionJobQueued,
+			"locked_at":  nil,
+			"run_at":     time.Now(),
+			"updated_at": time.Now(),
+		})
+	return result.RowsAffected, result.Error
+}
+
+// runJob executes a claimed job and records its outcome
+func (s *IngestionService) runJob(job *models.IngestionJob) {
+	log.Printf("Running ingestion job %s for document %s (attempt %d/%d)", job.ID, job.DocumentID, job.Attempts, job.MaxAttempts)
+
+	stop := make(chan struct{})
+	go s.heartbeat(job, stop)
+	err := s.process(job)
+	close(stop)
+
+	if err == nil {
+		now := time.Now()
+		s.finishJob(job, map[string]interface{}{
+			"status":       models.IngestionJobSucceeded,
+			"last_error":   "",
+			"locked_at":    nil,
+			"completed_at": &now,
+			"updated_at":   now,
+		})
+		// A job enqueued meanwhile will chunk the document again, it stays pending until then
+		if !s.hasQueuedJob(job.DocumentID) {
+			setDocumentStatus(s.db, job.DocumentID, models.DocumentStatusReady, map[string]interface{}{
+				"ingestion_error": "",
+			})
+		}
+		log.Printf("Ingestion job %s succeeded", job.ID)
+		return
+	}
+
+	// A deleted document will never succeed, retrying would only burn attempts
+	permanent := errors.Is(err, gorm.ErrRecordNotFound)
+
+	if permanent || job.Attempts >= job.MaxAttempts {
+		log.Printf("Ingestion job %s failed permanently: %v", job.ID, err)
+		s.finishJob(job, map[string]interface{}{
+			"status":     models.IngestionJobDead,
+			"last_error": err.Error(),
+			"locked_at":  nil,
+			"updated_at": time.Now(),
+		})
+		setDocumentStatus(s.db, job.DocumentID, models.DocumentStatusFailed, map[string]interface{}{
+			"ingestion_error": err.Error(),
+		})
+		return
+	}
+
+	delay := ingestionBackoff(job.Attempts)
+	log.Printf("Ingestion job %s failed, retrying in %s: %v", job.ID, delay, err)
+	s.finishJob(job, map[string]interface{}{
+		"status":     models.IngestionJobQueued,
+		"last_error": err.Error(),
+		"locked_at":  nil,
+		"run_at":     time.Now().Add(delay),
+		"updated_at": time.Now(),
+	})
+	setDocumentStatus(s.db, job.DocumentID, models.DocumentStatusPending, map[string]interface{}{
+		"ingestion_error": fmt.Sprintf("attempt %d/%d failed, retrying: %v", job.Attempts, job.MaxAttempts, err),
+	})
+}
+
+// heartbeat refreshes the job's lock until stop is closed, so other workers do not take
+// the job for abandoned while it runs
+func (s *IngestionService) heartbeat(job *models.IngestionJob, stop <-chan struct{}) {
+	ticker := time.NewTicker(ingestionHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			result := s.db.Model(&models.IngestionJob{}).
+				Where("id = ? AND status = ?", job.ID, models.IngestionJobRunning).
+				UpdateColumn("locked_at", time.Now())
+			if result.Error != nil {
+				log.Printf("Failed to refresh lock of ingestion job %s: %v", job.ID, result.Error)
+			} else if result.RowsAffected == 0 {
+				log.Printf("Ingestion job %s is no longer running, its lock expired", job.ID)
+			}
+		}
+	}
+}
+
+// hasQueuedJob reports whether a job is waiting to ingest the document
+func (s *IngestionService) hasQueuedJob(documentID uuid.UUID) bool {
+	var count int64
+	if err := s.db.Model(&models.IngestionJob{}).
+		Where("document_id = ? AND status = ?", documentID, models.IngestionJobQueued).
+		Count(&count).Error; err != nil {
+		log.Printf("Failed to check queued ingestion jobs of document %s: %v", documentID, err)
+		return false
+	}
+	return count > 0
+}
+
+// finishJob persists the outcome of an attempt
+func (s *IngestionService) finishJob(job *models.IngestionJob, updates map[string]interface{}) {
+	if err := s.db.Model(&models.IngestionJob{}).Where("id = ?", job.ID).Updates(updates).Error; err != nil {
+		log.Printf("Failed to update ingestion job %s: %v", job.ID, err)
+	}
+}
+
+// process chunks and embeds the job's document, converting panics into errors
+func (s *IngestionService) process(job *models.IngestionJob) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic in ingestion job: %v", r)
+		}
+	}()
+
+	var doc models.Document
+	if err := s.db.First(&doc, "id = ? AND tenant_id = ?", job.DocumentID, job.TenantID).Error; err != nil {
+		return err
+	}
+
+	// Chunks are embedded with the tenant's own embedder and written through a tenant-scoped handle
+	tenant, err := s.tenantService.Resolve(job.TenantID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve tenant: %w", err)
+	}
+	vectorService := s.vectorService.ForTenant(job.TenantID, tenant.Embedder)
+
+	config := DefaultChunkConfig()
+	if job.ChunkConfig != "" {
+		if err := json.Unmarshal([]byte(job.ChunkConfig), config); err != nil {
+			return fmt.Errorf("invalid chunk config: %w", err)
+		}
+	}
+
+	switch job.Strategy {
+	case models.IngestionStrategySemantic:
+		return vectorService.ChunkAndEmbedDocumentWithSemantics(&doc, config)
+	default:
+		if err := vectorService.ChunkAndEmbedDocumentWithSemantics(&doc, config); err != nil {
+			// Fallback to legacy chunking if semantic fails
+			log.Printf("Semantic chunking failed for document %s, falling back to legacy: %v", doc.Name, err)
+			return vectorService.ChunkAndEmbedDocument(&doc)
+		}
+		return nil
+	}
+}
+
+// setDocumentStatus records the ingestion stage of a document along with any extra columns
+func setDocumentStatus(db *gorm.DB, documentID uuid.UUID, status string, updates map[string]interface{}) {
+	if updates == nil {
+		updates = map[string]interface{}{}
+	}
+	updates["ingestion_status"] = status
+
+	// UpdateColumns leaves updated_at alone, it tracks content changes rather than progress
+	if err := db.Model(&models.Document{}).Where("id = ?", documentID).UpdateColumns(updates).Error; err != nil {
+		log.Printf("Failed to update ingestion status of document %s: %v", documentID, err)
+	}
+}
+
+// reportChunkProgress records how many chunks of a document have been embedded
+func reportChunkProgress(db *gorm.DB, documentID uuid.UUID, processed, total int) {
+	setDocumentStatus(db, documentID, models.DocumentStatusEmbedding, map[string]interface{}{
+		"chunks_processed": processed,
+		"chunks_total":     total,
+	})
+}
+
+// reportEmbeddingUsage records how many texts and estimated tokens embedding a document took,
+// and how many texts the embedding cache served instead
+func reportEmbeddingUsage(db *gorm.DB, documentID uuid.UUID, usage embeddingUsage) {
+	if err := db.Model(&models.Document{}).Where("id = ?", documentID).UpdateColumns(map[string]interface{}{
+		"embedding_texts":      usage.BreakpointTexts + usage.ChunkTexts,
+		"embedding_tokens":     usage.Tokens,
+		"embedding_cache_hits": usage.CacheHits,
+	}).Error; err != nil {
+		log.Printf("Failed to record embedding usage of document %s: %v", documentID, err)
+	}
+}
+
+// ingestionBackoff returns an exponential delay with jitter for the given attempt number
+func ingestionBackoff(attempt int) time.Duration {
+	delay := ingestionBaseBackoff << uint(attempt-1)
+	if delay <= 0 || delay > ingestionMaxBackoff {
+		delay = ingestionMaxBackoff
+	}
+	// Up to 20% jitter keeps retries of a failing batch from firing together
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
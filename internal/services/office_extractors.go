@@ -0,0 +1,76 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/unidoc/unioffice/presentation"
+	"github.com/unidoc/unioffice/spreadsheet"
+)
+
+// XLSXExtractor renders every sheet of an Excel workbook as a table of "header: value" lines
+type XLSXExtractor struct{}
+
+func (e *XLSXExtractor) Extensions() []string { return []string{".xlsx"} }
+func (e *XLSXExtractor) MIMETypes() []string {
+	return []string{"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"}
+}
+
+func (e *XLSXExtractor) Extract(data []byte) (string, error) {
+	workbook, err := spreadsheet.Read(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	defer workbook.Close()
+
+	var content strings.Builder
+	for _, sheet := range workbook.Sheets() {
+		lastColumn := sheet.MaxColumnIdx()
+
+		var rows [][]string
+		for _, row := range sheet.Rows() {
+			cells := row.CellsWithEmpty(lastColumn)
+			values := make([]string, len(cells))
+			for i, cell := range cells {
+				values[i] = cell.GetFormattedValue()
+			}
+			rows = append(rows, values)
+		}
+
+		table := tableToText(rows)
+		if table == "" {
+			continue
+		}
+		fmt.Fprintf(&content, "## %s\n\n%s\n", sheet.Name(), table)
+	}
+
+	return content.String(), nil
+}
+
+// PPTXExtractor extracts the text of every slide of a PowerPoint deck
+type PPTXExtractor struct{}
+
+func (e *PPTXExtractor) Extensions() []string { return []string{".pptx"} }
+func (e *PPTXExtractor) MIMETypes() []string {
+	return []string{"application/vnd.openxmlformats-officedocument.presentationml.presentation"}
+}
+
+func (e *PPTXExtractor) Extract(data []byte) (string, error) {
+	deck, err := presentation.Read(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	defer deck.Close()
+
+	var content strings.Builder
+	for i, slide := range deck.Slides() {
+		text := strings.TrimSpace(slide.ExtractText().Text())
+		if text == "" {
+			continue
+		}
+		fmt.Fprintf(&content, "## Slide %d\n\n%s\n\n", i+1, text)
+	}
+
+	return content.String(), nil
+}
@@ -6,11 +6,30 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+)
+
+const (
+	defaultOllamaChatModel      = "llama3.1"
+	defaultOllamaEmbeddingModel = "nomic-embed-text"
 )
 
 type OllamaClient struct {
-	baseURL string
-	client  *http.Client
+	baseURL        string
+	chatModel      string
+	embeddingModel string
+	embeddingDim   int
+	client         *http.Client
+}
+
+// OllamaAPIError is returned when the Ollama server answers with a non-200 status
+type OllamaAPIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *OllamaAPIError) Error() string {
+	return fmt.Sprintf("ollama API error: %s", e.Body)
 }
 
 type EmbeddingRequest struct {
@@ -40,16 +59,35 @@ type ChatResponse struct {
 	Done      bool    `json:"done"`
 }
 
-func NewOllamaClient(baseURL string) *OllamaClient {
+func NewOllamaClient(baseURL, chatModel, embeddingModel string, embeddingDim int) *OllamaClient {
+	if chatModel == "" {
+		chatModel = defaultOllamaChatModel
+	}
+	if embeddingModel == "" {
+		embeddingModel = defaultOllamaEmbeddingModel
+	}
+	if embeddingDim <= 0 {
+		embeddingDim = defaultEmbeddingDimension
+	}
+
 	return &OllamaClient{
-		baseURL: baseURL,
-		client:  &http.Client{},
+		baseURL:        strings.TrimRight(baseURL, "/"),
+		chatModel:      chatModel,
+		embeddingModel: embeddingModel,
+		embeddingDim:   embeddingDim,
+		client:         &http.Client{},
 	}
 }
 
-func (c *OllamaClient) GenerateEmbedding(model, text string) ([]float32, error) {
+// GenerateEmbedding generates an embedding with the configured Ollama embedding model
+func (c *OllamaClient) GenerateEmbedding(text string) ([]float32, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, fmt.Errorf("text cannot be empty")
+	}
+
 	reqBody := EmbeddingRequest{
-		Model:  model,
+		Model:  c.embeddingModel,
 		Prompt: text,
 	}
 
@@ -70,7 +108,7 @@ func (c *OllamaClient) GenerateEmbedding(model, text string) ([]float32, error)
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("ollama API error: %s", string(body))
+		return nil, &OllamaAPIError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	var embeddingResp EmbeddingResponse
@@ -78,12 +116,23 @@ func (c *OllamaClient) GenerateEmbedding(model, text string) ([]float32, error)
 		return nil, err
 	}
 
-	return embeddingResp.Embedding, nil
+	return fitEmbeddingDimension(embeddingResp.Embedding, c.embeddingDim)
+}
+
+// ModelName returns the embedding model used by GenerateEmbedding
+func (c *OllamaClient) ModelName() string {
+	return c.embeddingModel
 }
 
-func (c *OllamaClient) Chat(model string, messages []Message) (string, error) {
+// Dimension returns the length of vectors produced by GenerateEmbedding
+func (c *OllamaClient) Dimension() int {
+	return c.embeddingDim
+}
+
+// Chat generates a response with the configured Ollama chat model
+func (c *OllamaClient) Chat(messages []Message) (string, error) {
 	reqBody := ChatRequest{
-		Model:    model,
+		Model:    c.chatModel,
 		Messages: messages,
 		Stream:   false,
 	}
@@ -105,7 +154,7 @@ func (c *OllamaClient) Chat(model string, messages []Message) (string, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("ollama API error: %s", string(body))
+		return "", &OllamaAPIError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	var chatResp ChatResponse
@@ -115,3 +164,58 @@ func (c *OllamaClient) Chat(model string, messages []Message) (string, error) {
 
 	return chatResp.Message.Content, nil
 }
+
+// ChatStream generates a response with the Ollama streaming API, reporting each text fragment to onChunk
+func (c *OllamaClient) ChatStream(messages []Message, onChunk func(string) error) (string, error) {
+	reqBody := ChatRequest{
+		Model:    c.chatModel,
+		Messages: messages,
+		Stream:   true,
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.client.Post(
+		fmt.Sprintf("%s/api/chat", c.baseURL),
+		"application/json",
+		bytes.NewBuffer(jsonData),
+	)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", &OllamaAPIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	// The streaming API returns one JSON object per line until done is true
+	var response strings.Builder
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var chatResp ChatResponse
+		if err := decoder.Decode(&chatResp); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return "", err
+		}
+
+		if chatResp.Message.Content != "" {
+			response.WriteString(chatResp.Message.Content)
+			if err := onChunk(chatResp.Message.Content); err != nil {
+				return "", err
+			}
+		}
+
+		if chatResp.Done {
+			break
+		}
+	}
+
+	return response.String(), nil
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// newOllamaStub serves /api/chat with handler after checking the request, and returns a client for it
+func newOllamaStub(t *testing.T, wantStream bool, handler func(w http.ResponseWriter)) *OllamaClient {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/chat" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+
+		var req ChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		if req.Model != "llama-test" {
+			t.Errorf("model = %q, want llama-test", req.Model)
+		}
+		if req.Stream != wantStream {
+			t.Errorf("stream = %v, want %v", req.Stream, wantStream)
+		}
+		if !reflect.DeepEqual(req.Messages, ollamaTestMessages) {
+			t.Errorf("messages = %v, want %v", req.Messages, ollamaTestMessages)
+		}
+
+		handler(w)
+	}))
+	t.Cleanup(server.Close)
+
+	// A trailing slash on the base URL must not produce a double slash
+	return NewOllamaClient(server.URL+"/", "llama-test", "", 0)
+}
+
+var ollamaTestMessages = []Message{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "Xin chào"}}
+
+func TestOllamaClientChat(t *testing.T) {
+	client := newOllamaStub(t, false, func(w http.ResponseWriter) {
+		fmt.Fprint(w, `{"model":"llama-test","message":{"role":"assistant","content":"Chào bạn!"},"done":true}`)
+	})
+
+	reply, err := client.Chat(ollamaTestMessages)
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if reply != "Chào bạn!" {
+		t.Errorf("Chat() = %q, want %q", reply, "Chào bạn!")
+	}
+}
+
+func TestOllamaClientChatErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		wantStatus int // Status of the expected OllamaAPIError, 0 for other errors
+	}{
+		{"model not found", http.StatusNotFound, `{"error":"model 'llama-test' not found"}`, http.StatusNotFound},
+		{"overloaded", http.StatusServiceUnavailable, `{"error":"server busy"}`, http.StatusServiceUnavailable},
+		{"malformed response", http.StatusOK, `{"message":`, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newOllamaStub(t, false, func(w http.ResponseWriter) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			})
+
+			_, err := client.Chat(ollamaTestMessages)
+			if err == nil {
+				t.Fatal("Chat() error = nil, want an error")
+			}
+			var apiErr *OllamaAPIError
+			if isAPIErr := errors.As(err, &apiErr); isAPIErr != (tt.wantStatus != 0) {
+				t.Fatalf("Chat() error = %v, want OllamaAPIError: %v", err, tt.wantStatus != 0)
+			}
+			if apiErr != nil && (apiErr.StatusCode != tt.wantStatus || apiErr.Body != tt.body) {
+				t.Errorf("OllamaAPIError = %d %q, want %d %q", apiErr.StatusCode, apiErr.Body, tt.wantStatus, tt.body)
+			}
+		})
+	}
+}
+
+func TestOllamaClientChatStream(t *testing.T) {
+	tests := []struct {
+		name       string
+		lines      []string
+		wantReply  string
+		wantChunks []string
+	}{
+		{
+			name: "joins fragments until done",
+			lines: []string{
+				`{"message":{"role":"assistant","content":"Chào"},"done":false}`,
+				`{"message":{"role":"assistant","content":""},"done":false}`,
+				`{"message":{"role":"assistant","content":" bạn!"},"done":false}`,
+				`{"message":{"role":"assistant","content":""},"done":true}`,
+				`{"message":{"role":"assistant","content":"ignored"},"done":false}`,
+			},
+			wantReply:  "Chào bạn!",
+			wantChunks: []string{"Chào", " bạn!"},
+		},
+		{
+			name: "ends at end of body",
+			lines: []string{
+				`{"message":{"role":"assistant","content":"Xin"},"done":false}`,
+				`{"message":{"role":"assistant","content":" chào"},"done":false}`,
+			},
+			wantReply:  "Xin chào",
+			wantChunks: []string{"Xin", " chào"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newOllamaStub(t, true, func(w http.ResponseWriter) {
+				for _, line := range tt.lines {
+					fmt.Fprintln(w, line)
+					w.(http.Flusher).Flush()
+				}
+			})
+
+			var chunks []string
+			reply, err := client.ChatStream(ollamaTestMessages, func(chunk string) error {
+				chunks = append(chunks, chunk)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ChatStream() error = %v", err)
+			}
+			if reply != tt.wantReply {
+				t.Errorf("ChatStream() = %q, want %q", reply, tt.wantReply)
+			}
+			if !reflect.DeepEqual(chunks, tt.wantChunks) {
+				t.Errorf("chunks = %q, want %q", chunks, tt.wantChunks)
+			}
+		})
+	}
+}
+
+func TestOllamaClientChatStreamStopsOnCallbackError(t *testing.T) {
+	client := newOllamaStub(t, true, func(w http.ResponseWriter) {
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":"one"},"done":false}`)
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":"two"},"done":true}`)
+	})
+
+	stop := errors.New("client went away")
+	calls := 0
+	_, err := client.ChatStream(ollamaTestMessages, func(string) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf("ChatStream() error = %v, want %v", err, stop)
+	}
+	if calls != 1 {
+		t.Errorf("onChunk called %d times, want 1", calls)
+	}
+}
+
+func TestOllamaClientChatStreamErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantAPI bool
+	}{
+		{"server error", http.StatusInternalServerError, `{"error":"out of memory"}`, true},
+		{"truncated stream", http.StatusOK, `{"message":{"role":"assistant","content":"Chào"},"done":false}` + "\n" + `{"message":`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newOllamaStub(t, true, func(w http.ResponseWriter) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			})
+
+			_, err := client.ChatStream(ollamaTestMessages, func(string) error { return nil })
+			if err == nil {
+				t.Fatal("ChatStream() error = nil, want an error")
+			}
+			var apiErr *OllamaAPIError
+			if errors.As(err, &apiErr) != tt.wantAPI {
+				t.Errorf("ChatStream() error = %v, want OllamaAPIError: %v", err, tt.wantAPI)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ledongthuc/pdf"
+)
+
+const (
+	// minPagesForRepeatedLines is the page count from which running headers and footers are detected
+	minPagesForRepeatedLines = 3
+	// pageEdgeLines is how many lines at the top and bottom of a page may be a header or footer
+	pageEdgeLines = 3
+)
+
+// pageNumberPattern matches the digits of page numbers, e.g. "Page 3 of 12"
+var pageNumberPattern = regexp.MustCompile(`\d+`)
+
+// PDFExtractor extracts the text layer of PDF files, page by page. Every page starts with a
+// page marker, and lines repeated at the top or bottom of most pages, such as running headers
+// and footers, are removed.
+type PDFExtractor struct{}
+
+func (e *PDFExtractor) Extensions() []string { return []string{".pdf"} }
+func (e *PDFExtractor) MIMETypes() []string  { return []string{"application/pdf"} }
+
+// pdfPage is the text of one page, split into lines
+type pdfPage struct {
+	number int
+	lines  []string
+}
+
+func (e *PDFExtractor) Extract(data []byte) (string, error) {
+	pdfReader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+
+	var pages []pdfPage
+	var failed []PageError
+	numPages := pdfReader.NumPage()
+
+	for i := 1; i <= numPages; i++ {
+		page := pdfReader.Page(i)
+		if page.V.IsNull() {
+			failed = append(failed, PageError{Page: i, Err: errors.New("page object is missing")})
+			continue
+		}
+
+		text, err := page.GetPlainText(nil)
+		if err != nil {
+			failed = append(failed, PageError{Page: i, Err: err})
+			continue
+		}
+
+		pages = append(pages, pdfPage{number: i, lines: splitLines(text)})
+	}
+
+	if len(pages) == 0 && len(failed) > 0 {
+		return "", fmt.Errorf("no page could be extracted: %w", &PartialExtractionError{Pages: failed})
+	}
+
+	repeated := repeatedPageLines(pages)
+
+	var content strings.Builder
+	for _, page := range pages {
+		content.WriteString(pageMarker(page.number))
+		content.WriteString("\n")
+		for i, line := range page.lines {
+			if page.isEdgeLine(i) && repeated[normalizePageLine(line)] {
+				continue
+			}
+			content.WriteString(line)
+			content.WriteString("\n")
+		}
+		content.WriteString("\n")
+	}
+
+	if len(failed) > 0 {
+		return content.String(), &PartialExtractionError{Pages: failed}
+	}
+	return content.String(), nil
+}
+
+// isEdgeLine reports whether the i-th line is among the first or last lines of the page
+func (p pdfPage) isEdgeLine(i int) bool {
+	return i < pageEdgeLines || i >= len(p.lines)-pageEdgeLines
+}
+
+// pageLine is a normalized line found at the top or bottom of pages
+type pageLine struct {
+	pages   int
+	offsets []int  // Each number of the line minus the page number, where the line was first seen
+	follows []bool // Whether the number kept that offset on every page since, like a page number
+}
+
+// repeatedPageLines returns the normalized lines found at the top or bottom of more than half
+// of the pages, which are running headers and footers rather than content. Lines without
+// letters, such as amounts or table cells, are never taken for headers, and lines with numbers
+// only if one of them follows the page number, so "Trang 3 / 12" is a footer but "Điều 5" is not.
+func repeatedPageLines(pages []pdfPage) map[string]bool {
+	if len(pages) < minPagesForRepeatedLines {
+		return nil
+	}
+
+	lines := make(map[string]*pageLine)
+	for _, page := range pages {
+		seen := make(map[string]bool)
+		for i, line := range page.lines {
+			if !page.isEdgeLine(i) {
+				continue
+			}
+			key := normalizePageLine(line)
+			if !strings.ContainsFunc(key, unicode.IsLetter) || seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			numbers := pageNumberPattern.FindAllString(line, -1)
+			entry := lines[key]
+			if entry == nil {
+				entry = &pageLine{offsets: make([]int, len(numbers)), follows: make([]bool, len(numbers))}
+				for j, number := range numbers {
+					value, _ := strconv.Atoi(number)
+					entry.offsets[j], entry.follows[j] = value-page.number, true
+				}
+				lines[key] = entry
+			}
+			entry.pages++
+			for j, number := range numbers {
+				value, _ := strconv.Atoi(number)
+				entry.follows[j] = entry.follows[j] && value-page.number == entry.offsets[j]
+			}
+		}
+	}
+
+	repeated := make(map[string]bool)
+	for key, entry := range lines {
+		if entry.pages*2 > len(pages) && (len(entry.follows) == 0 || slices.Contains(entry.follows, true)) {
+			repeated[key] = true
+		}
+	}
+	return repeated
+}
+
+// normalizePageLine makes lines that differ only by spacing or page number compare equal
+func normalizePageLine(line string) string {
+	line = strings.Join(strings.Fields(line), " ")
+	return pageNumberPattern.ReplaceAllString(line, "#")
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testPages builds pages from their lines, separated by "|"
+func testPages(pages ...string) []pdfPage {
+	result := make([]pdfPage, len(pages))
+	for i, page := range pages {
+		result[i] = pdfPage{number: i + 1, lines: strings.Split(page, "|")}
+	}
+	return result
+}
+
+func TestRepeatedPageLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		pages []pdfPage
+		want  []string
+	}{
+		{
+			name: "running header and numbered footer",
+			pages: testPages(
+				"CÔNG TY ABC - Sổ tay nhân viên|Chương 1|Giới thiệu|Trang 1 / 3",
+				"CÔNG TY ABC - Sổ tay nhân viên|Chương 1|Nghỉ phép|Trang 2 / 3",
+				"CÔNG TY ABC - Sổ tay nhân viên|Chương 2|Lương|Trang 3 / 3",
+			),
+			want: []string{"CÔNG TY ABC - Sổ tay nhân viên", "Trang # / #"},
+		},
+		{
+			name: "printed page numbers offset from the PDF pages",
+			pages: testPages(
+				"Điều 5|Nghỉ phép năm|- 3 -",
+				"Điều 6|Nghỉ ốm|- 4 -",
+				"Điều 8|Nghỉ cưới|- 5 -",
+				"Điều 9|Thai sản|- 6 -",
+			),
+			want: nil,
+		},
+		{
+			name: "numbered headings that do not follow the page are content",
+			pages: testPages(
+				"Điều 5|Nghỉ phép năm|Trang 1",
+				"Điều 6|Nghỉ ốm|Trang 2",
+				"Điều 8|Nghỉ cưới|Trang 3",
+				"Điều 9|Thai sản|Trang 4",
+			),
+			want: []string{"Trang #"},
+		},
+		{
+			name: "spacing differences are ignored",
+			pages: testPages(
+				"Quy định  nội bộ|a",
+				" Quy định nội bộ|b",
+				"Quy định nội bộ |c",
+			),
+			want: []string{"Quy định nội bộ"},
+		},
+		{
+			name: "numbers and amounts are never headers",
+			pages: testPages(
+				"12|Số ngày nghỉ phép năm|1.500.000",
+				"12|Số ngày nghỉ ốm|1.500.000",
+				"12|Phụ cấp ăn trưa|1.500.000",
+			),
+			want: nil,
+		},
+		{
+			name: "lines on half of the pages or fewer are kept",
+			pages: testPages(
+				"Bản nháp|a",
+				"Bản nháp|b",
+				"c",
+				"d",
+			),
+			want: nil,
+		},
+		{
+			name: "repeated lines in the middle of a page are content",
+			pages: testPages(
+				"Tiêu đề|a1|a2|Xem phụ lục|a3|a4|Chân trang",
+				"Tiêu đề|b1|b2|Xem phụ lục|b3|b4|Chân trang",
+				"Tiêu đề|c1|c2|Xem phụ lục|c3|c4|Chân trang",
+			),
+			want: []string{"Chân trang", "Tiêu đề"},
+		},
+		{
+			name: "too few pages",
+			pages: testPages(
+				"CÔNG TY ABC|a",
+				"CÔNG TY ABC|b",
+			),
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for line := range repeatedPageLines(tt.pages) {
+				got = append(got, line)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("repeatedPageLines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitPageMarkers(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		wantContent string
+		wantPages   []docPage
+	}{
+		{"no pages", "Nội dung\n", "Nội dung\n", nil},
+		{
+			name:        "pages",
+			text:        pageMarker(1) + "\nĐiều 1\n\n" + pageMarker(2) + "\nĐiều 2\n\n",
+			wantContent: "Điều 1\n\nĐiều 2\n\n",
+			wantPages:   []docPage{{Offset: 0, Page: 1}, {Offset: 8, Page: 2}},
+		},
+		{
+			name:        "unreadable page skipped",
+			text:        pageMarker(1) + "\nMột\n\n" + pageMarker(3) + "\nBa\n\n",
+			wantContent: "Một\n\nBa\n\n",
+			wantPages:   []docPage{{Offset: 0, Page: 1}, {Offset: 5, Page: 3}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, pageBreaks := splitPageMarkers(tt.text)
+			if content != tt.wantContent {
+				t.Errorf("splitPageMarkers() content = %q, want %q", content, tt.wantContent)
+			}
+			if pages := documentPages(pageBreaks); !reflect.DeepEqual(pages, tt.wantPages) {
+				t.Errorf("splitPageMarkers() pages = %v, want %v", pages, tt.wantPages)
+			}
+		})
+	}
+}
+
+func TestPageAt(t *testing.T) {
+	pages := []docPage{{Offset: 0, Page: 1}, {Offset: 10, Page: 2}, {Offset: 25, Page: 4}}
+
+	tests := []struct {
+		offset int
+		want   int
+	}{
+		{0, 1},
+		{9, 1},
+		{10, 2},
+		{24, 2},
+		{25, 4},
+		{1000, 4},
+	}
+
+	for _, tt := range tests {
+		if got := pageAt(pages, tt.offset); got != tt.want {
+			t.Errorf("pageAt(%d) = %d, want %d", tt.offset, got, tt.want)
+		}
+	}
+
+	// Text before the first marker belongs to the first page
+	if got := pageAt([]docPage{{Offset: 5, Page: 2}}, 0); got != 2 {
+		t.Errorf("pageAt() before the first page = %d, want 2", got)
+	}
+}
+
+func TestAnnotateChunksPages(t *testing.T) {
+	content, pageBreaks := splitPageMarkers(pageMarker(1) + "\nNghỉ phép năm 12 ngày.\n\n" +
+		pageMarker(2) + "\nNghỉ ốm theo luật. Nghỉ cưới 3 ngày.\n\n" +
+		pageMarker(3) + "\nThai sản 6 tháng.\n\n")
+
+	chunks := []SemanticChunk{
+		{Content: "Nghỉ phép năm 12 ngày."},
+		{Content: "Nghỉ ốm theo luật."},
+		{Content: "Nghỉ cưới 3 ngày. Thai sản 6 tháng."},
+	}
+	annotateChunks(content, documentPages(pageBreaks), chunks)
+
+	want := [][2]int{{1, 1}, {2, 2}, {2, 3}}
+	for i, chunk := range chunks {
+		if got := [2]int{chunk.PageStart, chunk.PageEnd}; got != want[i] {
+			t.Errorf("chunk %d pages = %v, want %v", i, got, want[i])
+		}
+	}
+
+	// Documents without pages leave the page fields empty
+	chunks = []SemanticChunk{{Content: "Nghỉ phép năm 12 ngày."}}
+	annotateChunks(content, nil, chunks)
+	if chunks[0].PageStart != 0 || chunks[0].PageEnd != 0 {
+		t.Errorf("pages without page breaks = %d-%d, want 0-0", chunks[0].PageStart, chunks[0].PageEnd)
+	}
+}
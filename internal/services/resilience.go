@@ -0,0 +1,372 @@
+package services
+
+import (
+	"company-ai-training/internal/config"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// ErrCircuitOpen is returned without calling the provider while its circuit breaker is open
+var ErrCircuitOpen = errors.New("model provider is unavailable, circuit breaker is open")
+
+// ResilienceConfig controls retries, rate limiting and circuit breaking around model calls
+type ResilienceConfig struct {
+	MaxAttempts       int           // Attempts per call, including the first
+	BaseDelay         time.Duration // Backoff before the first retry, doubled for every further retry
+	MaxDelay          time.Duration // Upper bound of the backoff
+	RequestsPerMinute float64       // Client-side rate limit, 0 disables it
+	Burst             int           // Requests that may be sent at once when the limiter is idle
+	BreakerThreshold  int           // Consecutive failed attempts that open the breaker, 0 disables it
+	BreakerCooldown   time.Duration // How long the breaker stays open before a trial call
+}
+
+// resilienceConfig returns the resilience settings of the configuration
+func resilienceConfig(cfg *config.Config) ResilienceConfig {
+	return ResilienceConfig{
+		MaxAttempts:       cfg.LLMMaxAttempts,
+		BaseDelay:         cfg.LLMRetryBaseDelay,
+		MaxDelay:          cfg.LLMRetryMaxDelay,
+		RequestsPerMinute: cfg.LLMRequestsPerMinute,
+		Burst:             cfg.LLMRateBurst,
+		BreakerThreshold:  cfg.LLMBreakerThreshold,
+		BreakerCooldown:   cfg.LLMBreakerCooldown,
+	}
+}
+
+// resilience runs provider calls through a rate limiter, a circuit breaker and retries.
+// One instance is shared by every client calling a provider with the same credentials.
+type resilience struct {
+	name    string
+	cfg     ResilienceConfig
+	limiter *tokenBucket
+	breaker *circuitBreaker
+	sleep   func(time.Duration)
+}
+
+func newResilience(name string, cfg ResilienceConfig) *resilience {
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	return &resilience{
+		name:    name,
+		cfg:     cfg,
+		limiter: newTokenBucket(cfg.RequestsPerMinute/60, cfg.Burst),
+		breaker: newCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
+		sleep:   time.Sleep,
+	}
+}
+
+var (
+	sharedResilienceMu sync.Mutex
+	sharedResilience   = make(map[string]*resilience)
+)
+
+// resilienceFor returns the resilience state of calls to a provider with a credential, such as
+// an API key. Clients rebuilt for the same credential, e.g. when a tenant's settings are
+// reloaded, keep its rate limit and circuit breaker instead of starting afresh.
+func resilienceFor(name, provider, credential string, cfg ResilienceConfig) *resilience {
+	sum := sha256.Sum256([]byte(credential))
+	key := name + "|" + provider + "|" + hex.EncodeToString(sum[:])
+
+	sharedResilienceMu.Lock()
+	defer sharedResilienceMu.Unlock()
+	r, ok := sharedResilience[key]
+	if !ok {
+		r = newResilience(name, cfg)
+		sharedResilience[key] = r
+	}
+	return r
+}
+
+// do calls fn until it succeeds, fails with an error that is not worth retrying or runs out
+// of attempts. canRetry, if set, can veto a retry, e.g. once a stream has produced output.
+func (r *resilience) do(fn func() error, canRetry func() bool) error {
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		if err := r.breaker.allow(); err != nil {
+			if lastErr != nil {
+				return fmt.Errorf("%w (last error: %v)", err, lastErr)
+			}
+			return err
+		}
+		r.limiter.wait()
+
+		err := fn()
+		retryable := err != nil && isRetryableError(err)
+		// Any answer from the provider, even a rejection, shows it is up
+		r.breaker.record(!retryable)
+		if err == nil {
+			return nil
+		}
+
+		if !retryable || attempt >= r.cfg.MaxAttempts || (canRetry != nil && !canRetry()) {
+			return err
+		}
+		lastErr = err
+		delay := r.backoff(attempt)
+		log.Printf("%s call failed (attempt %d/%d), retrying in %v: %v", r.name, attempt, r.cfg.MaxAttempts, delay, err)
+		r.sleep(delay)
+	}
+}
+
+// backoff returns an exponential delay with jitter before retrying the given attempt
+func (r *resilience) backoff(attempt int) time.Duration {
+	delay := r.cfg.BaseDelay << uint(attempt-1)
+	if delay <= 0 || (r.cfg.MaxDelay > 0 && delay > r.cfg.MaxDelay) {
+		delay = r.cfg.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	// Randomizing the second half spreads out the retries of callers hitting the same error
+	return delay/2 + time.Duration(rand.Int63n(int64(delay)/2+1))
+}
+
+// isRetryableError reports whether a failed call may succeed if repeated: rate limiting,
+// server errors, timeouts and dropped connections
+func isRetryableError(err error) bool {
+	if errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		return isRetryableStatus(apiErr.Code)
+	}
+	var ollamaErr *OllamaAPIError
+	if errors.As(err, &ollamaErr) {
+		return isRetryableStatus(ollamaErr.StatusCode)
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// isRetryableStatus reports whether an HTTP status signals a temporary condition
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// tokenBucket is a client-side rate limiter refilled at a constant rate
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // Tokens added per second, 0 means unlimited
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+	sleep  func(time.Duration)
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	burstSize := float64(max(burst, 1))
+	return &tokenBucket{rate: rate, burst: burstSize, tokens: burstSize, last: time.Now(), now: time.Now, sleep: time.Sleep}
+}
+
+// wait blocks until a request may be sent. Waiting callers reserve their token up front,
+// so they are served in arrival order.
+func (b *tokenBucket) wait() {
+	if b.rate <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	now := b.now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	deficit := -b.tokens
+	b.mu.Unlock()
+
+	if deficit > 0 {
+		b.sleep(time.Duration(deficit / b.rate * float64(time.Second)))
+	}
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker stops calling a provider after consecutive failures. Once the cooldown has
+// passed a single trial call is let through, which closes the breaker again if it succeeds.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     breakerState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	now       func() time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// allow returns ErrCircuitOpen if the call must not reach the provider
+func (b *circuitBreaker) allow() error {
+	if b.threshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return nil
+	case breakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record updates the breaker with the outcome of a call let through by allow
+func (b *circuitBreaker) record(success bool) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if success {
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		if b.state != breakerOpen {
+			log.Printf("Circuit breaker opened after %d consecutive failures", b.failures)
+		}
+		b.state = breakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// ResilientChatModel retries, rate limits and circuit breaks the calls of a chat model
+type ResilientChatModel struct {
+	model      ChatModel
+	resilience *resilience
+}
+
+func NewResilientChatModel(model ChatModel, cfg ResilienceConfig) *ResilientChatModel {
+	return &ResilientChatModel{model: model, resilience: newResilience("Chat model", cfg)}
+}
+
+// Chat generates the reply, retrying temporary failures
+func (m *ResilientChatModel) Chat(messages []Message) (string, error) {
+	var response string
+	err := m.resilience.do(func() error {
+		var err error
+		response, err = m.model.Chat(messages)
+		return err
+	}, nil)
+	return response, err
+}
+
+// ChatStream streams the reply. A failed stream is only retried if it has not passed any
+// text to onChunk yet, as the caller cannot take back what it has already shown.
+func (m *ResilientChatModel) ChatStream(messages []Message, onChunk func(string) error) (string, error) {
+	var response string
+	started := false
+	err := m.resilience.do(func() error {
+		var err error
+		response, err = m.model.ChatStream(messages, func(text string) error {
+			started = true
+			return onChunk(text)
+		})
+		return err
+	}, func() bool { return !started })
+	return response, err
+}
+
+// ResilientEmbedder retries, rate limits and circuit breaks the calls of an embedder
+type ResilientEmbedder struct {
+	embedder   Embedder
+	resilience *resilience
+}
+
+// resilientBatchEmbedder is a ResilientEmbedder for an embedder that supports batching
+type resilientBatchEmbedder struct {
+	*ResilientEmbedder
+	batcher BatchEmbedder
+}
+
+// NewResilientEmbedder wraps embedder, keeping its batch support if it has any
+func NewResilientEmbedder(embedder Embedder, cfg ResilienceConfig) Embedder {
+	return newResilientEmbedder(embedder, newResilience("Embedding", cfg))
+}
+
+func newResilientEmbedder(embedder Embedder, r *resilience) Embedder {
+	resilient := &ResilientEmbedder{embedder: embedder, resilience: r}
+	if batcher, ok := embedder.(BatchEmbedder); ok {
+		return &resilientBatchEmbedder{ResilientEmbedder: resilient, batcher: batcher}
+	}
+	return resilient
+}
+
+// GenerateEmbedding embeds text, retrying temporary failures
+func (e *ResilientEmbedder) GenerateEmbedding(text string) ([]float32, error) {
+	var embedding []float32
+	err := e.resilience.do(func() error {
+		var err error
+		embedding, err = e.embedder.GenerateEmbedding(text)
+		return err
+	}, nil)
+	return embedding, err
+}
+
+func (e *ResilientEmbedder) ModelName() string {
+	return e.embedder.ModelName()
+}
+
+func (e *ResilientEmbedder) Dimension() int {
+	return e.embedder.Dimension()
+}
+
+// GenerateEmbeddings embeds a batch of texts, retrying temporary failures of the whole batch
+func (e *resilientBatchEmbedder) GenerateEmbeddings(texts []string) ([][]float32, error) {
+	var embeddings [][]float32
+	err := e.resilience.do(func() error {
+		var err error
+		embeddings, err = e.batcher.GenerateEmbeddings(texts)
+		return err
+	}, nil)
+	return embeddings, err
+}
@@ -0,0 +1,432 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"gemini rate limited", genai.APIError{Code: 429}, true},
+		{"gemini server error", genai.APIError{Code: 500}, true},
+		{"gemini unavailable", genai.APIError{Code: 503}, true},
+		{"gemini bad request", genai.APIError{Code: 400}, false},
+		{"gemini permission denied", genai.APIError{Code: 403}, false},
+		{"ollama timeout", &OllamaAPIError{StatusCode: 408}, true},
+		{"ollama bad gateway", &OllamaAPIError{StatusCode: 502}, true},
+		{"ollama gateway timeout", &OllamaAPIError{StatusCode: 504}, true},
+		{"ollama model not found", &OllamaAPIError{StatusCode: 404}, false},
+		{"wrapped api error", fmt.Errorf("failed to embed: %w", genai.APIError{Code: 429}), true},
+		{"deadline exceeded", context.DeadlineExceeded, true},
+		{"truncated response", io.ErrUnexpectedEOF, true},
+		{"network error", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"circuit open", ErrCircuitOpen, false},
+		{"other error", errors.New("text cannot be empty"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryableError(tt.err); got != tt.want {
+				t.Errorf("isRetryableError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResilienceBackoffBounds(t *testing.T) {
+	r := newResilience("test", ResilienceConfig{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second})
+
+	tests := []struct {
+		attempt int
+		full    time.Duration // Delay before jitter
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{40, time.Second},
+		{80, time.Second},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			delay := r.backoff(tt.attempt)
+			if delay < tt.full/2 || delay > tt.full {
+				t.Fatalf("backoff(%d) = %v, want between %v and %v", tt.attempt, delay, tt.full/2, tt.full)
+			}
+		}
+	}
+}
+
+// fakeClock is a manually advanced clock whose sleeps advance it
+type fakeClock struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+}
+
+func TestTokenBucket(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	bucket := newTokenBucket(10, 2) // 10 requests per second, bursts of 2
+	bucket.now, bucket.sleep, bucket.last = clock.Now, clock.Sleep, clock.now
+
+	tests := []struct {
+		name    string
+		advance time.Duration // Idle time before the request
+		wait    time.Duration // Expected wait, 0 if the request goes out at once
+	}{
+		{"first of burst", 0, 0},
+		{"second of burst", 0, 0},
+		{"burst used up", 0, 100 * time.Millisecond},
+		{"next token", 0, 100 * time.Millisecond},
+		{"partially refilled", 50 * time.Millisecond, 50 * time.Millisecond},
+		{"refilled after idle", time.Second, 0},
+		{"refill capped at burst", 0, 0},
+		{"burst used up again", 0, 100 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		clock.now = clock.now.Add(tt.advance)
+		clock.sleeps = nil
+		bucket.wait()
+
+		var waited time.Duration
+		for _, d := range clock.sleeps {
+			waited += d
+		}
+		if diff := waited - tt.wait; diff < -time.Millisecond || diff > time.Millisecond {
+			t.Errorf("%s: waited %v, want %v", tt.name, waited, tt.wait)
+		}
+	}
+}
+
+func TestTokenBucketUnlimited(t *testing.T) {
+	bucket := newTokenBucket(0, 1)
+	bucket.sleep = func(time.Duration) { t.Fatal("unlimited bucket must not wait") }
+	for i := 0; i < 100; i++ {
+		bucket.wait()
+	}
+}
+
+func TestCircuitBreakerCycle(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	breaker := newCircuitBreaker(2, time.Minute)
+	breaker.now = clock.Now
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		allowed bool  // Whether allow lets the call through
+		outcome *bool // Recorded outcome of an allowed call, nil records nothing
+		state   breakerState
+	}{
+		{"closed lets calls through", 0, true, boolPtr(false), breakerClosed},
+		{"second failure opens", 0, true, boolPtr(false), breakerOpen},
+		{"open rejects calls", 0, false, nil, breakerOpen},
+		{"still open before cooldown", 59 * time.Second, false, nil, breakerOpen},
+		{"cooldown lets a probe through", time.Second, true, nil, breakerHalfOpen},
+		{"only one probe at a time", 0, false, nil, breakerHalfOpen},
+		{"failed probe reopens", 0, false, boolPtr(false), breakerOpen},
+		{"reopened rejects calls", 30 * time.Second, false, nil, breakerOpen},
+		{"second cooldown probe", time.Minute, true, nil, breakerHalfOpen},
+		{"successful probe closes", 0, false, boolPtr(true), breakerClosed},
+		{"closed again", 0, true, boolPtr(false), breakerClosed},
+		{"success resets the count", 0, true, boolPtr(true), breakerClosed},
+		{"one failure stays closed", 0, true, boolPtr(false), breakerClosed},
+	}
+
+	for _, step := range steps {
+		clock.now = clock.now.Add(step.advance)
+		if step.allowed {
+			if err := breaker.allow(); err != nil {
+				t.Fatalf("%s: allow() = %v, want nil", step.name, err)
+			}
+		} else if step.outcome == nil {
+			if err := breaker.allow(); !errors.Is(err, ErrCircuitOpen) {
+				t.Fatalf("%s: allow() = %v, want ErrCircuitOpen", step.name, err)
+			}
+		}
+		if step.outcome != nil {
+			breaker.record(*step.outcome)
+		}
+		if breaker.state != step.state {
+			t.Fatalf("%s: state = %v, want %v", step.name, breaker.state, step.state)
+		}
+	}
+}
+
+func boolPtr(b bool) *bool { return &b }
+
+// fakeChatModel fails with the queued errors before answering
+type fakeChatModel struct {
+	errs   []error
+	chunks []string // Streamed before failing with the next queued error
+	calls  int
+}
+
+func (m *fakeChatModel) next() error {
+	m.calls++
+	if len(m.errs) == 0 {
+		return nil
+	}
+	err := m.errs[0]
+	m.errs = m.errs[1:]
+	return err
+}
+
+func (m *fakeChatModel) Chat(messages []Message) (string, error) {
+	if err := m.next(); err != nil {
+		return "", err
+	}
+	return "reply", nil
+}
+
+func (m *fakeChatModel) ChatStream(messages []Message, onChunk func(string) error) (string, error) {
+	for _, chunk := range m.chunks {
+		if err := onChunk(chunk); err != nil {
+			return "", err
+		}
+	}
+	if err := m.next(); err != nil {
+		return "", err
+	}
+	if err := onChunk("reply"); err != nil {
+		return "", err
+	}
+	return "reply", nil
+}
+
+// testResilience makes the model retry without waiting
+func testResilience(model *ResilientChatModel) *ResilientChatModel {
+	model.resilience.sleep = func(time.Duration) {}
+	return model
+}
+
+func TestResilientChatModel(t *testing.T) {
+	tests := []struct {
+		name      string
+		errs      []error
+		cfg       ResilienceConfig
+		wantCalls int
+		wantCode  int  // Status of the returned API error, 0 if the call succeeds
+		wantOpen  bool // Whether the call fails with ErrCircuitOpen
+	}{
+		{
+			name:      "succeeds at once",
+			cfg:       ResilienceConfig{MaxAttempts: 3},
+			wantCalls: 1,
+		},
+		{
+			name:      "retries rate limiting and server errors",
+			errs:      []error{genai.APIError{Code: 429}, &OllamaAPIError{StatusCode: 503}},
+			cfg:       ResilienceConfig{MaxAttempts: 3},
+			wantCalls: 3,
+		},
+		{
+			name:      "does not retry a bad request",
+			errs:      []error{genai.APIError{Code: 400, Message: "invalid"}},
+			cfg:       ResilienceConfig{MaxAttempts: 3},
+			wantCalls: 1,
+			wantCode:  400,
+		},
+		{
+			name:      "gives up after max attempts",
+			errs:      []error{genai.APIError{Code: 500}, genai.APIError{Code: 500}, genai.APIError{Code: 500}, nil},
+			cfg:       ResilienceConfig{MaxAttempts: 3},
+			wantCalls: 3,
+			wantCode:  500,
+		},
+		{
+			name:      "breaker stops retries",
+			errs:      []error{genai.APIError{Code: 503}, genai.APIError{Code: 503}, nil},
+			cfg:       ResilienceConfig{MaxAttempts: 5, BreakerThreshold: 2, BreakerCooldown: time.Minute},
+			wantCalls: 2,
+			wantOpen:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeChatModel{errs: tt.errs}
+			model := testResilience(NewResilientChatModel(fake, tt.cfg))
+
+			reply, err := model.Chat([]Message{{Role: "user", Content: "hi"}})
+			if fake.calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", fake.calls, tt.wantCalls)
+			}
+			var apiErr genai.APIError
+			switch {
+			case tt.wantOpen:
+				if !errors.Is(err, ErrCircuitOpen) {
+					t.Errorf("Chat() error = %v, want ErrCircuitOpen", err)
+				}
+			case tt.wantCode != 0:
+				if !errors.As(err, &apiErr) || apiErr.Code != tt.wantCode {
+					t.Errorf("Chat() error = %v, want API error %d", err, tt.wantCode)
+				}
+			case err != nil || reply != "reply":
+				t.Errorf("Chat() = %q, %v, want reply", reply, err)
+			}
+		})
+	}
+}
+
+func TestResilientChatModelOpenBreakerSkipsProvider(t *testing.T) {
+	fake := &fakeChatModel{errs: []error{genai.APIError{Code: 503}}}
+	model := testResilience(NewResilientChatModel(fake, ResilienceConfig{MaxAttempts: 1, BreakerThreshold: 1, BreakerCooldown: time.Minute}))
+
+	if _, err := model.Chat(nil); err == nil {
+		t.Fatal("first call should fail")
+	}
+	if _, err := model.Chat(nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Chat() error = %v, want ErrCircuitOpen", err)
+	}
+	if fake.calls != 1 {
+		t.Errorf("calls = %d, want 1", fake.calls)
+	}
+}
+
+func TestResilientChatStream(t *testing.T) {
+	tests := []struct {
+		name       string
+		chunks     []string
+		wantCalls  int
+		wantErr    bool
+		wantChunks int
+	}{
+		{"retries before the first chunk", nil, 2, false, 1},
+		{"does not retry after a chunk", []string{"partial"}, 1, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeChatModel{errs: []error{genai.APIError{Code: 503}}, chunks: tt.chunks}
+			model := testResilience(NewResilientChatModel(fake, ResilienceConfig{MaxAttempts: 3}))
+
+			var received []string
+			_, err := model.ChatStream(nil, func(chunk string) error {
+				received = append(received, chunk)
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ChatStream() error = %v, want error %v", err, tt.wantErr)
+			}
+			if fake.calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", fake.calls, tt.wantCalls)
+			}
+			if len(received) != tt.wantChunks {
+				t.Errorf("received %d chunks, want %d", len(received), tt.wantChunks)
+			}
+		})
+	}
+}
+
+// fakeEmbedder fails with the queued errors before returning vectors
+type fakeEmbedder struct {
+	errs  []error
+	calls int
+}
+
+func (e *fakeEmbedder) next() error {
+	e.calls++
+	if len(e.errs) == 0 {
+		return nil
+	}
+	err := e.errs[0]
+	e.errs = e.errs[1:]
+	return err
+}
+
+func (e *fakeEmbedder) GenerateEmbedding(text string) ([]float32, error) {
+	if err := e.next(); err != nil {
+		return nil, err
+	}
+	return []float32{1, 0}, nil
+}
+
+func (e *fakeEmbedder) ModelName() string { return "fake" }
+func (e *fakeEmbedder) Dimension() int    { return 2 }
+
+// fakeBatchEmbedder is a fakeEmbedder that also embeds batches
+type fakeBatchEmbedder struct {
+	fakeEmbedder
+}
+
+func (e *fakeBatchEmbedder) GenerateEmbeddings(texts []string) ([][]float32, error) {
+	if err := e.next(); err != nil {
+		return nil, err
+	}
+	embeddings := make([][]float32, len(texts))
+	for i := range texts {
+		embeddings[i] = []float32{1, 0}
+	}
+	return embeddings, nil
+}
+
+func TestResilientEmbedder(t *testing.T) {
+	fake := &fakeEmbedder{errs: []error{&OllamaAPIError{StatusCode: 429}, &OllamaAPIError{StatusCode: 502}}}
+	embedder := NewResilientEmbedder(fake, ResilienceConfig{MaxAttempts: 3})
+	embedder.(*ResilientEmbedder).resilience.sleep = func(time.Duration) {}
+
+	if _, ok := embedder.(BatchEmbedder); ok {
+		t.Error("an embedder without batching must not gain it")
+	}
+	embedding, err := embedder.GenerateEmbedding("text")
+	if err != nil || len(embedding) != 2 {
+		t.Fatalf("GenerateEmbedding() = %v, %v", embedding, err)
+	}
+	if fake.calls != 3 {
+		t.Errorf("calls = %d, want 3", fake.calls)
+	}
+}
+
+func TestResilientBatchEmbedder(t *testing.T) {
+	fake := &fakeBatchEmbedder{fakeEmbedder{errs: []error{genai.APIError{Code: 500}}}}
+	embedder := NewResilientEmbedder(fake, ResilienceConfig{MaxAttempts: 3})
+	embedder.(*resilientBatchEmbedder).resilience.sleep = func(time.Duration) {}
+
+	batcher, ok := embedder.(BatchEmbedder)
+	if !ok {
+		t.Fatal("batch support was lost")
+	}
+	embeddings, err := batcher.GenerateEmbeddings([]string{"a", "b", "c"})
+	if err != nil || len(embeddings) != 3 {
+		t.Fatalf("GenerateEmbeddings() = %v, %v", embeddings, err)
+	}
+	if fake.calls != 2 {
+		t.Errorf("calls = %d, want 2", fake.calls)
+	}
+}
+
+func TestResilienceForSharesStatePerCredential(t *testing.T) {
+	cfg := ResilienceConfig{MaxAttempts: 2}
+	first := resilienceFor("Chat model", "gemini", "key-a", cfg)
+
+	if again := resilienceFor("Chat model", "gemini", "key-a", cfg); again != first {
+		t.Error("clients with the same API key must share their resilience state")
+	}
+	if other := resilienceFor("Chat model", "gemini", "key-b", cfg); other == first {
+		t.Error("clients with different API keys must not share their resilience state")
+	}
+	if embedding := resilienceFor("Embedding", "gemini", "key-a", cfg); embedding == first {
+		t.Error("chat and embedding calls must not share their resilience state")
+	}
+}
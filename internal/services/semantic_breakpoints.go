@@ -0,0 +1,223 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Breakpoint modes of ChunkConfig
+const (
+	ChunkBreakpointsBoundaries = "boundaries" // Paragraph, sentence and heading boundaries found by patterns
+	ChunkBreakpointsPercentile = "percentile" // Topic shifts where adjacent similarity is in the lowest BreakpointPercentile percent
+	ChunkBreakpointsThreshold  = "threshold"  // Topic shifts where adjacent similarity is below SimilarityThreshold
+)
+
+// sentenceEndPattern matches the end of a sentence: closing punctuation followed by whitespace,
+// which leaves decimals and abbreviations such as "3.5" alone, or a line break
+var sentenceEndPattern = regexp.MustCompile(`[.!?]+(?:\s+|$)|\n\s*`)
+
+// textSpan is a byte range of the text being chunked
+type textSpan struct {
+	start, end int
+}
+
+// embeddingUsage counts what was sent to the embedding provider for a document
+type embeddingUsage struct {
+	BreakpointTexts int // Sentence windows embedded to find topic shifts
+	ChunkTexts      int // Chunks embedded for search
+	Tokens          int // Estimated tokens of every embedded text
+	CacheHits       int // Texts served from the embedding cache, not counted above
+}
+
+// add records the embedding of texts, of which only sent went to the provider
+func (u *embeddingUsage) add(texts, sent []string, breakpoints bool) {
+	if breakpoints {
+		u.BreakpointTexts += len(sent)
+	} else {
+		u.ChunkTexts += len(sent)
+	}
+	for _, text := range sent {
+		u.Tokens += estimateTokens(text)
+	}
+	u.CacheHits += len(texts) - len(sent)
+}
+
+// usesEmbeddingBreakpoints reports whether the configuration finds breakpoints with embeddings
+func (c *ChunkConfig) usesEmbeddingBreakpoints() bool {
+	return c.BreakpointMode == ChunkBreakpointsPercentile || c.BreakpointMode == ChunkBreakpointsThreshold
+}
+
+// Validate checks that the configuration describes a possible chunking
+func (c *ChunkConfig) Validate() error {
+	switch c.BreakpointMode {
+	case "", ChunkBreakpointsBoundaries, ChunkBreakpointsPercentile, ChunkBreakpointsThreshold, ChunkBreakpointsStructure:
+	default:
+		return fmt.Errorf("invalid breakpoint_mode %q, expected boundaries, percentile, threshold or structure", c.BreakpointMode)
+	}
+	if c.MaxChunkSize <= 0 {
+		return fmt.Errorf("max_chunk_size must be positive")
+	}
+	if c.MinChunkSize < 0 || c.MinChunkSize > c.MaxChunkSize {
+		return fmt.Errorf("min_chunk_size must be between 0 and max_chunk_size")
+	}
+	if c.OverlapSize < 0 {
+		return fmt.Errorf("overlap_size must not be negative")
+	}
+	if c.BreakpointPercentile < 0 || c.BreakpointPercentile > 100 {
+		return fmt.Errorf("breakpoint_percentile must be between 0 and 100")
+	}
+	if c.SimilarityThreshold < -1 || c.SimilarityThreshold > 1 {
+		return fmt.Errorf("similarity_threshold must be between -1 and 1")
+	}
+	if c.WindowSize < 0 || c.WindowSize > 5 {
+		return fmt.Errorf("window_size must be between 0 and 5")
+	}
+	return nil
+}
+
+// createEmbeddingBreakpointChunks splits text at topic shifts. Every sentence is embedded together
+// with WindowSize sentences on each side, and a chunk may end after a sentence whose window is
+// dissimilar to the next one. Chunks are cut there once they reach MinChunkSize, and always
+// before they would exceed MaxChunkSize.
+func (s *SemanticChunkingService) createEmbeddingBreakpointChunks(text string, config *ChunkConfig, usage *embeddingUsage) ([]SemanticChunk, error) {
+	sentences := s.splitSentences(text, config.MaxChunkSize)
+	if len(sentences) == 0 {
+		return nil, nil
+	}
+
+	breaks := make([]bool, len(sentences))
+	if len(sentences) > 1 {
+		windows := make([]string, len(sentences))
+		for i := range sentences {
+			first := sentences[max(i-config.WindowSize, 0)]
+			last := sentences[min(i+config.WindowSize, len(sentences)-1)]
+			windows[i] = strings.TrimSpace(text[first.start:last.end])
+		}
+
+		embeddings, sent, err := embedTexts(s.embedder, windows, s.embedConfig, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed sentences: %w", err)
+		}
+		usage.add(windows, sent, true)
+
+		similarities := make([]float64, len(sentences)-1)
+		for i := range similarities {
+			similarities[i] = s.cosineSimilarity(embeddings[i], embeddings[i+1])
+		}
+		breaks = s.findBreakpoints(similarities, config)
+	}
+
+	chunks := groupSentences(text, sentences, breaks, config.MinChunkSize, config.MaxChunkSize)
+	return s.applyOverlap(chunks, config.OverlapSize), nil
+}
+
+// groupSentences joins consecutive sentences into chunks. A chunk ends after a sentence marked
+// in breaks once it has minSize bytes, and before the next sentence would take it over maxSize.
+func groupSentences(text string, sentences []textSpan, breaks []bool, minSize, maxSize int) []SemanticChunk {
+	var chunks []SemanticChunk
+	emit := func(start, end int) {
+		if content := strings.TrimSpace(text[start:end]); content != "" {
+			chunks = append(chunks, SemanticChunk{Content: content, StartIndex: start, EndIndex: end})
+		}
+	}
+
+	start := sentences[0].start
+	for i, sentence := range sentences {
+		if i == len(sentences)-1 {
+			emit(start, sentence.end)
+			break
+		}
+		size := sentence.end - start
+		if sentences[i+1].end-start > maxSize || (breaks[i] && size >= minSize) {
+			emit(start, sentence.end)
+			start = sentences[i+1].start
+		}
+	}
+
+	// A short tail belongs with the chunk before it if they fit together
+	if n := len(chunks); n > 1 {
+		last, prev := chunks[n-1], chunks[n-2]
+		if len(last.Content) < minSize && last.EndIndex-prev.StartIndex <= maxSize {
+			chunks = chunks[:n-2]
+			emit(prev.StartIndex, last.EndIndex)
+		}
+	}
+
+	return chunks
+}
+
+// findBreakpoints marks the sentences after which the topic shifts, given the similarity of
+// every sentence window to the next one
+func (s *SemanticChunkingService) findBreakpoints(similarities []float64, config *ChunkConfig) []bool {
+	breaks := make([]bool, len(similarities)+1)
+
+	if config.BreakpointMode == ChunkBreakpointsThreshold {
+		for i, similarity := range similarities {
+			breaks[i] = similarity < config.SimilarityThreshold
+		}
+		return breaks
+	}
+
+	if config.BreakpointPercentile <= 0 {
+		return breaks
+	}
+	cutoff := percentile(similarities, config.BreakpointPercentile)
+	for i, similarity := range similarities {
+		breaks[i] = similarity <= cutoff
+	}
+	return breaks
+}
+
+// percentile returns the nearest-rank p-th percentile of values
+func percentile(values []float64, p float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	return sorted[min(max(rank, 0), len(sorted)-1)]
+}
+
+// splitSentences splits text into consecutive sentences covering all of it. Whitespace-only
+// pieces join the sentence before them and sentences longer than maxSize are cut at word boundaries.
+func (s *SemanticChunkingService) splitSentences(text string, maxSize int) []textSpan {
+	var spans []textSpan
+	start := 0
+	appendSpan := func(end int) {
+		if strings.TrimSpace(text[start:end]) == "" && len(spans) > 0 {
+			spans[len(spans)-1].end = end
+		} else if end > start {
+			spans = append(spans, textSpan{start, end})
+		}
+		start = end
+	}
+
+	for _, match := range sentenceEndPattern.FindAllStringIndex(text, -1) {
+		for match[1]-start > maxSize {
+			appendSpan(s.splitPoint(text, start, match[1], maxSize))
+		}
+		appendSpan(match[1])
+	}
+	for len(text)-start > maxSize {
+		appendSpan(s.splitPoint(text, start, len(text), maxSize))
+	}
+	if start < len(text) {
+		appendSpan(len(text))
+	}
+	return spans
+}
+
+// splitPoint returns where to cut text[start:end] to keep at most maxSize bytes, preferring
+// sentence and word boundaries and never splitting a character
+func (s *SemanticChunkingService) splitPoint(text string, start, end, maxSize int) int {
+	split := s.findBestSplitPoint(text, start, end, maxSize)
+	if split <= start || split > start+maxSize {
+		split = start + maxSize
+	}
+	for split > start+1 && split < len(text) && !utf8.RuneStart(text[split]) {
+		split--
+	}
+	return split
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// topicEmbedder embeds texts about leave and texts about pay in orthogonal directions
+type topicEmbedder struct {
+	texts int
+}
+
+func (e *topicEmbedder) GenerateEmbedding(text string) ([]float32, error) {
+	e.texts++
+	if strings.Contains(strings.ToLower(text), "lương") {
+		return []float32{0, 1}, nil
+	}
+	return []float32{1, 0}, nil
+}
+
+func (e *topicEmbedder) ModelName() string { return "topic" }
+func (e *topicEmbedder) Dimension() int    { return 2 }
+
+func TestChunkConfigValidate(t *testing.T) {
+	valid := func(change func(c *ChunkConfig)) *ChunkConfig {
+		c := DefaultChunkConfig()
+		change(c)
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		config  *ChunkConfig
+		wantErr bool
+	}{
+		{"default", DefaultChunkConfig(), false},
+		{"percentile", valid(func(c *ChunkConfig) { c.BreakpointMode = ChunkBreakpointsPercentile }), false},
+		{"structure", valid(func(c *ChunkConfig) { c.BreakpointMode = ChunkBreakpointsStructure }), false},
+		{"unknown mode", valid(func(c *ChunkConfig) { c.BreakpointMode = "words" }), true},
+		{"no max size", valid(func(c *ChunkConfig) { c.MaxChunkSize = 0 }), true},
+		{"min above max", valid(func(c *ChunkConfig) { c.MinChunkSize = c.MaxChunkSize + 1 }), true},
+		{"negative overlap", valid(func(c *ChunkConfig) { c.OverlapSize = -1 }), true},
+		{"percentile above 100", valid(func(c *ChunkConfig) { c.BreakpointPercentile = 101 }), true},
+		{"threshold below -1", valid(func(c *ChunkConfig) { c.SimilarityThreshold = -1.5 }), true},
+		{"window too large", valid(func(c *ChunkConfig) { c.WindowSize = 6 }), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	values := []float64{0.9, 0.1, 0.5, 0.7, 0.3}
+
+	tests := []struct {
+		p    float64
+		want float64
+	}{
+		{0, 0.1},
+		{10, 0.1},
+		{40, 0.3},
+		{50, 0.5},
+		{100, 0.9},
+	}
+
+	for _, tt := range tests {
+		if got := percentile(values, tt.p); got != tt.want {
+			t.Errorf("percentile(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+	if !reflect.DeepEqual(values, []float64{0.9, 0.1, 0.5, 0.7, 0.3}) {
+		t.Error("percentile() reordered its input")
+	}
+}
+
+func TestFindBreakpoints(t *testing.T) {
+	service := &SemanticChunkingService{}
+	similarities := []float64{0.9, 0.2, 0.8, 0.4, 0.95}
+
+	tests := []struct {
+		name   string
+		config *ChunkConfig
+		want   []bool
+	}{
+		{"threshold", &ChunkConfig{BreakpointMode: ChunkBreakpointsThreshold, SimilarityThreshold: 0.5}, []bool{false, true, false, true, false, false}},
+		{"lowest percentile", &ChunkConfig{BreakpointMode: ChunkBreakpointsPercentile, BreakpointPercentile: 20}, []bool{false, true, false, false, false, false}},
+		{"lowest 40 percent", &ChunkConfig{BreakpointMode: ChunkBreakpointsPercentile, BreakpointPercentile: 40}, []bool{false, true, false, true, false, false}},
+		{"no percentile", &ChunkConfig{BreakpointMode: ChunkBreakpointsPercentile}, make([]bool, 6)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := service.findBreakpoints(similarities, tt.config); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findBreakpoints() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitSentences(t *testing.T) {
+	service := &SemanticChunkingService{}
+	text := "Nghỉ phép năm 12 ngày. Lương 3.5 triệu!\nĐiều 6\n\n" + strings.Repeat("rất dài ", 10)
+
+	spans := service.splitSentences(text, 30)
+
+	// Sentences cover the text without gaps, stay within the size and keep characters whole
+	pos := 0
+	var sentences []string
+	for _, span := range spans {
+		if span.start != pos {
+			t.Fatalf("sentence starts at %d, want %d", span.start, pos)
+		}
+		if span.end-span.start > 30 {
+			t.Errorf("sentence %q is longer than 30 bytes", text[span.start:span.end])
+		}
+		if !utf8.ValidString(text[span.start:span.end]) {
+			t.Errorf("sentence %q splits a character", text[span.start:span.end])
+		}
+		sentences = append(sentences, strings.TrimSpace(text[span.start:span.end]))
+		pos = span.end
+	}
+	if pos != len(text) {
+		t.Errorf("sentences end at %d, want %d", pos, len(text))
+	}
+	if sentences[0] != "Nghỉ phép năm 12 ngày." || sentences[1] != "Lương 3.5 triệu!" || sentences[2] != "Điều 6" {
+		t.Errorf("sentences = %q, want the decimal kept in its sentence", sentences)
+	}
+}
+
+func TestGroupSentences(t *testing.T) {
+	text := "Một. Hai. Ba. Bốn. Năm."
+	sentences := (&SemanticChunkingService{}).splitSentences(text, 100)
+
+	tests := []struct {
+		name    string
+		breaks  []bool
+		minSize int
+		maxSize int
+		want    []string
+	}{
+		{"no breaks", make([]bool, 5), 0, 100, []string{"Một. Hai. Ba. Bốn. Năm."}},
+		{"cut at breaks", []bool{false, true, false, true, false}, 0, 100, []string{"Một. Hai.", "Ba. Bốn.", "Năm."}},
+		{"breaks before min size are skipped", []bool{true, false, true, false, false}, 8, 100, []string{"Một. Hai. Ba.", "Bốn. Năm."}},
+		{"max size cuts without a break", make([]bool, 5), 0, 12, []string{"Một. Hai.", "Ba. Bốn.", "Năm."}},
+		{"short tail joins the chunk before", []bool{false, false, false, true, false}, 6, 100, []string{"Một. Hai. Ba. Bốn. Năm."}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, chunk := range groupSentences(text, sentences, tt.breaks, tt.minSize, tt.maxSize) {
+				got = append(got, chunk.Content)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groupSentences() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateEmbeddingBreakpointChunks(t *testing.T) {
+	embedder := &topicEmbedder{}
+	service := &SemanticChunkingService{embedder: embedder, embedConfig: EmbedConfig{BatchSize: 8, Concurrency: 2}}
+	text := "Nghỉ phép năm 12 ngày. Nghỉ ốm cần giấy. Nghỉ cưới 3 ngày. " +
+		"Tiền lương trả ngày 5. Lương tháng 13 theo kết quả. Tăng lương mỗi năm."
+
+	config := &ChunkConfig{BreakpointMode: ChunkBreakpointsThreshold, SimilarityThreshold: 0.5, MaxChunkSize: 1000}
+	var usage embeddingUsage
+	chunks, err := service.createEmbeddingBreakpointChunks(text, config, &usage)
+	if err != nil {
+		t.Fatalf("createEmbeddingBreakpointChunks() error = %v", err)
+	}
+
+	var got []string
+	for _, chunk := range chunks {
+		got = append(got, chunk.Content)
+	}
+	want := []string{
+		"Nghỉ phép năm 12 ngày. Nghỉ ốm cần giấy. Nghỉ cưới 3 ngày.",
+		"Tiền lương trả ngày 5. Lương tháng 13 theo kết quả. Tăng lương mỗi năm.",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("chunks = %q, want %q", got, want)
+	}
+
+	// One window per sentence, all sent to the embedder
+	if embedder.texts != 6 || usage.BreakpointTexts != 6 || usage.ChunkTexts != 0 || usage.CacheHits != 0 {
+		t.Errorf("embedded %d texts, usage = %+v, want 6 breakpoint texts", embedder.texts, usage)
+	}
+	if usage.Tokens == 0 {
+		t.Error("usage.Tokens = 0, want the estimated tokens of the windows")
+	}
+}
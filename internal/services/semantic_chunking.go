@@ -14,17 +14,21 @@ import (
 
 // SemanticChunkingService handles semantic-based document chunking
 type SemanticChunkingService struct {
-	db           *gorm.DB
-	geminiClient *GeminiClientV2
+	db          *gorm.DB
+	embedder    Embedder
+	embedConfig EmbedConfig
 }
 
 // ChunkConfig holds configuration for semantic chunking
 type ChunkConfig struct {
-	MinChunkSize          int     // Minimum chunk size in characters
-	MaxChunkSize          int     // Maximum chunk size in characters
-	SimilarityThreshold   float64 // Threshold for semantic similarity (0-1)
-	OverlapSize           int     // Overlap between chunks in characters
-	UseSemanticBoundaries bool    // Whether to use semantic boundaries
+	MinChunkSize          int     `json:"min_chunk_size"`          // Minimum chunk size in characters
+	MaxChunkSize          int     `json:"max_chunk_size"`          // Maximum chunk size in characters
+	SimilarityThreshold   float64 `json:"similarity_threshold"`    // Adjacent similarity below which the threshold mode cuts (0-1)
+	OverlapSize           int     `json:"overlap_size"`            // Overlap between chunks in characters
+	UseSemanticBoundaries bool    `json:"use_semantic_boundaries"` // Whether to use semantic boundaries
+	BreakpointMode        string  `json:"breakpoint_mode"`         // boundaries, percentile, threshold or structure
+	BreakpointPercentile  float64 `json:"breakpoint_percentile"`   // The percentile mode cuts at the lowest this percent of adjacent similarities
+	WindowSize            int     `json:"window_size"`             // Sentences embedded on each side of a sentence to compare it with the next
 }
 
 // DefaultChunkConfig returns a default configuration for semantic chunking
@@ -35,25 +39,35 @@ func DefaultChunkConfig() *ChunkConfig {
 		SimilarityThreshold:   0.7,
 		OverlapSize:           100,
 		UseSemanticBoundaries: true,
+		BreakpointMode:        ChunkBreakpointsBoundaries,
+		BreakpointPercentile:  10,
+		WindowSize:            1,
 	}
 }
 
 // NewSemanticChunkingService creates a new semantic chunking service
-func NewSemanticChunkingService(db *gorm.DB, geminiAPIKey string) *SemanticChunkingService {
+func NewSemanticChunkingService(db *gorm.DB, embedder Embedder, embedConfig EmbedConfig) *SemanticChunkingService {
 	return &SemanticChunkingService{
-		db:           db,
-		geminiClient: NewGeminiClientV2(geminiAPIKey),
+		db:          db,
+		embedder:    embedder,
+		embedConfig: embedConfig,
 	}
 }
 
 // SemanticChunk represents a semantically meaningful chunk
 type SemanticChunk struct {
-	Content    string    `json:"content"`
-	StartIndex int       `json:"start_index"`
-	EndIndex   int       `json:"end_index"`
-	Topic      string    `json:"topic,omitempty"`
-	Importance float64   `json:"importance,omitempty"`
-	Embedding  []float32 `json:"-"`
+	Content     string    `json:"content"`
+	StartIndex  int       `json:"start_index"` // Offsets in the text being chunked
+	EndIndex    int       `json:"end_index"`
+	Topic       string    `json:"topic,omitempty"`
+	Importance  float64   `json:"importance,omitempty"`
+	StartOffset int       `json:"start_offset"` // Character offsets in the document content
+	EndOffset   int       `json:"end_offset"`
+	SectionPath string    `json:"section_path,omitempty"`
+	PageStart   int       `json:"page_start,omitempty"` // First page of the chunk, 0 when the document has no pages
+	PageEnd     int       `json:"page_end,omitempty"`
+	TokenCount  int       `json:"token_count"`
+	Embedding   []float32 `json:"-"`
 }
 
 // ChunkDocumentWithSemantics performs semantic chunking on a document
@@ -61,56 +75,78 @@ func (s *SemanticChunkingService) ChunkDocumentWithSemantics(doc *models.Documen
 	if config == nil {
 		config = DefaultChunkConfig()
 	}
+	if err := config.Validate(); err != nil {
+		return err
+	}
 
 	fmt.Printf("Starting semantic chunking for document: %s\n", doc.Name)
 
-	// Delete existing chunks first
-	if err := s.DeleteDocumentChunks(doc.ID); err != nil {
-		fmt.Printf("Warning: Failed to delete existing chunks: %v\n", err)
-	}
+	setDocumentStatus(s.db, doc.ID, models.DocumentStatusChunking, nil)
 
 	// Step 1: Preprocess text
 	processedText := s.preprocessText(doc.Content)
 
-	// Step 2: Identify semantic boundaries
-	boundaries := s.identifySemanticBoundaries(processedText)
-
-	// Step 3: Create semantic chunks
-	chunks := s.createSemanticChunks(processedText, boundaries, config)
+	// Steps 2-3: Cut at sections, at topic shifts found with sentence embeddings, or at pattern boundaries
+	var usage embeddingUsage
+	var chunks []SemanticChunk
+	switch {
+	case config.BreakpointMode == ChunkBreakpointsStructure:
+		chunks = s.createStructureChunks(processedText, config)
+	case config.usesEmbeddingBreakpoints():
+		var err error
+		if chunks, err = s.createEmbeddingBreakpointChunks(processedText, config, &usage); err != nil {
+			fmt.Printf("Error finding semantic breakpoints: %v\n", err)
+			return err
+		}
+	default:
+		boundaries := s.identifySemanticBoundaries(processedText)
+		chunks = s.createSemanticChunks(processedText, boundaries, config)
+	}
+	annotateChunks(doc.Content, documentPages(doc.PageBreaks), chunks)
+	if config.BreakpointMode == ChunkBreakpointsStructure {
+		prefixBreadcrumbs(chunks)
+	}
 
-	// Step 4: Generate embeddings and save chunks
+	// Step 4: Generate embeddings in batches
+	texts := make([]string, len(chunks))
 	for i, chunk := range chunks {
-		fmt.Printf("Processing semantic chunk %d/%d\n", i+1, len(chunks))
-
-		// Generate embedding
-		contentForEmbedding := fmt.Sprintf("%s\n\n%s", doc.Name, chunk.Content)
-		embedding, err := s.geminiClient.GenerateEmbedding(contentForEmbedding)
-		if err != nil {
-			fmt.Printf("Error generating embedding for chunk %d: %v\n", i, err)
-			return fmt.Errorf("failed to generate embedding for chunk %d: %w", i, err)
-		}
+		texts[i] = fmt.Sprintf("%s\n\n%s", doc.Name, chunk.Content)
+	}
 
-		// Save chunk to database
-		if err := s.saveSemanticChunk(doc.ID, chunk, i, embedding); err != nil {
-			fmt.Printf("Error saving chunk %d: %v\n", i, err)
-			return fmt.Errorf("failed to save chunk %d: %w", i, err)
-		}
+	reportChunkProgress(s.db, doc.ID, 0, len(chunks))
+	embeddings, sent, err := embedTexts(s.embedder, texts, s.embedConfig, func(done int) {
+		reportChunkProgress(s.db, doc.ID, done, len(chunks))
+	})
+	if err != nil {
+		fmt.Printf("Error generating embeddings: %v\n", err)
+		return err
+	}
+	usage.add(texts, sent, false)
+
+	// Step 5: Replace the document's chunks
+	if err := s.replaceChunks(doc.ID, chunks, embeddings); err != nil {
+		fmt.Printf("Error saving chunks: %v\n", err)
+		return err
 	}
 
-	fmt.Printf("Completed semantic chunking for document: %s (%d chunks)\n", doc.Name, len(chunks))
+	reportEmbeddingUsage(s.db, doc.ID, usage)
+	fmt.Printf("Completed semantic chunking for document: %s (%d chunks, embedded %d sentence windows and %d chunks, ~%d tokens, %d cache hits)\n",
+		doc.Name, len(chunks), usage.BreakpointTexts, usage.ChunkTexts, usage.Tokens, usage.CacheHits)
 	return nil
 }
 
 // preprocessText cleans and normalizes text for better chunking
 func (s *SemanticChunkingService) preprocessText(text string) string {
-	// Normalize whitespace
-	text = regexp.MustCompile(`\s+`).ReplaceAllString(text, " ")
+	// Normalize whitespace, keeping the line and paragraph breaks that carry the structure
+	text = regexp.MustCompile(`[^\S\n]+`).ReplaceAllString(text, " ")
+	text = regexp.MustCompile(` ?\n ?`).ReplaceAllString(text, "\n")
+	text = regexp.MustCompile(`\n{3,}`).ReplaceAllString(text, "\n\n")
 
 	// Remove excessive punctuation
 	text = regexp.MustCompile(`[.]{3,}`).ReplaceAllString(text, "...")
 
 	// Ensure proper sentence endings
-	text = regexp.MustCompile(`([.!?])\s*([A-Z])`).ReplaceAllString(text, "$1 $2")
+	text = regexp.MustCompile(`([.!?])([A-Z])`).ReplaceAllString(text, "$1 $2")
 
 	return strings.TrimSpace(text)
 }
@@ -351,8 +387,25 @@ func (s *SemanticChunkingService) applyOverlap(chunks []SemanticChunk, overlapSi
 	return overlappedChunks
 }
 
+// replaceChunks swaps the document's chunks for the new ones in a single transaction,
+// so a failure leaves the previous chunks searchable
+func (s *SemanticChunkingService) replaceChunks(documentID uuid.UUID, chunks []SemanticChunk, embeddings [][]float32) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("document_id = ?", documentID).Delete(&models.DocumentChunk{}).Error; err != nil {
+			return fmt.Errorf("failed to delete existing chunks: %w", err)
+		}
+
+		for i, chunk := range chunks {
+			if err := s.saveSemanticChunk(tx, documentID, chunk, i, embeddings[i]); err != nil {
+				return fmt.Errorf("failed to save chunk %d: %w", i, err)
+			}
+		}
+		return nil
+	})
+}
+
 // saveSemanticChunk saves a semantic chunk to the database
-func (s *SemanticChunkingService) saveSemanticChunk(documentID uuid.UUID, chunk SemanticChunk, index int, embedding []float32) error {
+func (s *SemanticChunkingService) saveSemanticChunk(tx *gorm.DB, documentID uuid.UUID, chunk SemanticChunk, index int, embedding []float32) error {
 	chunkID := uuid.New()
 
 	// Convert embedding to string
@@ -362,12 +415,15 @@ func (s *SemanticChunkingService) saveSemanticChunk(documentID uuid.UUID, chunk
 	cleanContent := strings.ToValidUTF8(chunk.Content, "")
 
 	// Insert chunk
+	// The chunk always belongs to its document's tenant
 	sql := `
-		INSERT INTO document_chunks (id, document_id, content, chunk_index, embedding, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?::vector, NOW(), NOW())
+		INSERT INTO document_chunks (id, tenant_id, document_id, content, chunk_index, start_offset, end_offset,
+			section_path, page_start, page_end, token_count, embedding, created_at, updated_at)
+		VALUES (?, (SELECT tenant_id FROM documents WHERE id = ?), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?::vector, NOW(), NOW())
 	`
 
-	return s.db.Exec(sql, chunkID, documentID, cleanContent, index, embeddingStr).Error
+	return tx.Exec(sql, chunkID, documentID, documentID, cleanContent, index, chunk.StartOffset, chunk.EndOffset,
+		chunk.SectionPath, chunk.PageStart, chunk.PageEnd, chunk.TokenCount, embeddingStr).Error
 }
 
 // embeddingToString converts embedding to string format
@@ -384,23 +440,6 @@ func (s *SemanticChunkingService) DeleteDocumentChunks(documentID uuid.UUID) err
 	return s.db.Where("document_id = ?", documentID).Delete(&models.DocumentChunk{}).Error
 }
 
-// calculateSemanticSimilarity calculates semantic similarity between two text segments
-func (s *SemanticChunkingService) calculateSemanticSimilarity(text1, text2 string) (float64, error) {
-	// Generate embeddings for both texts
-	embedding1, err := s.geminiClient.GenerateEmbedding(text1)
-	if err != nil {
-		return 0, err
-	}
-
-	embedding2, err := s.geminiClient.GenerateEmbedding(text2)
-	if err != nil {
-		return 0, err
-	}
-
-	// Calculate cosine similarity
-	return s.cosineSimilarity(embedding1, embedding2), nil
-}
-
 // cosineSimilarity calculates cosine similarity between two vectors
 func (s *SemanticChunkingService) cosineSimilarity(a, b []float32) float64 {
 	if len(a) != len(b) {
@@ -452,38 +491,3 @@ func (s *SemanticChunkingService) findBestSplitPoint(text string, start, end, ta
 	// Fallback to target size
 	return start + targetSize
 }
-
-// mergeSimilarChunks merges consecutive chunks that are semantically similar
-func (s *SemanticChunkingService) mergeSimilarChunks(chunks []SemanticChunk, threshold float64) ([]SemanticChunk, error) {
-	if len(chunks) <= 1 {
-		return chunks, nil
-	}
-
-	var mergedChunks []SemanticChunk
-	current := chunks[0]
-
-	for i := 1; i < len(chunks); i++ {
-		next := chunks[i]
-
-		// Tính similarity giữa current và next
-		similarity, err := s.calculateSemanticSimilarity(current.Content, next.Content)
-		if err != nil {
-			return nil, fmt.Errorf("failed to calculate similarity: %w", err)
-		}
-
-		if similarity >= threshold {
-			// Merge nội dung vào current
-			current.Content = current.Content + " " + next.Content
-			current.EndIndex = next.EndIndex
-		} else {
-			// Push current vào kết quả và move sang next
-			mergedChunks = append(mergedChunks, current)
-			current = next
-		}
-	}
-
-	// Add chunk cuối
-	mergedChunks = append(mergedChunks, current)
-
-	return mergedChunks, nil
-}
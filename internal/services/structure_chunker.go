@@ -0,0 +1,63 @@
+package services
+
+import (
+	"strings"
+)
+
+// ChunkBreakpointsStructure splits at headings, one chunk per section, and prefixes chunks with
+// their heading breadcrumb. Headings are Markdown ones, or the chapter, article and numbered
+// headings of plain text, see findHeadings.
+const ChunkBreakpointsStructure = "structure"
+
+// breadcrumbSeparator separates the heading breadcrumb from the section text of a chunk
+const breadcrumbSeparator = "\n\n"
+
+// createStructureChunks cuts text into the bodies of its sections, the text between
+// a heading and the next one. Sections that fit MaxChunkSize become a single chunk. Larger
+// ones are split into groups of sentences, preferably at paragraph ends. Headings are left
+// out of the chunks, prefixBreadcrumbs puts them back as the chunk's breadcrumb.
+func (s *SemanticChunkingService) createStructureChunks(text string, config *ChunkConfig) []SemanticChunk {
+	var bodies []textSpan
+	start := 0
+	for _, heading := range findHeadings(text) {
+		bodies = append(bodies, textSpan{start, heading.start})
+		start = heading.end
+	}
+	bodies = append(bodies, textSpan{start, len(text)})
+
+	var chunks []SemanticChunk
+	for _, body := range bodies {
+		content := strings.TrimSpace(text[body.start:body.end])
+		if content == "" {
+			continue // A heading directly followed by a subheading, it shows in their breadcrumbs
+		}
+		if body.end-body.start <= config.MaxChunkSize {
+			chunks = append(chunks, SemanticChunk{Content: content, StartIndex: body.start, EndIndex: body.end})
+			continue
+		}
+
+		sentences := s.splitSentences(text[body.start:body.end], config.MaxChunkSize)
+		paragraphEnds := make([]bool, len(sentences))
+		for i := range sentences {
+			sentences[i].start += body.start
+			sentences[i].end += body.start
+			paragraphEnds[i] = strings.Contains(text[sentences[i].start:sentences[i].end], "\n\n")
+		}
+		chunks = append(chunks, groupSentences(text, sentences, paragraphEnds, config.MinChunkSize, config.MaxChunkSize)...)
+	}
+	return chunks
+}
+
+// prefixBreadcrumbs starts every chunk with its section path, e.g. "Chương 3 > Nghỉ phép năm",
+// so a chunk read on its own still says what it is about. It runs after annotateChunks, which
+// finds the section paths and locates chunks by their text without the breadcrumb.
+func prefixBreadcrumbs(chunks []SemanticChunk) {
+	for i := range chunks {
+		chunk := &chunks[i]
+		if chunk.SectionPath == "" {
+			continue
+		}
+		chunk.Content = chunk.SectionPath + breadcrumbSeparator + chunk.Content
+		chunk.TokenCount = estimateTokens(chunk.Content)
+	}
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseHeading(t *testing.T) {
+	tests := []struct {
+		line      string
+		wantLevel int
+		wantTitle string
+		wantOK    bool
+	}{
+		{"# Sổ tay nhân viên", 1, "Sổ tay nhân viên", true},
+		{"### Nghỉ phép năm ##", 3, "Nghỉ phép năm", true},
+		{"#hashtag", 0, "", false},
+		{"Phần I", 1, "Phần I", true},
+		{"CHƯƠNG III - TIỀN LƯƠNG", 2, "CHƯƠNG III - TIỀN LƯƠNG", true},
+		{"Chương 3: Nghỉ phép", 2, "Chương 3: Nghỉ phép", true},
+		{"Mục 2. Nghỉ ốm", 3, "Mục 2. Nghỉ ốm", true},
+		{"  Điều 5. Nghỉ phép năm  ", 4, "Điều 5. Nghỉ phép năm", true},
+		{"ĐIỀU 12", 4, "ĐIỀU 12", true},
+		{"1.2 Nghỉ ốm", 5, "1.2 Nghỉ ốm", true},
+		{"1.2. Nghỉ ốm", 5, "1.2. Nghỉ ốm", true},
+		{"3.1.4 Thủ tục đăng ký", 6, "3.1.4 Thủ tục đăng ký", true},
+		{"Điều 5 quy định số ngày nghỉ phép năm.", 0, "", false},
+		{"Mục lục", 0, "", false},
+		{"1. Nộp đơn cho quản lý", 0, "", false},
+		{"1.500.000 đồng mỗi tháng", 0, "", false},
+		{"1.5 triệu đồng", 0, "", false},
+		{"Chương 3: " + strings.Repeat("rất dài ", 20), 0, "", false},
+		{"", 0, "", false},
+	}
+
+	for _, tt := range tests {
+		level, title, ok := parseHeading(tt.line)
+		if level != tt.wantLevel || title != tt.wantTitle || ok != tt.wantOK {
+			t.Errorf("parseHeading(%q) = %d, %q, %v, want %d, %q, %v", tt.line, level, title, ok, tt.wantLevel, tt.wantTitle, tt.wantOK)
+		}
+	}
+}
+
+func TestFindHeadings(t *testing.T) {
+	text := "CHƯƠNG III - TIỀN LƯƠNG\nĐiều 5. Kỳ trả lương\nLương trả ngày 5.\n1.2 Phụ cấp\nĂn trưa."
+
+	var got []string
+	for _, heading := range findHeadings(text) {
+		if line := text[heading.start:heading.end]; line != heading.title {
+			t.Errorf("heading range %q does not match its title %q", line, heading.title)
+		}
+		got = append(got, heading.title)
+	}
+	want := []string{"CHƯƠNG III - TIỀN LƯƠNG", "Điều 5. Kỳ trả lương", "1.2 Phụ cấp"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findHeadings() = %q, want %q", got, want)
+	}
+}
+
+func TestStructureChunks(t *testing.T) {
+	service := &SemanticChunkingService{}
+	long := strings.Repeat("Người lao động nộp đơn trước ba ngày. ", 4) + "\n\n" + strings.Repeat("Quản lý duyệt trong hai ngày. ", 4)
+
+	tests := []struct {
+		name         string
+		text         string
+		maxChunkSize int
+		wantContent  []string
+		wantSections []string
+	}{
+		{
+			name:         "markdown headings",
+			text:         "# Nghỉ phép\n\n## Nghỉ phép năm\n\n12 ngày mỗi năm.\n\n## Nghỉ ốm\n\nCần giấy xác nhận.",
+			maxChunkSize: 200,
+			wantContent:  []string{"Nghỉ phép > Nghỉ phép năm\n\n12 ngày mỗi năm.", "Nghỉ phép > Nghỉ ốm\n\nCần giấy xác nhận."},
+			wantSections: []string{"Nghỉ phép > Nghỉ phép năm", "Nghỉ phép > Nghỉ ốm"},
+		},
+		{
+			name:         "plain-text chapters and articles",
+			text:         "Giới thiệu chung.\nCHƯƠNG III - NGHỈ PHÉP\nĐiều 5. Nghỉ phép năm\n12 ngày mỗi năm.\nĐiều 6. Nghỉ ốm\nCần giấy xác nhận.\nCHƯƠNG IV - TIỀN LƯƠNG\nTrả vào ngày 5.",
+			maxChunkSize: 200,
+			wantContent: []string{
+				"Giới thiệu chung.",
+				"CHƯƠNG III - NGHỈ PHÉP > Điều 5. Nghỉ phép năm\n\n12 ngày mỗi năm.",
+				"CHƯƠNG III - NGHỈ PHÉP > Điều 6. Nghỉ ốm\n\nCần giấy xác nhận.",
+				"CHƯƠNG IV - TIỀN LƯƠNG\n\nTrả vào ngày 5.",
+			},
+			wantSections: []string{"", "CHƯƠNG III - NGHỈ PHÉP > Điều 5. Nghỉ phép năm", "CHƯƠNG III - NGHỈ PHÉP > Điều 6. Nghỉ ốm", "CHƯƠNG IV - TIỀN LƯƠNG"},
+		},
+		{
+			name:         "numbered headings",
+			text:         "1.1 Nghỉ phép năm\n12 ngày.\n1.1.1 Cộng dồn\nSang quý I.\n1.2 Nghỉ ốm\nCó giấy.",
+			maxChunkSize: 200,
+			wantContent: []string{
+				"1.1 Nghỉ phép năm\n\n12 ngày.",
+				"1.1 Nghỉ phép năm > 1.1.1 Cộng dồn\n\nSang quý I.",
+				"1.2 Nghỉ ốm\n\nCó giấy.",
+			},
+			wantSections: []string{"1.1 Nghỉ phép năm", "1.1 Nghỉ phép năm > 1.1.1 Cộng dồn", "1.2 Nghỉ ốm"},
+		},
+		{
+			name:         "long section split at its paragraph",
+			text:         "Điều 7. Thủ tục\n" + long,
+			maxChunkSize: 250,
+			wantContent: []string{
+				"Điều 7. Thủ tục\n\n" + strings.TrimSpace(strings.Repeat("Người lao động nộp đơn trước ba ngày. ", 4)),
+				"Điều 7. Thủ tục\n\n" + strings.TrimSpace(strings.Repeat("Quản lý duyệt trong hai ngày. ", 4)),
+			},
+			wantSections: []string{"Điều 7. Thủ tục", "Điều 7. Thủ tục"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &ChunkConfig{BreakpointMode: ChunkBreakpointsStructure, MinChunkSize: 50, MaxChunkSize: tt.maxChunkSize}
+			chunks := service.createStructureChunks(tt.text, config)
+			annotateChunks(tt.text, nil, chunks)
+			prefixBreadcrumbs(chunks)
+
+			var content, sections []string
+			for _, chunk := range chunks {
+				content = append(content, chunk.Content)
+				sections = append(sections, chunk.SectionPath)
+			}
+			if !reflect.DeepEqual(content, tt.wantContent) {
+				t.Errorf("chunks = %q, want %q", content, tt.wantContent)
+			}
+			if !reflect.DeepEqual(sections, tt.wantSections) {
+				t.Errorf("section paths = %q, want %q", sections, tt.wantSections)
+			}
+		})
+	}
+}
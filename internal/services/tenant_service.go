@@ -0,0 +1,186 @@
+package services
+
+import (
+	"company-ai-training/internal/config"
+	"company-ai-training/internal/models"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// tenantCacheTTL bounds how long another instance's tenant changes take to apply
+const tenantCacheTTL = time.Minute
+
+// TenantContext is a tenant with the models configured for it
+type TenantContext struct {
+	Tenant    *models.Tenant
+	ChatModel ChatModel
+	Embedder  Embedder
+}
+
+type cachedTenant struct {
+	context  *TenantContext
+	loadedAt time.Time
+}
+
+// TenantService manages tenants and resolves their per-tenant chat model and embedder
+type TenantService struct {
+	db               *gorm.DB
+	cfg              *config.Config
+	defaultChatModel ChatModel
+	defaultEmbedder  Embedder
+	mu               sync.Mutex
+	cache            map[uuid.UUID]cachedTenant
+}
+
+func NewTenantService(db *gorm.DB, cfg *config.Config, chatModel ChatModel, embedder Embedder) *TenantService {
+	return &TenantService{
+		db:               db,
+		cfg:              cfg,
+		defaultChatModel: chatModel,
+		defaultEmbedder:  embedder,
+		cache:            make(map[uuid.UUID]cachedTenant),
+	}
+}
+
+// scopeToTenant returns a handle whose queries only match rows of the tenant. The
+// condition is not applied to creates or raw SQL: new records must set TenantID and
+// raw queries must filter on tenant_id themselves.
+func scopeToTenant(db *gorm.DB, tenantID uuid.UUID) *gorm.DB {
+	return db.Where(clause.Eq{
+		Column: clause.Column{Table: clause.CurrentTable, Name: "tenant_id"},
+		Value:  tenantID,
+	}).Session(&gorm.Session{})
+}
+
+// Resolve returns the tenant with its chat model and embedder
+func (s *TenantService) Resolve(tenantID uuid.UUID) (*TenantContext, error) {
+	s.mu.Lock()
+	cached, ok := s.cache[tenantID]
+	s.mu.Unlock()
+	if ok && time.Since(cached.loadedAt) < tenantCacheTTL {
+		return cached.context, nil
+	}
+
+	tenant, err := s.GetTenant(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	tenantContext := &TenantContext{
+		Tenant:    tenant,
+		ChatModel: s.defaultChatModel,
+		Embedder:  s.defaultEmbedder,
+	}
+
+	// A tenant with its own Gemini key gets its own clients, with the same models so
+	// its vectors stay comparable with the shared embedding column
+	if tenant.GeminiAPIKey != "" {
+		tenantConfig := *s.cfg
+		tenantConfig.GeminiAPIKey = tenant.GeminiAPIKey
+
+		if tenantConfig.ChatProvider == "gemini" {
+			if tenantContext.ChatModel, err = NewChatModel(&tenantConfig); err != nil {
+				return nil, fmt.Errorf("failed to create chat model for tenant %s: %w", tenant.Slug, err)
+			}
+		}
+		if tenantConfig.EmbeddingProvider == "gemini" {
+			if tenantContext.Embedder, err = NewEmbedder(&tenantConfig); err != nil {
+				return nil, fmt.Errorf("failed to create embedder for tenant %s: %w", tenant.Slug, err)
+			}
+			if tenantConfig.EmbeddingCache {
+				tenantContext.Embedder = NewCachedEmbedder(tenantContext.Embedder, NewEmbeddingCache(s.db))
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.cache[tenantID] = cachedTenant{context: tenantContext, loadedAt: time.Now()}
+	s.mu.Unlock()
+
+	return tenantContext, nil
+}
+
+// GetTenant retrieves a tenant by ID
+func (s *TenantService) GetTenant(id uuid.UUID) (*models.Tenant, error) {
+	var tenant models.Tenant
+	if err := s.db.First(&tenant, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	tenant.HasGeminiKey = tenant.GeminiAPIKey != ""
+	return &tenant, nil
+}
+
+// GetTenantBySlug retrieves a tenant by slug
+func (s *TenantService) GetTenantBySlug(slug string) (*models.Tenant, error) {
+	var tenant models.Tenant
+	if err := s.db.First(&tenant, "slug = ?", slug).Error; err != nil {
+		return nil, err
+	}
+	tenant.HasGeminiKey = tenant.GeminiAPIKey != ""
+	return &tenant, nil
+}
+
+// GetDefaultTenant retrieves the tenant that owns pre-existing data
+func (s *TenantService) GetDefaultTenant() (*models.Tenant, error) {
+	return s.GetTenantBySlug(models.DefaultTenantSlug)
+}
+
+// GetAllTenants retrieves all tenants
+func (s *TenantService) GetAllTenants() ([]models.Tenant, error) {
+	var tenants []models.Tenant
+	if err := s.db.Order("created_at ASC").Find(&tenants).Error; err != nil {
+		return nil, err
+	}
+	for i := range tenants {
+		tenants[i].HasGeminiKey = tenants[i].GeminiAPIKey != ""
+	}
+	return tenants, nil
+}
+
+// CreateTenant creates a new tenant
+func (s *TenantService) CreateTenant(slug, name, geminiAPIKey, systemPrompt string) (*models.Tenant, error) {
+	if slug == "" {
+		return nil, errors.New("slug is required")
+	}
+
+	tenant := &models.Tenant{
+		ID:           uuid.New(),
+		Slug:         slug,
+		Name:         name,
+		GeminiAPIKey: geminiAPIKey,
+		SystemPrompt: systemPrompt,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	if err := s.db.Create(tenant).Error; err != nil {
+		return nil, fmt.Errorf("failed to create tenant: %w", err)
+	}
+
+	tenant.HasGeminiKey = tenant.GeminiAPIKey != ""
+	return tenant, nil
+}
+
+// UpdateTenant updates a tenant and drops its cached models
+func (s *TenantService) UpdateTenant(id uuid.UUID, updates map[string]interface{}) (*models.Tenant, error) {
+	updates["updated_at"] = time.Now()
+	result := s.db.Model(&models.Tenant{}).Where("id = ?", id).Updates(updates)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to update tenant: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	s.mu.Lock()
+	delete(s.cache, id)
+	s.mu.Unlock()
+
+	return s.GetTenant(id)
+}
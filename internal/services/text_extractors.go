@@ -0,0 +1,158 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// utf8BOM is stripped from text files saved by Windows editors and Excel
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// decodeText returns the file as text without a byte order mark or Windows line endings
+func decodeText(data []byte) string {
+	text := string(bytes.TrimPrefix(data, utf8BOM))
+	return strings.ReplaceAll(text, "\r\n", "\n")
+}
+
+// TextExtractor reads plain text files as they are
+type TextExtractor struct{}
+
+func (e *TextExtractor) Extensions() []string { return []string{".txt"} }
+func (e *TextExtractor) MIMETypes() []string  { return []string{"text/plain"} }
+
+func (e *TextExtractor) Extract(data []byte) (string, error) {
+	return decodeText(data), nil
+}
+
+// MarkdownExtractor keeps Markdown as is, its headings and lists are meaningful to chunking
+type MarkdownExtractor struct{}
+
+func (e *MarkdownExtractor) Extensions() []string { return []string{".md", ".markdown"} }
+func (e *MarkdownExtractor) MIMETypes() []string  { return []string{"text/markdown", "text/x-markdown"} }
+
+func (e *MarkdownExtractor) Extract(data []byte) (string, error) {
+	return decodeText(data), nil
+}
+
+// CSVExtractor renders comma, semicolon or tab separated tables as "header: value" lines
+type CSVExtractor struct{}
+
+func (e *CSVExtractor) Extensions() []string { return []string{".csv"} }
+func (e *CSVExtractor) MIMETypes() []string  { return []string{"text/csv"} }
+
+func (e *CSVExtractor) Extract(data []byte) (string, error) {
+	text := decodeText(data)
+
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.Comma = detectCSVDelimiter(text)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return "", fmt.Errorf("failed to parse CSV: %w", err)
+	}
+
+	return tableToText(rows), nil
+}
+
+// detectCSVDelimiter picks the separator that occurs most often in the first line.
+// Excel with a Vietnamese locale exports CSV with semicolons.
+func detectCSVDelimiter(text string) rune {
+	firstLine, _, _ := strings.Cut(text, "\n")
+
+	delimiter, best := ',', 0
+	for _, candidate := range []rune{',', ';', '\t'} {
+		if count := strings.Count(firstLine, string(candidate)); count > best {
+			delimiter, best = candidate, count
+		}
+	}
+	return delimiter
+}
+
+// HTMLExtractor converts HTML pages, such as wiki exports, to Markdown-like text:
+// headings become "#" lines, list items "-" lines and table cells are separated by "|"
+type HTMLExtractor struct{}
+
+func (e *HTMLExtractor) Extensions() []string { return []string{".html", ".htm"} }
+func (e *HTMLExtractor) MIMETypes() []string  { return []string{"text/html", "application/xhtml+xml"} }
+
+func (e *HTMLExtractor) Extract(data []byte) (string, error) {
+	root, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	var builder strings.Builder
+	writeHTMLNode(&builder, root)
+
+	// Collapse the blank lines left by nested blocks
+	var lines []string
+	blank := true
+	for _, line := range strings.Split(builder.String(), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if !blank {
+				lines = append(lines, "")
+			}
+			blank = true
+			continue
+		}
+		lines = append(lines, line)
+		blank = false
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n")) + "\n", nil
+}
+
+// writeHTMLNode appends the visible text of n and its children
+func writeHTMLNode(builder *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		if text := strings.Join(strings.Fields(n.Data), " "); text != "" {
+			if s := builder.String(); len(s) > 0 && !strings.HasSuffix(s, "\n") && !strings.HasSuffix(s, " ") {
+				builder.WriteString(" ")
+			}
+			builder.WriteString(text)
+		}
+		return
+	case html.ElementNode:
+		switch n.DataAtom {
+		case atom.Script, atom.Style, atom.Noscript, atom.Template, atom.Svg, atom.Head:
+			return
+		case atom.Br:
+			builder.WriteString("\n")
+			return
+		case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+			level := int(n.Data[1] - '0')
+			builder.WriteString("\n\n" + strings.Repeat("#", level) + " ")
+		case atom.Li:
+			builder.WriteString("\n- ")
+		case atom.Td, atom.Th:
+			if n.PrevSibling != nil {
+				builder.WriteString(" | ")
+			}
+		case atom.P, atom.Div, atom.Section, atom.Article, atom.Table, atom.Ul, atom.Ol,
+			atom.Blockquote, atom.Pre, atom.Header, atom.Footer, atom.Main, atom.Dl, atom.Dt, atom.Dd:
+			builder.WriteString("\n")
+		}
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		writeHTMLNode(builder, child)
+	}
+
+	if n.Type == html.ElementNode {
+		switch n.DataAtom {
+		case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.P, atom.Table, atom.Ul, atom.Ol, atom.Blockquote, atom.Pre:
+			builder.WriteString("\n\n")
+		case atom.Div, atom.Section, atom.Article, atom.Tr, atom.Header, atom.Footer, atom.Main, atom.Dl, atom.Dt, atom.Dd:
+			builder.WriteString("\n")
+		}
+	}
+}
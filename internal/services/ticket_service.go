@@ -10,7 +10,8 @@ import (
 )
 
 type TicketService struct {
-	db *gorm.DB
+	db       *gorm.DB
+	tenantID uuid.UUID
 }
 
 func NewTicketService(db *gorm.DB) *TicketService {
@@ -19,10 +20,19 @@ func NewTicketService(db *gorm.DB) *TicketService {
 	}
 }
 
+// ForTenant returns a copy of the service that only sees and creates the tenant's tickets
+func (s *TicketService) ForTenant(tenantID uuid.UUID) *TicketService {
+	return &TicketService{
+		db:       scopeToTenant(s.db, tenantID),
+		tenantID: tenantID,
+	}
+}
+
 // CreateTicket creates a new HR support ticket
 func (s *TicketService) CreateTicket(sessionID uuid.UUID, userID *uuid.UUID, question, category, description string) (*models.HRTicket, error) {
 	ticket := &models.HRTicket{
 		ID:          uuid.New(),
+		TenantID:    s.tenantID,
 		UserID:      userID,
 		SessionID:   sessionID,
 		Question:    question,
@@ -78,8 +88,18 @@ func (s *TicketService) UpdateTicketStatus(ticketID uuid.UUID, status string) er
 
 // GetAllTickets retrieves all tickets with pagination
 func (s *TicketService) GetAllTickets(limit, offset int, status string) ([]models.HRTicket, error) {
+	return s.listTickets(s.db, limit, offset, status)
+}
+
+// GetUserTicketsPage retrieves a user's tickets with pagination
+func (s *TicketService) GetUserTicketsPage(userID uuid.UUID, limit, offset int, status string) ([]models.HRTicket, error) {
+	return s.listTickets(s.db.Where("user_id = ?", userID), limit, offset, status)
+}
+
+// listTickets pages through the tickets matched by query, newest first
+func (s *TicketService) listTickets(query *gorm.DB, limit, offset int, status string) ([]models.HRTicket, error) {
 	var tickets []models.HRTicket
-	query := s.db.Order("created_at DESC")
+	query = query.Order("created_at DESC")
 	
 	if status != "" {
 		query = query.Where("status = ?", status)
@@ -10,7 +10,8 @@ import (
 )
 
 type UserService struct {
-	db *gorm.DB
+	db       *gorm.DB
+	tenantID uuid.UUID
 }
 
 func NewUserService(db *gorm.DB) *UserService {
@@ -19,12 +20,26 @@ func NewUserService(db *gorm.DB) *UserService {
 	}
 }
 
+// ForTenant returns a copy of the service that only sees and creates the tenant's users
+func (s *UserService) ForTenant(tenantID uuid.UUID) *UserService {
+	return &UserService{
+		db:       scopeToTenant(s.db, tenantID),
+		tenantID: tenantID,
+	}
+}
+
 // CreateUser creates a new user
-func (s *UserService) CreateUser(email, name, department, position, employeeID string, startDate time.Time) (*models.User, error) {
+func (s *UserService) CreateUser(email, name, role, department, position, employeeID string, startDate time.Time) (*models.User, error) {
+	if role == "" {
+		role = models.RoleEmployee
+	}
+
 	user := &models.User{
 		ID:         uuid.New(),
+		TenantID:   s.tenantID,
 		Email:      email,
 		Name:       name,
+		Role:       role,
 		Department: department,
 		Position:   position,
 		EmployeeID: employeeID,
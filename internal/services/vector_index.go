@@ -0,0 +1,428 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Vector index types
+const (
+	VectorIndexHNSW    = "hnsw"
+	VectorIndexIVFFlat = "ivfflat"
+	VectorIndexNone    = "none"
+)
+
+const (
+	vectorIndexName = "idx_document_chunks_embedding"
+	// ivfflatRebuildMinRows is the chunk count below which a stale IVFFlat index is not worth rebuilding
+	ivfflatRebuildMinRows = 1000
+)
+
+// VectorIndexConfig describes the approximate nearest neighbour index on chunk embeddings
+// and how thoroughly queries search it
+type VectorIndexConfig struct {
+	Type           string // hnsw, ivfflat or none
+	OpClass        string // vector_cosine_ops, vector_l2_ops or vector_ip_ops
+	M              int    // HNSW connections per node
+	EfConstruction int    // HNSW build candidate list size
+	EfSearch       int    // HNSW query candidate list size
+	Lists          int    // IVFFlat clusters, 0 sizes them from the chunk count
+	Probes         int    // IVFFlat clusters visited per query
+	IterativeScan  bool   // pgvector 0.8+ keeps scanning the index until filtered queries have enough rows
+}
+
+// distanceOperator returns the pgvector operator the index can order by
+func (c VectorIndexConfig) distanceOperator() string {
+	switch c.OpClass {
+	case "vector_l2_ops":
+		return "<->"
+	case "vector_ip_ops":
+		return "<#>"
+	default:
+		return "<=>"
+	}
+}
+
+// applySearchParams prepares the current transaction for a nearest neighbour query returning
+// candidates rows out of the chunks matching filterSQL, a condition on document_chunks dc joined
+// with documents d. The index is shared by every tenant and filters only apply to the rows it
+// returns, so selective filters would leave few or no rows. With iterative scans the index keeps
+// searching until enough rows pass, otherwise a query whose filter is expected to keep fewer than
+// candidates of the rows the index returns is run as an exact scan.
+func (c VectorIndexConfig) applySearchParams(tx *gorm.DB, candidates int, filterSQL string, filterArgs []interface{}) error {
+	if c.Type == VectorIndexNone {
+		return nil
+	}
+
+	if !c.IterativeScan {
+		// Only count the filtered chunks up to the point where the index would return enough of them
+		var total int64
+		if err := tx.Raw(`
+			SELECT CASE WHEN reltuples > 0 THEN reltuples::bigint ELSE (SELECT COUNT(*) FROM document_chunks) END
+			FROM pg_class WHERE oid = 'document_chunks'::regclass
+		`).Scan(&total).Error; err != nil {
+			return err
+		}
+		if total > 0 {
+			enough := int64(math.Ceil(float64(candidates) * float64(total) / c.scannedRows(total, candidates)))
+			var filtered int64
+			if err := tx.Raw(`SELECT COUNT(*) FROM (
+				SELECT 1 FROM document_chunks dc JOIN documents d ON dc.document_id = d.id
+				WHERE d.deleted_at IS NULL AND dc.embedding IS NOT NULL`+filterSQL+`
+				LIMIT ?
+			) AS matching`, append(append([]interface{}{}, filterArgs...), enough)...).Scan(&filtered).Error; err != nil {
+				return err
+			}
+			if filtered < enough {
+				// Bitmap scans stay on, so the filter can still use the tenant and document indexes
+				return tx.Exec("SET LOCAL enable_indexscan = off").Error
+			}
+		}
+	}
+
+	switch c.Type {
+	case VectorIndexHNSW:
+		if err := tx.Exec(fmt.Sprintf("SET LOCAL hnsw.ef_search = %d", max(c.EfSearch, candidates))).Error; err != nil {
+			return err
+		}
+		if c.IterativeScan {
+			return tx.Exec("SET LOCAL hnsw.iterative_scan = strict_order").Error
+		}
+	case VectorIndexIVFFlat:
+		if err := tx.Exec(fmt.Sprintf("SET LOCAL ivfflat.probes = %d", max(c.Probes, 1))).Error; err != nil {
+			return err
+		}
+		if c.IterativeScan {
+			return tx.Exec("SET LOCAL ivfflat.iterative_scan = relaxed_order").Error
+		}
+	}
+	return nil
+}
+
+// scannedRows estimates how many rows an index scan returns before filters apply. HNSW returns
+// its candidate list, which searches raise to the candidates they need, and IVFFlat the rows of
+// the clusters it probes.
+func (c VectorIndexConfig) scannedRows(chunks int64, candidates int) float64 {
+	if c.Type == VectorIndexIVFFlat {
+		lists := c.lists(chunks)
+		return float64(chunks) * float64(min(max(c.Probes, 1), lists)) / float64(lists)
+	}
+	return float64(max(c.EfSearch, candidates))
+}
+
+// lists returns the configured IVFFlat cluster count, or the recommended one for the chunk
+// count: chunks / 1000 up to a million chunks and the square root beyond
+func (c VectorIndexConfig) lists(chunks int64) int {
+	if c.Lists > 0 {
+		return c.Lists
+	}
+	if chunks > 1000000 {
+		return int(math.Sqrt(float64(chunks)))
+	}
+	return max(int(chunks/1000), 10)
+}
+
+// VectorIndexService creates and maintains the index on document_chunks.embedding and
+// measures its recall
+type VectorIndexService struct {
+	db  *gorm.DB
+	cfg VectorIndexConfig
+}
+
+// VectorIndexStatus reports the state of the vector index
+type VectorIndexStatus struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Definition string `json:"definition,omitempty"`
+	Exists     bool   `json:"exists"`
+	Valid      bool   `json:"valid"`
+	SizeBytes  int64  `json:"size_bytes"`
+	Size       string `json:"size"`
+	Chunks     int64  `json:"chunks"`
+	BuiltRows  int64  `json:"built_rows"` // Chunks when the index was built
+	// Whether filtered searches keep scanning the index, otherwise selective ones use exact scans
+	IterativeScan bool `json:"iterative_scan"`
+}
+
+// VectorIndexRecall compares approximate searches with exact scans
+type VectorIndexRecall struct {
+	Queries      int     `json:"queries"`
+	K            int     `json:"k"`
+	Recall       float64 `json:"recall"` // Share of the exact top k found by the index, averaged over queries
+	IndexLatency float64 `json:"index_latency_ms"`
+	ExactLatency float64 `json:"exact_latency_ms"`
+}
+
+func NewVectorIndexService(db *gorm.DB, cfg VectorIndexConfig) *VectorIndexService {
+	return &VectorIndexService{db: db, cfg: cfg}
+}
+
+// Config returns the index configuration, with IterativeScan set once EnsureIndex found
+// a pgvector version that supports it
+func (s *VectorIndexService) Config() VectorIndexConfig {
+	return s.cfg
+}
+
+// EnsureIndex creates the configured index, replacing an index built with other settings.
+// A stale IVFFlat index, built when there were less than half the current chunks, is rebuilt
+// so its clusters reflect the data.
+func (s *VectorIndexService) EnsureIndex() error {
+	var version string
+	if err := s.db.Raw("SELECT extversion FROM pg_extension WHERE extname = 'vector'").Scan(&version).Error; err != nil {
+		return err
+	}
+	s.cfg.IterativeScan = supportsIterativeScan(version)
+	if !s.cfg.IterativeScan && s.cfg.Type != VectorIndexNone {
+		log.Printf("pgvector %s has no iterative index scans, selective searches fall back to exact scans", version)
+	}
+
+	spec, builtRows, exists, err := s.currentSpec()
+	if err != nil {
+		return err
+	}
+
+	if s.cfg.Type == VectorIndexNone {
+		if exists {
+			log.Printf("Dropping vector index %s, VECTOR_INDEX is none", vectorIndexName)
+			return s.db.Exec("DROP INDEX IF EXISTS " + vectorIndexName).Error
+		}
+		return nil
+	}
+
+	var chunks int64
+	if err := s.db.Raw("SELECT COUNT(*) FROM document_chunks WHERE embedding IS NOT NULL").Scan(&chunks).Error; err != nil {
+		return err
+	}
+
+	switch {
+	case !exists:
+		log.Printf("Creating %s vector index on %d chunks", s.cfg.Type, chunks)
+	case spec != s.specFor(builtRows):
+		log.Printf("Vector index settings changed from %q, rebuilding it", spec)
+	case s.cfg.Type == VectorIndexIVFFlat && chunks >= ivfflatRebuildMinRows && chunks > 2*builtRows:
+		log.Printf("Rebuilding IVFFlat index, built on %d chunks and now covering %d", builtRows, chunks)
+	default:
+		return nil
+	}
+	return s.build(chunks)
+}
+
+// supportsIterativeScan reports whether a pgvector version, such as "0.8.0", has iterative index scans
+func supportsIterativeScan(version string) bool {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	return major > 0 || minor >= 8
+}
+
+// Rebuild drops and recreates the index with the current settings and chunks
+func (s *VectorIndexService) Rebuild() error {
+	if s.cfg.Type == VectorIndexNone {
+		return fmt.Errorf("no vector index is configured")
+	}
+
+	var chunks int64
+	if err := s.db.Raw("SELECT COUNT(*) FROM document_chunks WHERE embedding IS NOT NULL").Scan(&chunks).Error; err != nil {
+		return err
+	}
+	return s.build(chunks)
+}
+
+// build replaces the index. Its settings and the chunk count are kept in the index comment.
+func (s *VectorIndexService) build(chunks int64) error {
+	start := time.Now()
+	spec := s.specFor(chunks)
+
+	if err := s.db.Exec("DROP INDEX IF EXISTS " + vectorIndexName).Error; err != nil {
+		return err
+	}
+	if err := s.db.Exec(fmt.Sprintf("CREATE INDEX %s ON document_chunks USING %s (embedding %s) WITH (%s)",
+		vectorIndexName, s.cfg.Type, s.cfg.OpClass, s.withClause(chunks))).Error; err != nil {
+		return fmt.Errorf("failed to create %s index: %w", s.cfg.Type, err)
+	}
+	if err := s.db.Exec(fmt.Sprintf("COMMENT ON INDEX %s IS '%s rows=%d'", vectorIndexName, spec, chunks)).Error; err != nil {
+		return err
+	}
+
+	log.Printf("Built vector index %s (%s) in %v", vectorIndexName, spec, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// specFor describes the index built over the given number of chunks, e.g. "hnsw vector_cosine_ops m=16 ef_construction=64"
+func (s *VectorIndexService) specFor(chunks int64) string {
+	return s.cfg.Type + " " + s.cfg.OpClass + " " + strings.ReplaceAll(s.withClause(chunks), ", ", " ")
+}
+
+// withClause returns the storage parameters of the index
+func (s *VectorIndexService) withClause(chunks int64) string {
+	if s.cfg.Type == VectorIndexIVFFlat {
+		return fmt.Sprintf("lists=%d", s.cfg.lists(chunks))
+	}
+	return fmt.Sprintf("m=%d, ef_construction=%d", s.cfg.M, s.cfg.EfConstruction)
+}
+
+// currentSpec reads the settings the existing index was built with
+func (s *VectorIndexService) currentSpec() (string, int64, bool, error) {
+	var rows []struct {
+		Comment string
+	}
+	if err := s.db.Raw(`
+		SELECT COALESCE(obj_description(c.oid, 'pg_class'), '') AS comment
+		FROM pg_class c
+		WHERE c.relname = ? AND c.relkind = 'i'
+	`, vectorIndexName).Scan(&rows).Error; err != nil {
+		return "", 0, false, err
+	}
+	if len(rows) == 0 {
+		return "", 0, false, nil
+	}
+
+	spec, rowsPart, _ := strings.Cut(rows[0].Comment, " rows=")
+	builtRows, _ := strconv.ParseInt(rowsPart, 10, 64)
+	return spec, builtRows, true, nil
+}
+
+// Status returns the definition, validity and size of the index
+func (s *VectorIndexService) Status() (*VectorIndexStatus, error) {
+	status := &VectorIndexStatus{Name: vectorIndexName, Type: s.cfg.Type, IterativeScan: s.cfg.IterativeScan}
+	if err := s.db.Raw("SELECT COUNT(*) FROM document_chunks WHERE embedding IS NOT NULL").Scan(&status.Chunks).Error; err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Definition string
+		Valid      bool
+		SizeBytes  int64
+		Size       string
+	}
+	if err := s.db.Raw(`
+		SELECT pg_get_indexdef(c.oid) AS definition, x.indisvalid AS valid,
+		       pg_relation_size(c.oid) AS size_bytes, pg_size_pretty(pg_relation_size(c.oid)) AS size
+		FROM pg_class c
+		JOIN pg_index x ON x.indexrelid = c.oid
+		WHERE c.relname = ?
+	`, vectorIndexName).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return status, nil
+	}
+
+	status.Exists = true
+	status.Definition = rows[0].Definition
+	status.Valid = rows[0].Valid
+	status.SizeBytes = rows[0].SizeBytes
+	status.Size = rows[0].Size
+	if _, builtRows, _, err := s.currentSpec(); err == nil {
+		status.BuiltRows = builtRows
+	}
+	return status, nil
+}
+
+// MeasureRecall searches the k nearest neighbours of randomly sampled chunks through the index
+// and with an exact scan, and reports how much of the exact result the index found. Like real
+// searches, each query only looks at the chunks of the sampled chunk's tenant. A tenant ID
+// limits the samples to that tenant.
+func (s *VectorIndexService) MeasureRecall(queries, k int, tenantID *uuid.UUID) (*VectorIndexRecall, error) {
+	sampleQuery := s.db.Table("document_chunks").
+		Select("embedding::text AS embedding, tenant_id::text AS tenant_id").
+		Where("embedding IS NOT NULL")
+	if tenantID != nil {
+		sampleQuery = sampleQuery.Where("tenant_id = ?", tenantID.String())
+	}
+	var samples []struct {
+		Embedding string
+		TenantID  string
+	}
+	if err := sampleQuery.Order("random()").Limit(queries).Scan(&samples).Error; err != nil {
+		return nil, err
+	}
+
+	recall := &VectorIndexRecall{Queries: len(samples), K: k}
+	if len(samples) == 0 {
+		return recall, nil
+	}
+
+	var totalRecall float64
+	var indexTime, exactTime time.Duration
+	for _, sample := range samples {
+		start := time.Now()
+		approximate, err := s.nearest(sample.Embedding, sample.TenantID, k, false)
+		if err != nil {
+			return nil, err
+		}
+		indexTime += time.Since(start)
+
+		start = time.Now()
+		exact, err := s.nearest(sample.Embedding, sample.TenantID, k, true)
+		if err != nil {
+			return nil, err
+		}
+		exactTime += time.Since(start)
+
+		found := make(map[string]bool, len(approximate))
+		for _, id := range approximate {
+			found[id] = true
+		}
+		matched := 0
+		for _, id := range exact {
+			if found[id] {
+				matched++
+			}
+		}
+		if len(exact) > 0 {
+			totalRecall += float64(matched) / float64(len(exact))
+		}
+	}
+
+	n := float64(len(samples))
+	recall.Recall = totalRecall / n
+	recall.IndexLatency = float64(indexTime.Microseconds()) / 1000 / n
+	recall.ExactLatency = float64(exactTime.Microseconds()) / 1000 / n
+	return recall, nil
+}
+
+// nearest returns the IDs of the tenant's k chunks closest to the query vector, planned like
+// a search with the configured index parameters or with a sequential scan
+func (s *VectorIndexService) nearest(query, tenantID string, k int, exact bool) ([]string, error) {
+	filterSQL := ` AND d.tenant_id = ? AND dc.tenant_id = ?`
+	filterArgs := []interface{}{tenantID, tenantID}
+
+	var ids []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if exact {
+			if err := tx.Exec("SET LOCAL enable_indexscan = off").Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("SET LOCAL enable_bitmapscan = off").Error; err != nil {
+				return err
+			}
+		} else if err := s.cfg.applySearchParams(tx, k, filterSQL, filterArgs); err != nil {
+			return err
+		}
+
+		args := append([]interface{}{}, filterArgs...)
+		args = append(args, query, k)
+		return tx.Raw(`SELECT dc.id::text FROM document_chunks dc
+			JOIN documents d ON dc.document_id = d.id
+			WHERE d.deleted_at IS NULL AND dc.embedding IS NOT NULL`+filterSQL+`
+			ORDER BY dc.embedding `+s.cfg.distanceOperator()+` ?::vector LIMIT ?`, args...).Scan(&ids).Error
+	})
+	return ids, err
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSupportsIterativeScan(t *testing.T) {
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{"0.8.0", true},
+		{"0.8", true},
+		{"0.10.1", true},
+		{"1.0.0", true},
+		{"0.7.4", false},
+		{"0.5.1", false},
+		{"", false},
+		{"0", false},
+		{"v0.8.0", false},
+		{"0.x", false},
+	}
+
+	for _, tt := range tests {
+		if got := supportsIterativeScan(tt.version); got != tt.want {
+			t.Errorf("supportsIterativeScan(%q) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestVectorIndexLists(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured int
+		chunks     int64
+		want       int
+	}{
+		{"configured", 250, 5000000, 250},
+		{"minimum", 0, 0, 10},
+		{"small corpus", 0, 9999, 10},
+		{"rows / 1000", 0, 500000, 500},
+		{"a million rows", 0, 1000000, 1000},
+		{"square root beyond a million", 0, 4000000, 2000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := VectorIndexConfig{Type: VectorIndexIVFFlat, Lists: tt.configured}
+			if got := c.lists(tt.chunks); got != tt.want {
+				t.Errorf("lists(%d) = %d, want %d", tt.chunks, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVectorIndexScannedRows(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        VectorIndexConfig
+		chunks     int64
+		candidates int
+		want       float64
+	}{
+		{"hnsw candidate list", VectorIndexConfig{Type: VectorIndexHNSW, EfSearch: 40}, 100000, 20, 40},
+		{"hnsw raised to the candidates", VectorIndexConfig{Type: VectorIndexHNSW, EfSearch: 40}, 100000, 100, 100},
+		{"ivfflat probed clusters", VectorIndexConfig{Type: VectorIndexIVFFlat, Probes: 10}, 100000, 20, 10000},
+		{"ivfflat at least one probe", VectorIndexConfig{Type: VectorIndexIVFFlat}, 100000, 20, 1000},
+		{"ivfflat probing every cluster", VectorIndexConfig{Type: VectorIndexIVFFlat, Lists: 4, Probes: 10}, 1000, 20, 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.scannedRows(tt.chunks, tt.candidates); got != tt.want {
+				t.Errorf("scannedRows(%d, %d) = %v, want %v", tt.chunks, tt.candidates, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVectorIndexDistanceOperator(t *testing.T) {
+	tests := []struct {
+		opClass string
+		want    string
+	}{
+		{"vector_cosine_ops", "<=>"},
+		{"vector_l2_ops", "<->"},
+		{"vector_ip_ops", "<#>"},
+		{"", "<=>"},
+	}
+
+	for _, tt := range tests {
+		if got := (VectorIndexConfig{OpClass: tt.opClass}).distanceOperator(); got != tt.want {
+			t.Errorf("distanceOperator(%q) = %q, want %q", tt.opClass, got, tt.want)
+		}
+	}
+}
+
+func TestVectorIndexSpec(t *testing.T) {
+	tests := []struct {
+		cfg    VectorIndexConfig
+		chunks int64
+		want   string
+	}{
+		{VectorIndexConfig{Type: VectorIndexHNSW, OpClass: "vector_cosine_ops", M: 16, EfConstruction: 64}, 5000, "hnsw vector_cosine_ops m=16 ef_construction=64"},
+		{VectorIndexConfig{Type: VectorIndexIVFFlat, OpClass: "vector_l2_ops"}, 250000, "ivfflat vector_l2_ops lists=250"},
+	}
+
+	for _, tt := range tests {
+		if got := (&VectorIndexService{cfg: tt.cfg}).specFor(tt.chunks); got != tt.want {
+			t.Errorf("specFor(%d) = %q, want %q", tt.chunks, got, tt.want)
+		}
+	}
+}
+
+// TestApplySearchParams checks the settings of iterative scans, which do not depend on
+// the number of matching chunks
+func TestApplySearchParams(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        VectorIndexConfig
+		candidates int
+		want       []string
+	}{
+		{"no index", VectorIndexConfig{Type: VectorIndexNone, IterativeScan: true}, 50, nil},
+		{
+			name:       "hnsw",
+			cfg:        VectorIndexConfig{Type: VectorIndexHNSW, EfSearch: 40, IterativeScan: true},
+			candidates: 100,
+			want:       []string{"SET LOCAL hnsw.ef_search = 100", "SET LOCAL hnsw.iterative_scan = strict_order"},
+		},
+		{
+			name:       "ivfflat",
+			cfg:        VectorIndexConfig{Type: VectorIndexIVFFlat, Probes: 10, IterativeScan: true},
+			candidates: 100,
+			want:       []string{"SET LOCAL ivfflat.probes = 10", "SET LOCAL ivfflat.iterative_scan = relaxed_order"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, statements := dryRunDB(t)
+			if err := tt.cfg.applySearchParams(db, tt.candidates, " AND d.tenant_id = ?", []interface{}{"t"}); err != nil {
+				t.Fatalf("applySearchParams() error = %v", err)
+			}
+			if !reflect.DeepEqual(*statements, tt.want) {
+				t.Errorf("statements = %q, want %q", *statements, tt.want)
+			}
+		})
+	}
+}
@@ -3,28 +3,102 @@ package services
 import (
 	"company-ai-training/internal/models"
 	"fmt"
+	"html"
 	"math"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// Search modes
+const (
+	SearchModeVector  = "vector"  // Nearest neighbours of the query embedding
+	SearchModeLexical = "lexical" // Postgres full-text match on chunk content
+	SearchModeHybrid  = "hybrid"  // Both rankings fused with reciprocal rank fusion
+)
+
+// SearchConfig holds retrieval defaults and the hybrid fusion weights
+type SearchConfig struct {
+	DefaultMode   string
+	RRFK          int     // Rank offset k in weight / (k + rank)
+	VectorWeight  float64 // Weight of the vector ranking
+	LexicalWeight float64 // Weight of the full-text ranking
+	MinScore      float64 // Default similarity cutoff, below it a chunk is not relevant
+	Index         VectorIndexConfig
+}
+
+// SearchOptions describes a single retrieval request
+type SearchOptions struct {
+	Query      string
+	Limit      int
+	CategoryID *uuid.UUID     // Optional category filter
+	Mode       string         // Empty uses SearchConfig.DefaultMode
+	MinScore   *float64       // Similarity cutoff, nil uses SearchConfig.MinScore
+	Highlight  bool           // Whether to return snippets with query terms marked
+	Subject    *AccessSubject // Caller whose access rules apply, nil only retrieves unrestricted documents
+}
+
 type VectorService struct {
 	db                      *gorm.DB
-	geminiClient            *GeminiClientV2
+	embedder                Embedder
 	semanticChunkingService *SemanticChunkingService
+	searchConfig            SearchConfig
+	embedConfig             EmbedConfig
+	tenantID                *uuid.UUID // Set on tenant-scoped copies, required for search
+}
+
+func NewVectorService(db *gorm.DB, embedder Embedder, searchConfig SearchConfig, embedConfig EmbedConfig) *VectorService {
+	if searchConfig.DefaultMode == "" {
+		searchConfig.DefaultMode = SearchModeHybrid
+	}
+	if searchConfig.RRFK <= 0 {
+		searchConfig.RRFK = 60
+	}
+
+	return &VectorService{
+		db:                      db,
+		embedder:                embedder,
+		semanticChunkingService: NewSemanticChunkingService(db, embedder, embedConfig),
+		searchConfig:            searchConfig,
+		embedConfig:             embedConfig,
+	}
 }
 
-func NewVectorService(db *gorm.DB, geminiAPIKey string) *VectorService {
+// ForTenant returns a copy of the service that only sees the tenant's chunks and embeds with the tenant's embedder
+func (s *VectorService) ForTenant(tenantID uuid.UUID, embedder Embedder) *VectorService {
+	db := scopeToTenant(s.db, tenantID)
 	return &VectorService{
 		db:                      db,
-		geminiClient:            NewGeminiClientV2(geminiAPIKey),
-		semanticChunkingService: NewSemanticChunkingService(db, geminiAPIKey),
+		embedder:                embedder,
+		semanticChunkingService: NewSemanticChunkingService(db, embedder, s.embedConfig),
+		searchConfig:            s.searchConfig,
+		embedConfig:             s.embedConfig,
+		tenantID:                &tenantID,
 	}
 }
 
+// DefaultSearchMode returns the search mode used when none is requested
+func (s *VectorService) DefaultSearchMode() string {
+	return s.searchConfig.DefaultMode
+}
+
+// DefaultMinScore returns the similarity cutoff used when none is requested
+func (s *VectorService) DefaultMinScore() float64 {
+	return s.searchConfig.MinScore
+}
+
+// IsValidSearchMode reports whether mode is a supported search mode, empty meaning the default
+func IsValidSearchMode(mode string) bool {
+	switch mode {
+	case "", SearchModeVector, SearchModeLexical, SearchModeHybrid:
+		return true
+	}
+	return false
+}
+
 // ChunkAndEmbedDocumentWithSemantics uses semantic chunking to split document content
 func (s *VectorService) ChunkAndEmbedDocumentWithSemantics(doc *models.Document, config *ChunkConfig) error {
 	if config == nil {
@@ -39,51 +113,36 @@ func (s *VectorService) ChunkAndEmbedDocumentWithSemantics(doc *models.Document,
 func (s *VectorService) ChunkAndEmbedDocument(doc *models.Document) error {
 	fmt.Printf("Starting embedding for document: %s\n", doc.Name)
 
-	// Delete existing chunks first to avoid duplicates
-	if err := s.DeleteDocumentChunks(doc.ID); err != nil {
-		fmt.Printf("Warning: Failed to delete existing chunks for document %s: %v\n", doc.Name, err)
-	} else {
-		fmt.Printf("Deleted existing chunks for document %s\n", doc.Name)
-	}
-
 	// Split document into chunks
+	setDocumentStatus(s.db, doc.ID, models.DocumentStatusChunking, nil)
 	chunks := s.splitTextIntoChunks(doc.Content, 1000, 200) // 1000 chars with 200 overlap
+	annotateChunks(doc.Content, documentPages(doc.PageBreaks), chunks)
 	fmt.Printf("Split into %d chunks\n", len(chunks))
 
+	texts := make([]string, len(chunks))
 	for i, chunk := range chunks {
-		fmt.Printf("Processing chunk %d/%d\n", i+1, len(chunks))
-
-		// Generate embedding for chunk
-		embedding, err := s.geminiClient.GenerateEmbedding(chunk)
-		if err != nil {
-			fmt.Printf("Error generating embedding for chunk %d: %v\n", i, err)
-			return fmt.Errorf("failed to generate embedding for chunk %d: %w", i, err)
-		}
-		fmt.Printf("Generated embedding with %d dimensions\n", len(embedding))
-
-		// Create document chunk with UUID
-		chunkID := uuid.New()
-
-		// Convert embedding to PostgreSQL vector format
-		embeddingStr := s.embeddingToString(embedding)
-
-		// Clean the chunk content to avoid encoding issues
-		cleanChunk := strings.ToValidUTF8(chunk, "")
+		texts[i] = chunk.Content
+	}
 
-		// Insert using raw SQL due to vector type compatibility
-		sql := `
-			INSERT INTO document_chunks (id, document_id, content, chunk_index, embedding, created_at, updated_at)
-			VALUES (?, ?, ?, ?, ?::vector, NOW(), NOW())
-		`
+	// Generate embeddings in batches, then replace the document's chunks at once
+	reportChunkProgress(s.db, doc.ID, 0, len(chunks))
+	embeddings, sent, err := embedTexts(s.embedder, texts, s.embedConfig, func(done int) {
+		reportChunkProgress(s.db, doc.ID, done, len(chunks))
+	})
+	if err != nil {
+		fmt.Printf("Error generating embeddings for document %s: %v\n", doc.Name, err)
+		return err
+	}
+	var usage embeddingUsage
+	usage.add(texts, sent, false)
 
-		if err := s.db.Exec(sql, chunkID, doc.ID, cleanChunk, i, embeddingStr).Error; err != nil {
-			fmt.Printf("Error saving chunk %d: %v\n", i, err)
-			return fmt.Errorf("failed to save chunk %d: %w", i, err)
-		}
-		fmt.Printf("Saved chunk %d to database\n", i)
+	if err := s.semanticChunkingService.replaceChunks(doc.ID, chunks, embeddings); err != nil {
+		fmt.Printf("Error saving chunks for document %s: %v\n", doc.Name, err)
+		return err
 	}
 
-	fmt.Printf("Completed embedding for document: %s\n", doc.Name)
+	reportEmbeddingUsage(s.db, doc.ID, usage)
+	fmt.Printf("Completed embedding for document: %s (%d chunks, ~%d tokens, %d cache hits)\n", doc.Name, len(chunks), usage.Tokens, usage.CacheHits)
 	return nil
 }
 
@@ -92,76 +151,320 @@ func (s *VectorService) SearchSimilarChunks(query string, limit int) ([]models.D
 	return s.SearchSimilarChunksWithCategory(query, limit, nil)
 }
 
-// SearchSimilarChunksWithCategory finds document chunks similar to query, optionally filtered by category
+// SearchSimilarChunksWithCategory finds document chunks similar to query, optionally filtered by category.
+// Only unrestricted documents are searched; use Search with a Subject to apply access rules.
 func (s *VectorService) SearchSimilarChunksWithCategory(query string, limit int, categoryID *uuid.UUID) ([]models.DocumentChunk, error) {
-	// Generate embedding for query
-	queryEmbedding, err := s.geminiClient.GenerateEmbedding(query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
+	return s.Search(SearchOptions{
+		Query:      query,
+		Limit:      limit,
+		CategoryID: categoryID,
+	})
+}
+
+// Search retrieves the chunks most relevant to the query using the requested search mode.
+// Every mode ranks candidates with weight / (k + rank), so hybrid search is the reciprocal
+// rank fusion of the vector and full-text rankings. Every chunk's Score lies in [0, 1] and
+// must reach MinScore: in vector and hybrid mode it is the cosine similarity to the query,
+// full-text matches included, and lexical mode, which does not embed the query at all,
+// scores the share of the query's terms found in the chunk.
+func (s *VectorService) Search(opts SearchOptions) ([]models.DocumentChunk, error) {
+	// Raw SQL bypasses the scoped handle, so an unscoped search could cross tenants
+	if s.tenantID == nil {
+		return nil, fmt.Errorf("search requires a tenant-scoped vector service")
+	}
+
+	mode := opts.Mode
+	if mode == "" {
+		mode = s.searchConfig.DefaultMode
+	}
+	if !IsValidSearchMode(mode) {
+		return nil, fmt.Errorf("unsupported search mode: %s", mode)
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = 10
+	}
+	minScore := s.searchConfig.MinScore
+	if opts.MinScore != nil {
+		minScore = *opts.MinScore
 	}
 
-	// Convert embedding to string for SQL query
-	embeddingStr := s.embeddingToString(queryEmbedding)
+	useVector := mode == SearchModeVector || mode == SearchModeHybrid
+	useLexical := mode == SearchModeLexical || mode == SearchModeHybrid
 
-	// Build SQL query with optional category filter
-	sql := `
-		SELECT dc.id, dc.document_id, dc.content, dc.chunk_index, dc.created_at, dc.updated_at,
-		       d.name as document_name
-		FROM document_chunks dc
-		JOIN documents d ON dc.document_id = d.id
-		WHERE d.deleted_at IS NULL
-	`
+	lexicalQuery := buildLexicalQuery(opts.Query)
+	if lexicalQuery == "" {
+		useLexical = false
+		if !useVector {
+			return nil, nil
+		}
+	}
 
+	// Each ranking contributes more candidates than requested so fusion has room to reorder
+	candidates := opts.Limit * 4
+	if candidates < 20 {
+		candidates = 20
+	}
+
+	filterSQL, filterArgs := s.chunkFilter(opts)
+
+	var embeddingStr string
+	if useVector {
+		queryEmbedding, err := s.embedder.GenerateEmbedding(opts.Query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate query embedding: %w", err)
+		}
+		embeddingStr = s.embeddingToString(queryEmbedding)
+	}
+
+	var ctes, rankings []string
 	var args []interface{}
 
-	if categoryID != nil {
-		sql += ` AND EXISTS (
-			SELECT 1 FROM document_categories dc_rel 
-			WHERE dc_rel.document_id = d.id AND dc_rel.category_id = ?
+	if useVector {
+		// Rank by the distance the index was built for, so it can serve the query
+		distance := s.searchConfig.Index.distanceOperator()
+		ctes = append(ctes, `vector_ranked AS (
+			SELECT dc.id, ROW_NUMBER() OVER (ORDER BY dc.embedding `+distance+` ?::vector) AS rank
+			FROM document_chunks dc
+			JOIN documents d ON dc.document_id = d.id
+			WHERE d.deleted_at IS NULL AND dc.embedding IS NOT NULL`+filterSQL+`
+			ORDER BY dc.embedding `+distance+` ?::vector
+			LIMIT ?
+		)`)
+		args = append(args, embeddingStr)
+		args = append(args, filterArgs...)
+		args = append(args, embeddingStr, candidates)
+		rankings = append(rankings, "vector_ranked")
+	}
+
+	if useLexical {
+		ctes = append(ctes, `lexical_ranked AS (
+			SELECT dc.id, ROW_NUMBER() OVER (ORDER BY ts_rank_cd(dc.content_tsv, q.query) DESC) AS rank
+			FROM document_chunks dc
+			JOIN documents d ON dc.document_id = d.id
+			CROSS JOIN to_tsquery('simple', ?) AS q(query)
+			WHERE d.deleted_at IS NULL AND dc.content_tsv @@ q.query`+filterSQL+`
+			ORDER BY ts_rank_cd(dc.content_tsv, q.query) DESC
+			LIMIT ?
+		)`)
+		args = append(args, lexicalQuery)
+		args = append(args, filterArgs...)
+		args = append(args, candidates)
+		rankings = append(rankings, "lexical_ranked")
+	}
+
+	// Fuse the rankings: chunks found by both get the sum of their reciprocal ranks
+	var fused string
+	if len(rankings) == 2 {
+		fused = `fused AS (
+			SELECT COALESCE(v.id, l.id) AS id,
+			       COALESCE(?::float8 / (? + v.rank), 0) + COALESCE(?::float8 / (? + l.rank), 0) AS fused_score
+			FROM vector_ranked v
+			FULL OUTER JOIN lexical_ranked l ON v.id = l.id
 		)`
-		args = append(args, categoryID.String())
+		args = append(args, s.searchConfig.VectorWeight, s.searchConfig.RRFK, s.searchConfig.LexicalWeight, s.searchConfig.RRFK)
+	} else {
+		weight := s.searchConfig.VectorWeight
+		if useLexical {
+			weight = s.searchConfig.LexicalWeight
+		}
+		fused = `fused AS (
+			SELECT id, ?::float8 / (? + rank) AS fused_score FROM ` + rankings[0] + `
+		)`
+		args = append(args, weight, s.searchConfig.RRFK)
+	}
+	ctes = append(ctes, fused)
+
+	// Lexical scores are computed from the chunk content once it is loaded
+	scoreSQL := "0::float8"
+	if useVector {
+		scoreSQL = "COALESCE(1 - (dc.embedding <=> ?::vector), 0)"
+		args = append(args, embeddingStr)
+	}
+	ctes = append(ctes, `scored AS (
+		SELECT f.id, f.fused_score, `+scoreSQL+` AS score
+		FROM fused f
+		JOIN document_chunks dc ON dc.id = f.id
+	)`)
+
+	// Matches are delimited with characters that cannot be mistaken for markup, and marked
+	// up only after the text around them has been escaped
+	highlightSQL := "''"
+	if opts.Highlight && lexicalQuery != "" {
+		highlightSQL = `ts_headline('simple', dc.content, to_tsquery('simple', ?), ?)`
+		args = append(args, lexicalQuery, headlineOptions)
 	}
 
-	sql += ` ORDER BY dc.embedding <=> ?::vector LIMIT ?`
-	args = append(args, embeddingStr, limit)
+	sql := `WITH ` + strings.Join(ctes, ",\n") + `
+		SELECT dc.id, dc.document_id, dc.content, dc.chunk_index, dc.start_offset, dc.end_offset, dc.section_path,
+		       dc.page_start, dc.page_end, dc.token_count, dc.created_at, dc.updated_at,
+		       d.name as document_name, sc.score, ` + highlightSQL + ` AS highlight
+		FROM scored sc
+		JOIN document_chunks dc ON dc.id = sc.id
+		JOIN documents d ON dc.document_id = d.id
+		ORDER BY sc.fused_score DESC
+	`
 
 	type ChunkResult struct {
 		ID           string    `json:"id"`
 		DocumentID   string    `json:"document_id"`
 		Content      string    `json:"content"`
 		ChunkIndex   int       `json:"chunk_index"`
+		StartOffset  int       `json:"start_offset"`
+		EndOffset    int       `json:"end_offset"`
+		SectionPath  string    `json:"section_path"`
+		PageStart    int       `json:"page_start"`
+		PageEnd      int       `json:"page_end"`
+		TokenCount   int       `json:"token_count"`
 		CreatedAt    time.Time `json:"created_at"`
 		UpdatedAt    time.Time `json:"updated_at"`
 		DocumentName string    `json:"document_name"`
+		Score        float64   `json:"score"`
+		Highlight    string    `json:"highlight"`
 	}
 
+	// Index search parameters only apply to the transaction running the query
 	var results []ChunkResult
-	if err := s.db.Raw(sql, args...).Scan(&results).Error; err != nil {
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if useVector {
+			if err := s.searchConfig.Index.applySearchParams(tx, candidates, filterSQL, filterArgs); err != nil {
+				return err
+			}
+		}
+		return tx.Raw(sql, args...).Scan(&results).Error
+	}); err != nil {
 		return nil, fmt.Errorf("failed to search similar chunks: %w", err)
 	}
 
 	// Convert results to DocumentChunk models
 	var chunks []models.DocumentChunk
+	terms := lexicalTerms(opts.Query)
 	for _, result := range results {
 		docID, _ := uuid.Parse(result.DocumentID)
 		chunkID, _ := uuid.Parse(result.ID)
 
 		chunk := models.DocumentChunk{
-			ID:         chunkID,
-			DocumentID: docID,
-			Content:    result.Content,
-			ChunkIndex: result.ChunkIndex,
-			CreatedAt:  result.CreatedAt,
-			UpdatedAt:  result.UpdatedAt,
+			ID:          chunkID,
+			DocumentID:  docID,
+			Content:     result.Content,
+			ChunkIndex:  result.ChunkIndex,
+			StartOffset: result.StartOffset,
+			EndOffset:   result.EndOffset,
+			SectionPath: result.SectionPath,
+			PageStart:   result.PageStart,
+			PageEnd:     result.PageEnd,
+			TokenCount:  result.TokenCount,
+			CreatedAt:   result.CreatedAt,
+			UpdatedAt:   result.UpdatedAt,
+			Score:       result.Score,
+			Highlight:   markHighlight(result.Highlight),
 			Document: models.Document{
 				ID:   docID,
 				Name: result.DocumentName,
 			},
 		}
+		if !useVector {
+			chunk.Score = lexicalCoverage(terms, chunk.Content)
+		}
 		chunks = append(chunks, chunk)
 	}
 
-	return chunks, nil
+	return keepRelevant(chunks, minScore, opts.Limit), nil
+}
+
+// keepRelevant returns the first chunks, up to limit, whose score reaches minScore
+func keepRelevant(chunks []models.DocumentChunk, minScore float64, limit int) []models.DocumentChunk {
+	var relevant []models.DocumentChunk
+	for _, chunk := range chunks {
+		if len(relevant) == limit {
+			break
+		}
+		if chunk.Score >= minScore {
+			relevant = append(relevant, chunk)
+		}
+	}
+	return relevant
+}
+
+// lexicalCoverage returns the share of the query terms that occur in content, in [0, 1]
+func lexicalCoverage(terms []string, content string) float64 {
+	if len(terms) == 0 {
+		return 0
+	}
+
+	words := make(map[string]bool)
+	for _, word := range lexicalTerms(content) {
+		words[word] = true
+	}
+
+	matched := 0
+	for _, term := range terms {
+		if words[term] {
+			matched++
+		}
+	}
+	return float64(matched) / float64(len(terms))
+}
+
+// Delimiters of the matches in ts_headline output, from the Unicode private use area
+const (
+	highlightStart = "\uE000"
+	highlightStop  = "\uE001"
+)
+
+var headlineOptions = `StartSel=` + highlightStart + `, StopSel=` + highlightStop +
+	`, MaxFragments=2, MaxWords=30, MinWords=10, FragmentDelimiter=" … "`
+
+// markHighlight HTML-escapes a ts_headline snippet of raw document text and wraps its
+// matches in <mark>, so markup in documents is shown as text rather than rendered
+func markHighlight(headline string) string {
+	escaped := html.EscapeString(headline)
+	escaped = strings.ReplaceAll(escaped, highlightStart, "<mark>")
+	return strings.ReplaceAll(escaped, highlightStop, "</mark>")
+}
+
+// chunkFilter builds the WHERE conditions shared by every ranking, on aliases dc and d
+func (s *VectorService) chunkFilter(opts SearchOptions) (string, []interface{}) {
+	// Both sides are checked so a chunk can never surface under another tenant's document
+	sql := ` AND d.tenant_id = ? AND dc.tenant_id = ?`
+	args := []interface{}{s.tenantID.String(), s.tenantID.String()}
+
+	if opts.CategoryID != nil {
+		sql += ` AND EXISTS (
+				SELECT 1 FROM document_categories dc_rel
+				WHERE dc_rel.document_id = d.id AND dc_rel.category_id = ?
+			)`
+		args = append(args, opts.CategoryID.String())
+	}
+
+	// Restricted documents never become candidates for callers without access
+	accessSQL, accessArgs := documentAccessFilter(opts.Subject)
+	sql += accessSQL
+	args = append(args, accessArgs...)
+
+	return sql, args
+}
+
+// buildLexicalQuery turns free text into an OR tsquery over its words, so a chunk
+// matching any term is a candidate and chunks matching more terms rank higher
+func buildLexicalQuery(query string) string {
+	return strings.Join(lexicalTerms(query), " | ")
+}
+
+// lexicalTerms returns the distinct lowercase words of text, in order of first occurrence
+func lexicalTerms(text string) []string {
+	terms := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := make(map[string]bool)
+	var unique []string
+	for _, term := range terms {
+		if !seen[term] {
+			seen[term] = true
+			unique = append(unique, term)
+		}
+	}
+	return unique
 }
 
 // GetDocumentChunks retrieves all chunks for a document
@@ -178,13 +481,13 @@ func (s *VectorService) DeleteDocumentChunks(documentID uuid.UUID) error {
 	return s.db.Where("document_id = ?", documentID).Delete(&models.DocumentChunk{}).Error
 }
 
-// splitTextIntoChunks splits text into overlapping chunks
-func (s *VectorService) splitTextIntoChunks(text string, chunkSize, overlap int) []string {
+// splitTextIntoChunks splits text into overlapping chunks, keeping their offsets in text
+func (s *VectorService) splitTextIntoChunks(text string, chunkSize, overlap int) []SemanticChunk {
 	if len(text) <= chunkSize {
-		return []string{text}
+		return []SemanticChunk{{Content: text, StartIndex: 0, EndIndex: len(text)}}
 	}
 
-	var chunks []string
+	var chunks []SemanticChunk
 	start := 0
 
 	for start < len(text) {
@@ -212,7 +515,7 @@ func (s *VectorService) splitTextIntoChunks(text string, chunkSize, overlap int)
 		}
 
 		// Add chunk and break if we've reached the end
-		chunks = append(chunks, strings.TrimSpace(chunk))
+		chunks = append(chunks, SemanticChunk{Content: strings.TrimSpace(chunk), StartIndex: start, EndIndex: end})
 
 		// If we reached the end, break to avoid infinite loop
 		if end >= len(text) {
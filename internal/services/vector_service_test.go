@@ -0,0 +1,127 @@
+package services
+
+import (
+	"company-ai-training/internal/models"
+	"reflect"
+	"testing"
+)
+
+func TestBuildLexicalQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", ""},
+		{"  ?!  ", ""},
+		{"nghỉ phép", "nghỉ | phép"},
+		{"Nghỉ phép, nghỉ ốm?", "nghỉ | phép | ốm"},
+		{"VPN & 2FA: (setup)", "vpn | 2fa | setup"},
+		{"it's a:b|c!d", "it | s | a | b | c | d"},
+	}
+
+	for _, tt := range tests {
+		if got := buildLexicalQuery(tt.query); got != tt.want {
+			t.Errorf("buildLexicalQuery(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestLexicalCoverage(t *testing.T) {
+	terms := lexicalTerms("Nhân viên được nghỉ phép bao nhiêu ngày?")
+
+	tests := []struct {
+		name    string
+		content string
+		want    float64
+	}{
+		{"all terms", "Mỗi nhân viên được nghỉ phép 12 ngày. Bao nhiêu ngày còn lại do quản lý duyệt, không bao giờ quá hạn.", 1},
+		{"common words only", "Hợp đồng được ký trong ngày làm việc.", 2.0 / 8},
+		{"no terms", "VPN setup guide", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lexicalCoverage(terms, tt.content); got != tt.want {
+				t.Errorf("lexicalCoverage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := lexicalCoverage(nil, "anything"); got != 0 {
+		t.Errorf("lexicalCoverage(nil) = %v, want 0", got)
+	}
+}
+
+func TestKeepRelevantDropsWeakMatches(t *testing.T) {
+	chunk := func(content string, score float64) models.DocumentChunk {
+		return models.DocumentChunk{Content: content, Score: score}
+	}
+
+	// Ordered by fused rank: a chunk sharing only common words with the question may rank
+	// first lexically, but is dropped by its low score like any other weak match
+	chunks := []models.DocumentChunk{
+		chunk("Hợp đồng được ký trong ngày làm việc.", 0.25),
+		chunk("Mỗi nhân viên được nghỉ phép 12 ngày.", 0.82),
+		chunk("Nghỉ phép năm được cộng dồn sang năm sau.", 0.61),
+		chunk("Quy trình cấp VPN.", 0.49),
+		chunk("Nghỉ phép không lương cần quản lý duyệt.", 0.55),
+	}
+
+	tests := []struct {
+		name     string
+		minScore float64
+		limit    int
+		want     []float64
+	}{
+		{"drops weak matches", 0.5, 10, []float64{0.82, 0.61, 0.55}},
+		{"limit applies after the cutoff", 0.5, 2, []float64{0.82, 0.61}},
+		{"score equal to the cutoff is kept", 0.49, 10, []float64{0.82, 0.61, 0.49, 0.55}},
+		{"nothing relevant", 0.9, 10, nil},
+		{"no cutoff", 0, 10, []float64{0.25, 0.82, 0.61, 0.49, 0.55}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []float64
+			for _, c := range keepRelevant(chunks, tt.minScore, tt.limit) {
+				got = append(got, c.Score)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("keepRelevant() scores = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkHighlight(t *testing.T) {
+	tests := []struct {
+		name     string
+		headline string
+		want     string
+	}{
+		{"plain", "no matches here", "no matches here"},
+		{
+			name:     "marks matches",
+			headline: "được " + highlightStart + "nghỉ" + highlightStop + " " + highlightStart + "phép" + highlightStop + " 12 ngày",
+			want:     "được <mark>nghỉ</mark> <mark>phép</mark> 12 ngày",
+		},
+		{
+			name:     "escapes document markup",
+			headline: `<script>alert("x")</script> ` + highlightStart + "<b>VPN</b>" + highlightStop + " & 2FA",
+			want:     "&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; <mark>&lt;b&gt;VPN&lt;/b&gt;</mark> &amp; 2FA",
+		},
+		{
+			name:     "literal mark tags in the document stay text",
+			headline: "<mark>fake</mark>",
+			want:     "&lt;mark&gt;fake&lt;/mark&gt;",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markHighlight(tt.headline); got != tt.want {
+				t.Errorf("markHighlight() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"company-ai-training/internal/api"
 	"company-ai-training/internal/config"
 	"company-ai-training/internal/database"
+	"company-ai-training/internal/models"
 	"company-ai-training/internal/services"
 	"log"
 )
@@ -15,22 +16,110 @@ func main() {
 		log.Fatal("Failed to load configuration:", err)
 	}
 
+	// Initialize model providers
+	chatModel, err := services.NewChatModel(cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize chat model:", err)
+	}
+	embedder, err := services.NewEmbedder(cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize embedder:", err)
+	}
+	log.Printf("Using embedding model %s (%d dimensions)", embedder.ModelName(), embedder.Dimension())
+
 	// Initialize database
-	db, err := database.Initialize(cfg.DatabaseURL)
+	db, err := database.Initialize(cfg.DatabaseURL, database.EmbeddingOptions{
+		Model:       cfg.EmbeddingProvider + "/" + embedder.ModelName(),
+		Dimension:   embedder.Dimension(),
+		Rebuild:     cfg.EmbeddingRebuild,
+		MaxAttempts: cfg.IngestionMaxAttempts,
+	})
 	if err != nil {
 		log.Fatal("Failed to initialize database:", err)
 	}
 
+	// Create or update the approximate nearest neighbour index on chunk embeddings
+	vectorIndex := services.VectorIndexConfig{
+		Type:           cfg.VectorIndex,
+		OpClass:        cfg.VectorIndexOpClass,
+		M:              cfg.HNSWM,
+		EfConstruction: cfg.HNSWEfConstruction,
+		EfSearch:       cfg.HNSWEfSearch,
+		Lists:          cfg.IVFFlatLists,
+		Probes:         cfg.IVFFlatProbes,
+	}
+	vectorIndexService := services.NewVectorIndexService(db, vectorIndex)
+	if err := vectorIndexService.EnsureIndex(); err != nil {
+		log.Fatal("Failed to initialize vector index:", err)
+	}
+
+	// Serve repeated texts from the embedding cache
+	embeddingCache := services.NewEmbeddingCache(db)
+	if cfg.EmbeddingCache {
+		embedder = services.NewCachedEmbedder(embedder, embeddingCache)
+	}
+
+	// Initialize original file storage
+	blobStore, err := services.NewBlobStore(cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize blob store:", err)
+	}
+
 	// Initialize services
-	documentService := services.NewDocumentService(db)
-	vectorService := services.NewVectorService(db, cfg.GeminiAPIKey)
+	documentService := services.NewDocumentService(db, blobStore, services.DefaultExtractorRegistry(), cfg.DuplicatePolicy)
+	vectorService := services.NewVectorService(db, embedder, services.SearchConfig{
+		DefaultMode:   cfg.SearchMode,
+		RRFK:          cfg.SearchRRFK,
+		VectorWeight:  cfg.SearchVectorWeight,
+		LexicalWeight: cfg.SearchLexicalWeight,
+		MinScore:      cfg.SearchMinScore,
+		Index:         vectorIndexService.Config(),
+	}, services.EmbedConfig{
+		BatchSize:   cfg.EmbedBatchSize,
+		Concurrency: cfg.EmbedConcurrency,
+	})
 	userService := services.NewUserService(db)
-	chatService := services.NewChatService(vectorService, userService, cfg.GeminiAPIKey)
+	chatService := services.NewChatService(vectorService, userService, chatModel)
 	ticketService := services.NewTicketService(db)
 	categoryService := services.NewCategoryService(db)
+	accessService := services.NewAccessControlService(db)
+	tenantService := services.NewTenantService(db, cfg, chatModel, embedder)
+	ingestionService := services.NewIngestionService(db, vectorService, tenantService, cfg.IngestionWorkers, cfg.IngestionMaxAttempts)
+
+	// Start ingestion workers, resuming jobs interrupted by the last shutdown
+	if err := ingestionService.Start(); err != nil {
+		log.Fatal("Failed to start ingestion workers:", err)
+	}
+
+	// Initialize authentication
+	var authService *services.AuthService
+	if cfg.AuthDisabled {
+		log.Printf("WARNING: authentication is disabled, every request is accepted")
+	} else {
+		authService, err = services.NewAuthService(db, services.AuthConfig{
+			JWTSecret:   cfg.AuthJWTSecret,
+			JWKSFile:    cfg.AuthJWKSFile,
+			JWTIssuer:   cfg.AuthIssuer,
+			JWTAudience: cfg.AuthAudience,
+			TrustEmail:  cfg.AuthTrustEmail,
+		})
+		if err != nil {
+			log.Fatal("Failed to initialize authentication:", err)
+		}
+		if cfg.AuthBootstrapAPIKey != "" {
+			// The bootstrap key administers the default tenant, which may create the others
+			defaultTenant, err := tenantService.GetDefaultTenant()
+			if err != nil {
+				log.Fatal("Failed to load default tenant:", err)
+			}
+			if _, err := authService.EnsureAPIKey(defaultTenant.ID, "bootstrap", cfg.AuthBootstrapAPIKey, models.RoleAdmin); err != nil {
+				log.Fatal("Failed to register bootstrap API key:", err)
+			}
+		}
+	}
 
 	// Initialize API server
-	server := api.NewServer(documentService, vectorService, chatService, userService, ticketService, categoryService)
+	server := api.NewServer(documentService, vectorService, chatService, userService, ticketService, categoryService, ingestionService, accessService, authService, tenantService, embeddingCache, vectorIndexService, cfg.CORSAllowedOrigins)
 
 	// Start server
 	log.Printf("Starting server on port %s", cfg.Port)